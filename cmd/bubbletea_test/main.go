@@ -1,5 +1,3 @@
-//go:build dev
-
 package main
 
 import (
@@ -13,11 +11,9 @@ import (
 	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/term"
 	_ "github.com/srlehn/termimg/terminals"
-
-	// "github.com/srlehn/termimg/tty/contdtty"
 	"github.com/srlehn/termimg/tty/bubbleteatty"
 
-	tea "github.com/charmbracelet/bubbletea"
+	tea "charm.land/bubbletea/v2"
 )
 
 var testImg []byte = assets.SnakePic
@@ -45,9 +41,6 @@ func m() error {
 	//defer cancel()
 	teaOpts := []tea.ProgramOption{
 		//tea.WithContext(ctx),
-		tea.WithAltScreen(),
-		tea.WithInput(os.Stdin),
-		tea.WithOutput(os.Stdout),
 	}
 	var prog *tea.Program
 	timgOpts := []term.Option{
@@ -1,18 +1,14 @@
-//go:build dev
-
 package main
 
 import (
 	"image"
-	"log"
 
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+
 	"github.com/srlehn/termimg"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/term"
-	"github.com/srlehn/termimg/tty/bubbleteatty"
 	"github.com/srlehn/termimg/tui/bubbleteaimg"
 )
 
@@ -20,27 +16,30 @@ func newTestModel1() *model1 {
 	bounds := image.Rect(10, 10, 60, 30)
 	text := `Lorem ipsum dolor sit amet, consectetur adipisici elit, sed eiusmod tempor incidunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquid ex ea commodi consequat. Quis aute iure reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. Excepteur sint obcaecat cupiditat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.`
 	style := lipgloss.NewStyle().
-		Border(lipgloss.DoubleBorder(), true).Margin(2).Padding(0, 1).
-		Width(bounds.Dx()).Height(bounds.Dy())
-	return newModel1(&style, bounds, text)
+		Border(lipgloss.DoubleBorder(), true).Margin(2).Padding(0, 1)
+	return newModel1(style, bounds, text)
 }
 
 var _ tea.Model = (*model1)(nil)
 
 type model1 struct {
 	img       *bubbleteaimg.Image
+	bounds    image.Rectangle
 	styleText lipgloss.Style
 	styleImg  lipgloss.Style
 	text      string
+	showImg   bool
 }
 
-func newModel1(style *lipgloss.Style, bounds image.Rectangle, text string) *model1 {
-	styleText := style.Copy().Width(bounds.Dx() / 2).Height(bounds.Dy())
-	styleImg := style.Copy().Width(bounds.Dx()).Height(bounds.Dy())
+func newModel1(style lipgloss.Style, bounds image.Rectangle, text string) *model1 {
 	mdl := &model1{
-		styleText: styleText,
-		styleImg:  styleImg,
-		text:      text,
+		bounds: bounds,
+		styleText: style.
+			Width(bounds.Dx() / 2).Height(bounds.Dy()).
+			BorderForeground(lipgloss.Color(`32`)), // 63, 228
+		styleImg: style,
+		text:     text,
+		showImg:  true,
 	}
 	return mdl
 }
@@ -52,64 +51,54 @@ func (m *model1) Setup(tm *term.Terminal) error {
 	if err := errors.NilParam(tm); err != nil {
 		return err
 	}
-	img, err := bubbleteaimg.NewImage(tm, termimg.NewImageBytes(testImg), &m.styleImg)
+	img, err := bubbleteaimg.NewImage(tm, termimg.NewImageBytes(testImg))
 	if err != nil {
 		return err
 	}
+	// fit the image with its frame into the space beside the text
+	img.SetSize(0, 0)
+	img.SetStyle(m.styleImg)
 	m.img = img
-
-	tty, ok := tm.TTY().(*bubbleteatty.TTYBubbleTea)
-	if !ok || tty == nil {
-		log.Println(`unsupported tty`)
-		return errors.New(`unsupported tty`)
-	}
-	renderer := tty.LipGlossRenderer()
-	log.Printf("REND %+#v\n", renderer)
-	log.Printf("REND color profile %v\n", renderer.ColorProfile())
-	log.Printf("REND output %+#v\n", renderer.Output())
-	renderer.SetColorProfile(termenv.ANSI256)
-	// lipgloss.SetDefaultRenderer(renderer)
-	m.styleText = m.styleText.
-		Copy().
-		Renderer(renderer).
-		BorderForeground(lipgloss.Color(`32`)) // 63, 228
-		// BorderBackground(lipgloss.Color(`34`))  // 63, 228
 	return nil
 }
 
-func (m *model1) Init() tea.Cmd {
-	return func() tea.Msg {
-		if m != nil && m.img != nil {
-			return m.img.Init()
-		}
-		return nil
-	}
-}
+func (m *model1) Init() tea.Cmd { return nil }
 
 func (m *model1) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
-	case tea.KeyMsg:
+	case tea.WindowSizeMsg:
+		if m.img != nil {
+			textWidth := m.styleText.GetWidth() + m.styleText.GetHorizontalMargins()
+			m.img.SetAvailableSize(max(msg.Width-textWidth, 1), msg.Height)
+		}
+	case tea.KeyPressMsg:
 		switch msg.String() {
 		case "ctrl+c", "q":
 			return m, tea.Quit
-		}
-	default:
-		log.Printf("tea msg: %T %+#[1]v\n", msg)
-		if m != nil && m.img != nil {
-			mImg, cmd := m.img.Update(msg)
-			m.img = mImg.(*bubbleteaimg.Image)
-			return m, cmd
+		case "space":
+			// toggle the image for testing its clearing
+			m.showImg = !m.showImg
 		}
 	}
-
-	// cmd := func() tea.Msg { return msg }
-	// return m, cmd
+	if m.img != nil {
+		var cmd tea.Cmd
+		m.img, cmd = m.img.Update(msg)
+		return m, cmd
+	}
 	return m, nil
 }
 
-func (m *model1) View() string {
-	if m == nil || m.img == nil {
-		return `<nil bubbletea.Model>`
+func (m *model1) View() tea.View {
+	var content string
+	switch {
+	case m == nil || m.img == nil:
+		content = `<nil bubbletea.Model>`
+	case m.showImg:
+		content = lipgloss.JoinHorizontal(lipgloss.Bottom, m.styleText.Render(m.text), m.img.View())
+	default:
+		content = m.styleText.Render(m.text)
 	}
-	return lipgloss.JoinHorizontal(lipgloss.Bottom, m.styleText.Render(m.text), m.img.View())
+	v := tea.NewView(content)
+	v.AltScreen = true
+	return v
 }
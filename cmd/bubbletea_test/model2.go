@@ -1,5 +1,3 @@
-//go:build dev
-
 package main
 
 import (
@@ -10,19 +8,19 @@ import (
 	"strings"
 	"time"
 
-	"github.com/charmbracelet/bubbles/filepicker"
-	tea "github.com/charmbracelet/bubbletea"
+	"charm.land/bubbles/v2/filepicker"
+	tea "charm.land/bubbletea/v2"
+
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/util"
 	"github.com/srlehn/termimg/term"
-	"github.com/srlehn/termimg/tty/bubbleteatty"
 )
 
 func newTestModel2() *model2 {
 	fp := filepicker.New()
 	fp.AllowedTypes = []string{".png", ".jpg"}
 	fp.CurrentDirectory = filepath.Join(util.Must2(os.UserHomeDir()), `Pictures`)
-	fp.Height = 20
+	fp.SetHeight(20)
 	// fp.AutoHeight = true
 	fp.FileAllowed = true
 	// fp.DirAllowed = true
@@ -52,15 +50,6 @@ func (m *model2) Setup(tm *term.Terminal) error {
 	if err := errors.NilReceiver(m); err != nil {
 		return err
 	}
-	tty, ok := tm.TTY().(*bubbleteatty.TTYBubbleTea)
-	if !ok || tty == nil {
-		return errors.New(`unsupported tty`)
-	}
-	renderer := tty.LipGlossRenderer()
-	log.Println("REND", renderer)
-	m.filepicker.Styles.DisabledCursor = m.filepicker.Styles.DisabledCursor.Renderer(renderer)
-	m.filepicker.Styles.Selected = m.filepicker.Styles.Selected.Renderer(renderer)
-
 	for _, d := range tm.Drawers() {
 		m.t += d.Name() + `,`
 	}
@@ -78,8 +67,8 @@ func (m *model2) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// log.Printf("%+#v\n", msg)
 
 	switch msg := msg.(type) {
-	case tea.KeyMsg:
-		log.Printf("%q\t%q\t%t\n", string(msg.Runes), msg.String(), msg.Alt)
+	case tea.KeyPressMsg:
+		log.Printf("%q\t%q\n", msg.Text, msg.String())
 		switch msg.String() {
 		case "ctrl+c", "q":
 			m.quitting = true
@@ -120,12 +109,12 @@ func (m *model2) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-func (m *model2) View() string {
+func (m *model2) View() tea.View {
 	// return m.t
 	// return m.filepicker.CurrentDirectory
 	// return m.filepicker.View()
 	if m.quitting {
-		return ""
+		return tea.NewView("")
 	}
 	var s strings.Builder
 	s.WriteString("\n  ")
@@ -138,5 +127,5 @@ func (m *model2) View() string {
 		s.WriteString("Selected file: " + m.filepicker.Styles.Selected.Render(m.selectedFile))
 	}
 	s.WriteString("\n\n" + m.filepicker.View() + "\n")
-	return s.String()
+	return tea.NewView(s.String())
 }
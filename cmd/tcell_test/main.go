@@ -1,12 +1,12 @@
 package main
 
 import (
-	"image"
 	_ "image/png"
 	"log"
 	"log/slog"
 
 	"github.com/gdamore/tcell/v2"
+	"github.com/gdamore/tcell/v2/views"
 
 	"github.com/srlehn/termimg"
 	_ "github.com/srlehn/termimg/drawers/all"
@@ -75,33 +75,44 @@ func m() error {
 
 	x, y := 10, 10
 	w, h := 25, 10
-	bounds := image.Rect(x, y, x+w, y+h)
 
-	// mark the area
-	scr.SetContent(x-1, y-1, '#', nil, tcell.StyleDefault)
-	scr.SetContent(x+w, y-1, '#', nil, tcell.StyleDefault)
-	scr.SetContent(x-1, y+h, '#', nil, tcell.StyleDefault)
-	scr.SetContent(x+w, y+h, '#', nil, tcell.StyleDefault)
-	scr.Sync()
-
-	img, err := tcellimg.NewImage(termimg.NewImageBytes(assets.SnakePic), bounds, tm, scr)
+	img, err := tcellimg.NewImage(termimg.NewImageBytes(assets.SnakePic), tm, scr)
 	if err != nil {
 		return err
 	}
-	scr.Clear()
+	defer img.Close()
+	img.SetView(views.NewViewPort(scr, x, y, w, h))
 
-	img.Draw()
+	draw := func() {
+		// mark the area
+		scr.SetContent(x-1, y-1, '#', nil, tcell.StyleDefault)
+		scr.SetContent(x+w, y-1, '#', nil, tcell.StyleDefault)
+		scr.SetContent(x-1, y+h, '#', nil, tcell.StyleDefault)
+		scr.SetContent(x+w, y+h, '#', nil, tcell.StyleDefault)
+		img.Draw()
+		scr.Show()
+	}
+	scr.Clear()
+	draw()
 
 	_ = qu.(interface{ Close() error }).Close() // stop stealing input from tcell
 outer:
 	for {
 		ev := scr.PollEvent()
 		switch ev := ev.(type) {
+		case *tcell.EventResize:
+			scr.Sync()
+			img.Resize()
+			draw()
 		case *tcell.EventKey:
 			switch ev.Key() {
 			case tcell.KeyEnter: // break on Enter key event
 				break outer
 			}
+		default:
+			if img.HandleEvent(ev) {
+				draw()
+			}
 		}
 	}
 
@@ -35,7 +35,7 @@ func main() {
 	}
 	defer imgWidget.Close()
 
-	termui.Render(imgWidget)
+	termuiimg.Render(imgWidget)
 
 	// BUG: stop termimg from consuming input
 	imgWidget.Close()
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"image"
 	"io"
 	"log/slog"
@@ -23,7 +24,7 @@ import (
 	"github.com/srlehn/termimg/internal/testutil"
 	"github.com/srlehn/termimg/resize/rdefault"
 	"github.com/srlehn/termimg/term"
-	"github.com/srlehn/termimg/video/ffmpeg"
+	"github.com/srlehn/termimg/video"
 )
 
 var (
@@ -37,6 +38,7 @@ var (
 	showCoords         bool
 	showGrid           bool
 	showFPS            uint
+	showStats          bool
 	showResizerCaire   = func() term.Resizer { return nil }
 )
 
@@ -47,6 +49,7 @@ func init() {
 	showCmd.Flags().StringVarP(&showURL, `url`, `u`, ``, `image url`)
 	showCmd.Flags().StringVarP(&showFile, `file`, `f`, ``, `image path`)
 	showCmd.Flags().UintVarP(&showFPS, `fps`, `v`, 15, `fps`)
+	showCmd.Flags().BoolVar(&showStats, `stats`, false, `show frame statistics below videos`)
 	rootCmd.AddCommand(showCmd)
 }
 
@@ -58,7 +61,14 @@ var showCmd = &cobra.Command{
 ` + showUsageStr + `
 
 Image position is given in cell coordinates.
-If width or height is missing the image will be scaled while preserving its aspect ratio.`,
+If width or height is missing the image will be scaled while preserving its aspect ratio.
+Videos are played without audio.
+
+Video controls:
+  space, p      pause/continue
+  left, right   seek 5s backward/forward
+  down, up      decrease/increase speed
+  q, esc        quit`,
 	// Args: cobra.MaximumNArgs(1),
 	TraverseChildren: true,
 	Run:              cmdRunFunc(showFunc),
@@ -204,13 +214,23 @@ func showFunc(cmd *cobra.Command, args []string) terminalSwapper {
 			}
 			tm2.WriteString(queries.DECTCEMHide)
 			tm2.OnClose(func() error { _, err := tm2.WriteString(queries.DECTCEMShow); return err })
-			sizePixels := canvas.Bounds().Max.Sub(canvas.Bounds().Min)
-			ctx := context.Background()
-			vid, err := ffmpeg.StreamFrames(ctx, showImageLocalPath, sizePixels, int(showFPS))
+			// audio output and with it A/V sync are out of scope for timg, it doesn't link an audio backend.
+			// Programs passing an audio player (e.g. speaker.Play of gopxl/beep) get frames paced by the samples.
+			player, err := video.NewMediaPlayer(canvas, showImageLocalPath, int(showFPS), 0, nil)
 			if logx.IsErr(err, tm2, slog.LevelError) {
 				return err
 			}
-			err = canvas.Video(ctx, vid, time.Duration(1000/showFPS)*time.Millisecond)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go videoControls(ctx, tm2, player, cancel)
+			if showStats {
+				canvas.SetVideoFrameHook(videoStatsHook(tm2, bounds))
+			}
+			err = player.Play(ctx)
+			cancel() // stops the controls
+			if showStats {
+				writeVideoStats(tm2, canvas.Stats(), bounds)
+			}
 			if logx.IsErr(err, tm2, slog.LevelError) {
 				return err
 			}
@@ -226,6 +246,91 @@ func showFunc(cmd *cobra.Command, args []string) terminalSwapper {
 	}
 }
 
+// videoControls controls the player with the keys read from the terminal until ctx is done,
+// quitting cancels the video. The tty is in raw mode, ctrl-c arrives as "\x03" instead of SIGINT.
+// A read still waiting for input when ctx is done fails when the terminal is closed.
+func videoControls(ctx context.Context, tm *term.Terminal, player *video.MediaPlayer, cancel context.CancelFunc) {
+	const seekStep = 5 * time.Second
+	input := make(chan string)
+	go func() {
+		defer close(input)
+		buf := make([]byte, 64)
+		for {
+			n, err := tm.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case input <- string(buf[:n]):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for {
+		var keys string
+		select {
+		case <-ctx.Done():
+			return
+		case in, ok := <-input:
+			if !ok {
+				return
+			}
+			keys = in
+		}
+		for len(keys) > 0 {
+			var key string
+			if strings.HasPrefix(keys, "\033[") && len(keys) >= 3 {
+				key, keys = keys[:3], keys[3:]
+			} else {
+				key, keys = keys[:1], keys[1:]
+			}
+			switch key {
+			case ` `, `p`:
+				if player.Paused() {
+					_ = player.Continue()
+				} else {
+					_ = player.Pause()
+				}
+			case "\033[D", `h`:
+				_ = player.SeekBy(-seekStep)
+			case "\033[C", `l`:
+				_ = player.SeekBy(seekStep)
+			case "\033[A", `+`:
+				_ = player.SetSpeed(player.Speed() * 1.25)
+			case "\033[B", `-`:
+				_ = player.SetSpeed(player.Speed() / 1.25)
+			case `q`, "\033", "\x03":
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// videoStatsHook returns a frame hook of the canvas writing the statistics of the video
+// every half second. It runs between the frames, the line isn't written into their sequences.
+func videoStatsHook(tm *term.Terminal, bounds image.Rectangle) func(term.VideoStats) {
+	var last time.Time
+	return func(stats term.VideoStats) {
+		if time.Since(last) < 500*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		writeVideoStats(tm, stats, bounds)
+	}
+}
+
+// writeVideoStats writes the statistics in the row below the video,
+// or in the last row of the screen if the video reaches it.
+func writeVideoStats(tm *term.Terminal, stats term.VideoStats, bounds image.Rectangle) {
+	row := bounds.Max.Y
+	if _, rows, err := tm.SizeInCells(); err == nil && rows > 0 {
+		row = min(row, int(rows)-1)
+	}
+	_, _ = tm.WriteString(fmt.Sprintf("\0337\033[%d;%dH%s\033[K\0338", row+1, bounds.Min.X+1, stats))
+}
+
 func isVolatileDrawer(tm *term.Terminal, dr term.Drawer) bool {
 	if tm == nil {
 		return false
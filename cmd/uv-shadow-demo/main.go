@@ -1,10 +1,7 @@
-//go:build dev
-
 package main
 
 import (
 	"fmt"
-	"image"
 	_ "image/png"
 	"log"
 	"os"
@@ -20,18 +17,19 @@ import (
 	"github.com/srlehn/termimg/term"
 	_ "github.com/srlehn/termimg/terminals"
 	"github.com/srlehn/termimg/tty/uvtty"
+	"github.com/srlehn/termimg/tui/uvimg"
 )
 
 func main() {
-	// Get drawer type from command line argument
-	drawerType := "sixel" // default
-	if len(os.Args) > 1 {
-		drawerType = os.Args[1]
-	}
 	if len(os.Args) < 2 || (os.Args[1] != `sixel` && os.Args[1] != `x11`) {
 		fmt.Fprintf(os.Stderr, "Usage: %s <sixel|x11>\n", filepath.Base(os.Args[0]))
 		os.Exit(1)
 	}
+	drawerType := os.Args[1]
+	drawer := term.GetRegDrawerByName(drawerType)
+	if drawer == nil {
+		log.Fatalf("%s drawer not available", drawerType)
+	}
 
 	imageArea := uv.Rect(5, 3, 15, 7)
 	shadowArea := uv.Rect(imageArea.Min.X+3, imageArea.Min.Y+2, 8, 7)
@@ -41,6 +39,7 @@ func main() {
 		termimg.DefaultConfig,
 		// reuse input! this opens and manages a uv.Terminal internally
 		term.SetTTYProvider(uvtty.New, false),
+		term.SetDrawers([]term.Drawer{drawer}),
 		term.SetLogFile("./termimg-uv-debug.log", true),
 	)
 	if err != nil {
@@ -50,68 +49,43 @@ func main() {
 
 	// extract managed ultraviolet Terminal
 	tmu := tmg.TTY().(*uvtty.TTYUV).UVTerminal()
-
-	// Create termimg drawable that will use specified drawer to draw directly to the terminal window
-	termimgDrawable := &TermimgDrawable{
-		timg:       termimg.NewImageBytes(assets.SnakePic),
-		tmg:        tmg,
-		bounds:     imageArea,
-		drawerType: drawerType,
+	w, h, err := tmu.GetSize()
+	if err != nil {
+		log.Fatalf("Failed to get the terminal size: %v", err)
 	}
-	// Create UV text box drawable that should shadow the corner of the image
-	var textBoxDrawable TextBoxDrawable = '#'
+	scr := tmu.Screen()
+	scr.Resize(w, h)
+	scr.EnterAltScreen()
+	defer scr.ExitAltScreen()
 
-	// clean screen
-	_ = tmg.Scroll(0)
-	tmu.Clear()
-	tmu.MoveTo(0, 0)
-	_ = tmu.Display()
-
-	// Draw the termimg image first (using X11/sixel directly on the terminal window)
-	termimgDrawable.Draw(tmu, imageArea)
-	time.Sleep(1 * time.Second)
-
-	// Draw the UV text box that should shadow part of the image
-	textBoxDrawable.Draw(tmu, shadowArea)
-	_ = tmu.Display() // Display the result
-	time.Sleep(3 * time.Second)
-
-	fmt.Println("\r\n\ndrawer:", drawerType)
-}
-
-// TermimgDrawable wraps a termimg image as a UV drawable
-type TermimgDrawable struct {
-	timg       *term.Image
-	bounds     image.Rectangle
-	tmg        *term.Terminal
-	drawerType string
-}
-
-// Draw implements the UV Drawable interface
-func (td *TermimgDrawable) Draw(scr uv.Screen, area uv.Rectangle) {
-	// Find the specified drawer type
-	var drawer term.Drawer
-	for _, dr := range td.tmg.Drawers() {
-		if dr.Name() == td.drawerType {
-			drawer = dr
-			break
-		}
+	img, err := uvimg.NewImage(tmg, termimg.NewImageBytes(assets.SnakePic))
+	if err != nil {
+		log.Fatalf("Failed to create the image: %v", err)
 	}
-	if drawer == nil {
-		log.Fatalf("%s drawer not available", td.drawerType)
+	defer img.Close()
+	// UV text box that should shadow the corner of the image
+	var textBox TextBoxDrawable = '#'
+
+	// the image first
+	frame := uv.DrawableFunc(func(scr uv.Screen, area uv.Rectangle) {
+		img.Draw(scr, imageArea)
+	})
+	if err := uvimg.Display(tmg, frame); err != nil {
+		log.Fatalf("Failed to display the image: %v", err)
 	}
+	time.Sleep(1 * time.Second)
 
-	// Draw the image using termimg's X11/sixel functionality
-	if err := drawer.Draw(td.timg, td.bounds, td.tmg); err != nil {
-		log.Fatalf("Failed to draw image: %v", err)
+	// the text box over a corner of the image
+	frame = uv.DrawableFunc(func(scr uv.Screen, area uv.Rectangle) {
+		img.Draw(scr, imageArea)
+		textBox.Draw(scr, shadowArea)
+	})
+	if err := uvimg.Display(tmg, frame); err != nil {
+		log.Fatalf("Failed to display the text box: %v", err)
 	}
+	time.Sleep(3 * time.Second)
 
-	_ = td.tmg.SetCursor(0, 0)
-	/*
-		tmu := td.tmg.TTY().(*uvtty.TTYUV).UVTerminal()
-		tmu.MoveTo(0, 0)
-		tmu.Display()
-	*/
+	fmt.Println("\r\n\ndrawer:", drawerType)
 }
 
 // TextBoxDrawable creates a simple text box filled with a character
@@ -14,7 +14,6 @@ import (
 	"github.com/srlehn/termimg/internal/consts"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
-	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/term"
 )
 
@@ -101,7 +100,7 @@ func (d *drawerDomTerm) inbandString(timg *term.Image, bounds image.Rectangle, t
 	}
 	attrs += `class='` + consts.LibraryName + `' `
 	attrs += fmt.Sprintf(`width='%d' height='%d'`, timg.Cropped.Bounds().Dx(), timg.Cropped.Bounds().Dy())
-	domTermString = mux.Wrap(fmt.Sprintf("\033]72;<img %s src='data:%s;base64,%s\n'/>\a", attrs, mimeType, imgBase64), tm)
+	domTermString = fmt.Sprintf("\033]72;<img %s src='data:%s;base64,%s\n'/>\a", attrs, mimeType, imgBase64)
 	domTermString = fmt.Sprintf("\033[%d;%dH%s%s", bounds.Min.Y, bounds.Min.X, ` `, domTermString) // TODO
 	timg.SetInband(bounds, domTermString, d, tm)
 
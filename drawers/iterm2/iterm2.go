@@ -16,7 +16,6 @@ import (
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/internal/propkeys"
-	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/term"
 )
 
@@ -201,17 +200,14 @@ func (d *drawerITerm2) Prepare(ctx context.Context, img image.Image, bounds imag
 		// https://wezfurlong.org/wezterm/imgcat.html
 		keepPosWezTerm = `;doNotMoveCursor=1`
 	}
-	iterm2String := mux.Wrap( // TODO check if wrap is necessary
-		fmt.Sprintf(
-			"\033]1337;File=name=%s;inline=1;width=%d;height=%d;size=%d;preserveAspectRatio=%d%s:%s\a",
-			nameBase64,
-			bounds.Dx(), bounds.Dy(),
-			imgSize,
-			preserveAspectRatio,
-			keepPosWezTerm,
-			imgBase64,
-		),
-		tm,
+	iterm2String := fmt.Sprintf(
+		"\033]1337;File=name=%s;inline=1;width=%d;height=%d;size=%d;preserveAspectRatio=%d%s:%s\a",
+		nameBase64,
+		bounds.Dx(), bounds.Dy(),
+		imgSize,
+		preserveAspectRatio,
+		keepPosWezTerm,
+		imgBase64,
 	)
 	// for width, height:   "auto"   ||   N: N character cells   ||   Npx: N pixels   ||   N%: N percent of terminal width/height
 	iterm2String = fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1, bounds.Min.X+1, iterm2String)
@@ -8,15 +8,17 @@ import (
 	"image"
 	"image/png"
 	"log/slog"
+	"math/rand/v2"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/srlehn/termimg/internal/consts"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/internal/parser"
+	"github.com/srlehn/termimg/internal/propkeys"
 	"github.com/srlehn/termimg/internal/queries"
-	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/term"
 )
 
@@ -27,7 +29,43 @@ var _ term.Drawer = (*drawerKitty)(nil)
 const kittyLimit = 4096
 
 type drawerKitty struct {
-	// imageCount int // TODO: for numbering of ids
+	mu     sync.Mutex
+	lastID uint32
+	shown  map[image.Rectangle]kittyImage // image drawn last into the cells
+}
+
+// kittyImage is an image transmitted to the terminal.
+type kittyImage struct {
+	id   uint32
+	size image.Point // pixels
+}
+
+// newID returns an image id for the next transmission.
+// The ids start at a random number, other programs might have placed images.
+func (d *drawerKitty) newID() uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastID == 0 {
+		d.lastID = rand.Uint32N(1 << 24)
+	}
+	d.lastID++
+	if d.lastID == 0 {
+		d.lastID++
+	}
+	return d.lastID
+}
+
+// replaced records id as the image drawn into the cells of bounds
+// and returns the id of the image drawn there before.
+func (d *drawerKitty) replaced(bounds image.Rectangle, img kittyImage) (prev uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.shown == nil {
+		d.shown = make(map[image.Rectangle]kittyImage)
+	}
+	prev = d.shown[bounds].id
+	d.shown[bounds] = img
+	return prev
 }
 
 func (d *drawerKitty) Name() string     { return `kitty` }
@@ -41,6 +79,10 @@ func (d *drawerKitty) IsApplicable(inp term.DrawerCheckerInput) (bool, term.Prop
 	// https://sw.kovidgoyal.net/kitty/graphics-protocol/#querying-support-and-available-transmission-mediums
 	// example: <ESC>_Gi=31,s=1,v=1,a=q,t=d,f=24;AAAA<ESC>\<ESC>[c
 
+	if allow, _ := inp.Property(propkeys.MuxAllowPassthrough); allow == `off` {
+		return false, nil // dropped by tmux
+	}
+
 	switch inp.Name() {
 	case `kitty`:
 		// `wayst`: // untested
@@ -55,11 +97,17 @@ func (d *drawerKitty) IsApplicable(inp term.DrawerCheckerInput) (bool, term.Prop
 	}
 
 	// TODO disable on Terminology
-	repl, err := term.CachedQuery(inp, queries.KittyTest+queries.DA1, inp, parser.NewParser(false, true), inp, inp)
-	ret := err == nil &&
-		(len(strings.SplitN(repl, queries.ST, 2)) == 2 ||
-			len(strings.SplitN(repl, "\a", 2)) == 2)
-	return ret, nil
+	repl, err := term.CachedQuery(inp, queries.KittyTest+queries.DA1, inp, parser.NewDA1SentinelParser(), inp, inp)
+	if err != nil {
+		return false, nil
+	}
+	for _, seq := range term.Tokenize(repl) {
+		// reply: APC G i=31;OK ST
+		if seq.Type == term.SeqAPC && strings.HasPrefix(seq.Payload, `G`) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 func (d *drawerKitty) Draw(img image.Image, bounds image.Rectangle, tm *term.Terminal) error {
@@ -101,9 +149,23 @@ func (d *drawerKitty) Prepare(ctx context.Context, img image.Image, bounds image
 		return nil, errors.New("could not query terminal dimensions")
 	}
 
+	// pane relative bounds inside of terminal multiplexers
+	outer, visible, err := tm.OuterBounds(bounds)
+	if logx.IsErr(err, tm, slog.LevelInfo) {
+		outer, visible = bounds, bounds
+	}
+	if visible.Empty() {
+		return func() error { return nil }, nil
+	}
+	translated := outer != bounds
+	img, err = term.ClipImageToCells(img, bounds, visible)
+	if err != nil {
+		return nil, err
+	}
+
 	var imgHeight uint
-	if bounds.Max.Y < int(tch) {
-		imgHeight = uint(bounds.Dy())
+	if visible.Max.Y < int(tch) {
+		imgHeight = uint(visible.Dy())
 	} else {
 		imgHeight = tch - 1
 	}
@@ -122,31 +184,113 @@ func (d *drawerKitty) Prepare(ctx context.Context, img image.Image, bounds image
 	// t=d           payload is (base64 encoded) data itself not a file location
 	// f=100         format: 100 = PNG payload
 	// o=z           data compression
-	// X=...,Y=,,,   Upper left image corner in cell coordinates (starting with 1, 1)
+	// X=...,Y=...   pixel offset within the cell at the cursor, the image is positioned with the cursor
 	// c=...,r=...   image size in cell columns and rows
 	// w=...,h=...   width & height (in pixels) of the image area to display   // TODO: Use this to let Kitty handle cropping!
 	// z=0           z-index vertical stacking order of the image
 	// m=[01]        0 last escape code chunk - 1 for all except the last
+	// i=...         image id, regions of the image are replaced by DrawRegion
+	// q=2           suppress the replies to commands with an image id
 	var kittyString string
 	var zIndex = 2 // draw over text
-	settings := fmt.Sprintf("a=T,t=d,f=100,X=%d,Y=%d,c=%d,r=%d,z=%d,", bounds.Min.X+1, bounds.Min.Y+1, bounds.Dx(), imgHeight, zIndex)
+	shown := kittyImage{id: d.newID(), size: img.Bounds().Size()}
+	settings := fmt.Sprintf("a=T,t=d,f=100,i=%d,q=2,c=%d,r=%d,z=%d,", shown.id, outer.Dx(), imgHeight, zIndex)
 	i := 0
 	for ; i < (lenImgB64-1)/kittyLimit; i++ {
-		// kittyString += mux.Wrap(fmt.Sprintf("\033_G%sm=1;%s\033\\", settings, imgBase64[i*kittyLimit:(i+1)*kittyLimit]), tm)
-		kittyString += mux.Wrap(fmt.Sprintf("\033_G%sC=1,m=1;%s\033\\", settings, imgBase64[i*kittyLimit:(i+1)*kittyLimit]), tm)
+		// kittyString += fmt.Sprintf("\033_G%sm=1;%s\033\\", settings, imgBase64[i*kittyLimit:(i+1)*kittyLimit])
+		kittyString += fmt.Sprintf("\033_G%sC=1,m=1;%s\033\\", settings, imgBase64[i*kittyLimit:(i+1)*kittyLimit])
 		settings = ""
 	}
-	// kittyString += mux.Wrap(fmt.Sprintf("\033_G%sm=0;%s\033\\", settings, imgBase64[i*kittyLimit:lenImgB64]), tm)
-	kittyString += mux.Wrap(fmt.Sprintf("\033_G%sC=1,m=0;%s\033\\", settings, imgBase64[i*kittyLimit:lenImgB64]), tm)
-	kittyString = fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1, bounds.Min.X+1, kittyString)
-
-	timg.SetInband(bounds, kittyString, d, tm)
+	// kittyString += fmt.Sprintf("\033_G%sm=0;%s\033\\", settings, imgBase64[i*kittyLimit:lenImgB64])
+	kittyString += fmt.Sprintf("\033_G%sC=1,m=0;%s\033\\", settings, imgBase64[i*kittyLimit:lenImgB64])
+	var posOuter string
+	if translated {
+		// the multiplexer would position the cursor relative to the pane
+		posOuter = fmt.Sprintf("\033[%d;%dH", outer.Min.Y+1, outer.Min.X+1)
+	} else {
+		kittyString = fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1, bounds.Min.X+1, kittyString)
+		timg.SetInband(bounds, kittyString, d, tm)
+	}
 
 	logx.Debug(`image preparation`, tm, `drawer`, d.Name(), `duration`, time.Since(start))
 
 	drawFn = func() error {
-		_, err := tm.Printf(`%s`, kittyString)
-		return logx.Err(err, tm, slog.LevelInfo)
+		if len(posOuter) > 0 {
+			if _, err := tm.WritePassthrough(posOuter); err != nil {
+				return logx.Err(err, tm, slog.LevelInfo)
+			}
+		}
+		if _, err := tm.WriteString(kittyString); err != nil {
+			return logx.Err(err, tm, slog.LevelInfo)
+		}
+		// the new image covers the one drawn before into the cells, which is deleted
+		if prev := d.replaced(bounds, shown); prev != 0 && prev != shown.id {
+			_, err := tm.WriteString(fmt.Sprintf("\033_Ga=d,d=I,i=%d,q=2\033\\", prev))
+			return logx.Err(err, tm, slog.LevelInfo)
+		}
+		return nil
 	}
 	return drawFn, nil
 }
+
+// DrawRegion replaces region of the image drawn last into the cells of bounds with the pixels
+// of img by editing the root frame of the image, so that no image is placed over it.
+func (d *drawerKitty) DrawRegion(img image.Image, region, bounds image.Rectangle, tm *term.Terminal) error {
+	if d == nil || tm == nil || img == nil {
+		return errors.New(`nil parameter`)
+	}
+	d.mu.Lock()
+	shown, ok := d.shown[bounds]
+	d.mu.Unlock()
+	if !ok {
+		return errors.New(`no image drawn into the cells`)
+	}
+	if img.Bounds().Size() != shown.size {
+		return errors.New(`image size differs from the drawn image`)
+	}
+	sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	})
+	if !ok {
+		return errors.New(`image can't be cropped`)
+	}
+	region = region.Intersect(img.Bounds())
+	if region.Empty() {
+		return nil
+	}
+	bytBuf := new(bytes.Buffer)
+	if err := png.Encode(bytBuf, sub.SubImage(region)); err != nil {
+		return err
+	}
+	imgBase64 := base64.StdEncoding.EncodeToString(bytBuf.Bytes())
+	// a=f           edit the frame r (1: root frame) of image i
+	// x=...,y=...   upper left corner of the region in pixels
+	// X=1           replace the pixels instead of blending
+	offset := region.Min.Sub(img.Bounds().Min)
+	settings := fmt.Sprintf("a=f,f=100,i=%d,r=1,x=%d,y=%d,X=1,q=2,", shown.id, offset.X, offset.Y)
+	var kittyString strings.Builder
+	for len(imgBase64) > kittyLimit {
+		fmt.Fprintf(&kittyString, "\033_G%sm=1;%s\033\\", settings, imgBase64[:kittyLimit])
+		imgBase64 = imgBase64[kittyLimit:]
+		settings = ""
+	}
+	fmt.Fprintf(&kittyString, "\033_G%sm=0;%s\033\\", settings, imgBase64)
+	_, err := tm.WriteString(kittyString.String())
+	return logx.Err(err, tm, slog.LevelInfo)
+}
+
+// FlushAction reports that the images are placed over the cells and have to be cleared.
+func (d *drawerKitty) FlushAction() term.FlushAction { return term.FlushClear }
+
+// ClearPlacements deletes all visible image placements and frees their images.
+func (d *drawerKitty) ClearPlacements(tm *term.Terminal) error {
+	if tm == nil {
+		return errors.New(`nil parameter`)
+	}
+	// the images are freed, regions of them can't be replaced anymore
+	d.mu.Lock()
+	clear(d.shown)
+	d.mu.Unlock()
+	_, err := tm.WriteString("\033_Ga=d,d=A\033\\")
+	return err
+}
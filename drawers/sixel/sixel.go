@@ -7,7 +7,6 @@ import (
 	"image"
 	"log/slog"
 	"slices"
-	"strings"
 	"time"
 
 	sixel "github.com/mattn/go-sixel"
@@ -43,6 +42,9 @@ func (d *drawerSixel) IsApplicable(inp term.DrawerCheckerInput) (bool, term.Prop
 	if !isSixelCapable || sixelCapable != `true` {
 		return false, nil
 	}
+	if allow, _ := inp.Property(propkeys.MuxAllowPassthrough); allow == `off` {
+		return false, nil // dropped by tmux
+	}
 
 	if slices.Contains([]string{
 		`domterm`,
@@ -53,20 +55,18 @@ func (d *drawerSixel) IsApplicable(inp term.DrawerCheckerInput) (bool, term.Prop
 		return false, nil // skip buggy implementations
 	}
 
-	repl, err := term.CachedQuery(inp, mux.Wrap(queries.DA1, inp), inp, parser.StopOnAlpha, inp, nil)
+	// the multiplexer answers DA1 itself, ask the outer terminal
+	repl, err := term.CachedQuery(inp, mux.Wrap(queries.DA1, inp), inp, parser.NewDA1SentinelParser(), inp, nil)
 	// TODO fix mintty - querying in general on windows?
 	if err != nil {
 		return false, nil
 	}
-	if len(repl) == 0 || repl[len(repl)-1] != 'c' {
-		return false, nil
-	}
-	repl = repl[:len(repl)-1]
-	termCapabilities := strings.Split(repl, `;`)[1:]
-	for _, cap := range termCapabilities {
-		if cap == `4` {
-			return true, nil
+	for _, seq := range term.Tokenize(repl) {
+		da1, err := term.ParseDA1(seq)
+		if err != nil {
+			continue
 		}
+		return slices.Contains(da1.Attributes, `4`), nil
 	}
 	return false, nil
 }
@@ -100,7 +100,16 @@ func (d *drawerSixel) Prepare(ctx context.Context, img image.Image, bounds image
 		return nil, err
 	}
 
-	sixelString, err := d.inbandString(timg, bounds, tm)
+	// pane relative bounds inside of terminal multiplexers
+	outer, visible, err := tm.OuterBounds(bounds)
+	if logx.IsErr(err, tm, slog.LevelInfo) {
+		outer, visible = bounds, bounds
+	}
+	if visible.Empty() {
+		return func() error { return nil }, nil
+	}
+
+	sixelString, err := d.inbandString(timg, bounds, outer, visible, tm)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +117,12 @@ func (d *drawerSixel) Prepare(ctx context.Context, img image.Image, bounds image
 	logx.Debug(`image preparation`, tm, `drawer`, d.Name(), `duration`, time.Since(start))
 
 	drawFn = func() error {
+		if outer != bounds {
+			// the multiplexer would position the cursor relative to the pane,
+			// pass the outer position through together with the image
+			_, err := tm.WritePassthrough(sixelString)
+			return logx.Err(err, tm, slog.LevelInfo)
+		}
 		_, err := tm.WriteString(sixelString)
 		return logx.Err(err, tm, slog.LevelInfo)
 	}
@@ -115,13 +130,16 @@ func (d *drawerSixel) Prepare(ctx context.Context, img image.Image, bounds image
 	return drawFn, nil
 }
 
-func (d *drawerSixel) inbandString(timg *term.Image, bounds image.Rectangle, term *term.Terminal) (string, error) {
+func (d *drawerSixel) inbandString(timg *term.Image, bounds, outer, visible image.Rectangle, tm *term.Terminal) (string, error) {
 	if timg == nil {
 		return ``, errors.New(consts.ErrNilImage)
 	}
-	sixelString, err := timg.Inband(bounds, d, term)
-	if err == nil {
-		return sixelString, nil
+	translated := outer != bounds
+	if !translated {
+		sixelString, err := timg.Inband(bounds, d, tm)
+		if err == nil {
+			return sixelString, nil
+		}
 	}
 	if err := timg.Decode(); err != nil {
 		return ``, err
@@ -129,28 +147,33 @@ func (d *drawerSixel) inbandString(timg *term.Image, bounds image.Rectangle, ter
 	if timg.Cropped == nil {
 		timg.Cropped = timg.Original
 	}
+	imgVisible, err := term.ClipImageToCells(timg.Cropped, bounds, visible)
+	if err != nil {
+		return ``, err
+	}
 
 	// sixel
 	// https://vt100.net/docs/vt3xx-gp/chapter14.html
 	byteBuf := new(bytes.Buffer)
 	enc := sixel.NewEncoder(byteBuf)
 	enc.Dither = true
-	if err := enc.Encode(timg.Cropped); err != nil {
+	if err := enc.Encode(imgVisible); err != nil {
 		return ``, err
 	}
-	sixelString = mux.Wrap("\033[?8452h"+byteBuf.String(), term)
 	// position where the image should appear (upper left corner) + sixel
 	// https://github.com/mintty/mintty/wiki/CtrlSeqs#sixel-graphics-end-position
 	// "\033[?8452h" sets the cursor next right to the bottom of the image instead of below
 	// this prevents vertical scrolling when the image fills the last line.
 	// horizontal scrolling because of this did not happen in my test cases.
 	// "\033[?80l" disables sixel scrolling if it isn't already.
-	//img.inband[term.Name()] = fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1, bounds.Min.X+1, sixelString)
-	sixelString = fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1, bounds.Min.X+1, sixelString)
-	// timg.SetInband(bounds, sixelString, d, term) // TODO uncomment
 	// test string "HI"
 	// wdgt.Block.ANSIString = fmt.Sprintf("\033[%d;%dH\033[?8452h%s", wdgt.Inner.Min.Y+1, wdgt.Inner.Min.X+1, "\033Pq#0;2;0;0;0#1;2;100;100;0#2;2;0;100;0#1~~@@vv@@~~@@~~$#2??}}GG}}??}}??-#1!14@\033\\")
-	timg.SetInband(bounds, sixelString, d, term)
+	if translated {
+		// position in outer terminal cells, written as a whole with Terminal.WritePassthrough
+		return fmt.Sprintf("\033[%d;%dH\033[?8452h%s", outer.Min.Y+1, outer.Min.X+1, byteBuf.String()), nil
+	}
+	sixelString := fmt.Sprintf("\033[%d;%dH\033[?8452h%s", bounds.Min.Y+1, bounds.Min.X+1, byteBuf.String())
+	timg.SetInband(bounds, sixelString, d, tm)
 
 	return sixelString, nil
 }
@@ -12,7 +12,6 @@ import (
 	"github.com/srlehn/termimg/internal/encoder/encpng"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
-	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/term"
 )
 
@@ -107,18 +106,16 @@ func (d *drawerTerminology) inbandString(timg *term.Image, bounds image.Rectangl
 		3*2 + // width, height
 			len(timg.FileName)*2 +
 			9 + // length of fixed parts of initial string
-			11 + // mux.Wrap() - for 1x tmux
 			int(h)*( // area string
 			int(w)+
-				11+ // length of fixed parts
-				11) + // mux.Wrap() - for 1x tmux
+				11) + // length of fixed parts
 			20, // some buffer
 	)
-	_, err = b.WriteString(mux.Wrap(fmt.Sprintf("\033}is"+replaceChar+"%d;%d;%s%s\000", w, h, hyperlink, timg.FileName), term))
+	_, err = b.WriteString(fmt.Sprintf("\033}is"+replaceChar+"%d;%d;%s%s\000", w, h, hyperlink, timg.FileName))
 	if err != nil {
 		return ``, errors.New(err)
 	}
-	lineArea := mux.Wrap("\033}ib\000"+strings.Repeat(replaceChar, int(w))+"\033}ie\000\n", term)
+	lineArea := "\033}ib\000" + strings.Repeat(replaceChar, int(w)) + "\033}ie\000\n"
 	for y := 0; y < int(h); y++ {
 		_, err = b.WriteString(fmt.Sprintf("\033[%d;%dH%s", bounds.Min.Y+1+y, bounds.Min.X+1, lineArea))
 		if err != nil {
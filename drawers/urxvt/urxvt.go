@@ -13,7 +13,6 @@ import (
 	"github.com/srlehn/termimg/internal/encoder/encpng"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
-	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/term"
 )
 
@@ -127,16 +126,19 @@ func (d *drawerURXVT) inbandString(timg *term.Image, bounds image.Rectangle, tm
 	CenterPosXPercentage := 100 * (uint(bounds.Min.X)) / (tcw - uint(bounds.Dx()))
 	CenterPosYPercentage := 100 * (uint(bounds.Min.Y)) / (tch - uint(bounds.Dy()))
 
-	// urxvtString = mux.Wrap(fmt.Sprintf("\033]20;%s;%dx%d+%d+%d:op=keep-aspect\a", fileName, widthPercentage, heightPercentage, CenterPosXPercentage, CenterPosYPercentage), term)
-	urxvtString = cleanCanvasStr + mux.Wrap(fmt.Sprintf("\033]20;%s;%dx%d+%d+%d\a", fileName, widthPercentage, heightPercentage, CenterPosXPercentage, CenterPosYPercentage), tm)
+	// urxvtString = fmt.Sprintf("\033]20;%s;%dx%d+%d+%d:op=keep-aspect\a", fileName, widthPercentage, heightPercentage, CenterPosXPercentage, CenterPosYPercentage)
+	urxvtString = cleanCanvasStr + fmt.Sprintf("\033]20;%s;%dx%d+%d+%d\a", fileName, widthPercentage, heightPercentage, CenterPosXPercentage, CenterPosYPercentage)
 	timg.SetInband(bounds, urxvtString, d, tm)
 
 	return urxvtString, nil
 }
 
+// FlushAction reports that the images are placed over the cells and have to be cleared.
+func (d *drawerURXVT) FlushAction() term.FlushAction { return term.FlushClear }
+
 func (d *drawerURXVT) Clear(term *term.Terminal) error {
 	// TODO doesn't clear but upscales to terminal size
-	clearStr := mux.Wrap("\033]20;;100x100+1000+1000\a", term)
+	clearStr := "\033]20;;100x100+1000+1000\a"
 	_, err := term.WriteString(clearStr)
 	return err
 }
@@ -22,7 +22,8 @@ func GetEnv(ptyName string) (envInner environ.Properties, passages mux.Muxers, e
 	// 1.) find process providing tty
 	// 2.) walk process tree until terminal, note muxers, etc
 	// 3.) diff provided env from inherited env
-	var proc, procTerm *process.Process
+	var proc *process.Process
+	var procTerm mux.Process
 	var ttyInner string
 	var errRet, err error
 
@@ -134,7 +135,7 @@ end:
 		envInner.SetProperty(propkeys.IsRemote, ``)
 	}
 	if procTerm != nil {
-		envInner.SetProperty(propkeys.TerminalPID, strconv.Itoa(int(procTerm.Pid)))
+		envInner.SetProperty(propkeys.TerminalPID, strconv.Itoa(int(procTerm.PID())))
 	}
 	if len(ttyInner) > 0 {
 		if runtime.GOOS != `windows` {
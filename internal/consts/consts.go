@@ -11,6 +11,7 @@ var (
 	ErrNilImage                = errors.New(`nil image`)
 	ErrPlatformNotSupported    = errors.New(`platform not supported`)
 	ErrTimeoutInterval         = errors.New(`terminal querying timeout (interval)`)
+	ErrQueryUnsupported        = errors.New(`query not supported by terminal`)
 	ErrXTGetTCapInvalidRequest = errors.New(`invalid XTGETTCAP request`)
 )
 
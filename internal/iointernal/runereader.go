@@ -41,7 +41,11 @@ func (r *runeReader) ReadRune() (rn rune, size int, err error) {
 		return rn, len(string(rn)), errors.NilReceiver()
 	}
 	if r.readRuneFunc != nil {
-		return r.readRuneFunc()
+		rn, size, err = r.readRuneFunc()
+		if rn == utf8.RuneError && size == 1 && err == nil {
+			return r.c1(rn, size)
+		}
+		return rn, size, err
 	}
 	if r.reader == nil {
 		return rn, len(string(rn)), errors.New(`nil tty`)
@@ -62,6 +66,11 @@ func (r *runeReader) ReadRune() (rn rune, size int, err error) {
 			}
 			rb[i] = b[0]
 		}
+		if i == 0 && rb[0] >= 0x80 && rb[0] <= 0x9F {
+			// 8-bit C1 control (e.g. 0x9B CSI), can't start a UTF-8 sequence
+			r.buf = nil
+			return rune(rb[0]), 1, nil
+		}
 		if utf8.Valid(rb[:i+1]) {
 			rb = rb[:i+1]
 			r.buf = nil
@@ -78,3 +87,23 @@ func (r *runeReader) ReadRune() (rn rune, size int, err error) {
 	}
 	return rn, i + 1, nil
 }
+
+// c1 returns an invalid byte read by the reader's ReadRune as 8-bit C1 control (e.g. 0x9B CSI)
+// if the byte can be read again.
+func (r *runeReader) c1(rn rune, size int) (rune, int, error) {
+	rs, ok := r.reader.(interface {
+		io.RuneScanner
+		io.ByteReader
+	})
+	if !ok || rs.UnreadRune() != nil {
+		return rn, size, nil
+	}
+	b, err := rs.ReadByte()
+	if err != nil {
+		return rn, size, errors.New(err)
+	}
+	if b >= 0x80 && b <= 0x9F {
+		return rune(b), 1, nil
+	}
+	return rn, size, nil
+}
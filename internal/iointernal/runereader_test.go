@@ -1,6 +1,7 @@
 package iointernal_test
 
 import (
+	"errors"
 	"io"
 	"strings"
 	"testing"
@@ -25,3 +26,29 @@ func TestRuneReader(t *testing.T) {
 	}
 	assert.Equal(t, s, repl)
 }
+
+func TestRuneReaderC1(t *testing.T) {
+	// 8-bit CSI reply to DA1 followed by UTF-8
+	const s = "\x9b?62;4cä"
+	readers := map[string]io.Reader{
+		`reader`:      struct{ io.Reader }{strings.NewReader(s)},
+		`rune reader`: strings.NewReader(s),
+	}
+	for name, rd := range readers {
+		t.Run(name, func(t *testing.T) {
+			rdr := iointernal.NewRuneReader(rd)
+			var repl []rune
+			for {
+				r, _, err := rdr.ReadRune()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				repl = append(repl, r)
+			}
+			assert.Equal(t, []rune("\u009b?62;4cä"), repl)
+		})
+	}
+}
@@ -43,6 +43,15 @@ func DA1Wrap(p Parser) Parser {
 	})
 }
 
+// NewDA1SentinelParser returns a Parser that stops at the reply to a DA1 query
+// (CSI ? Ps c). Replies to other queries sent before the DA1 "sentinel" are passed over.
+func NewDA1SentinelParser() Parser {
+	return NewSequenceParser(IsDA1Reply, 1)
+}
+
+// IsDA1Reply reports whether the sequence is a reply to a DA1 query (CSI ? Ps c).
+func IsDA1Reply(seq Sequence) bool { return seq.Is(SeqCSI, '?', ``, 'c') }
+
 func NParser(p Parser, n uint) Parser {
 	var seqCnt uint
 	return ParserFunc(func(r rune) bool {
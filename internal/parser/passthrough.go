@@ -0,0 +1,73 @@
+package parser
+
+// tmuxPassthroughPrefix introduces a sequence wrapped for tmux, ESCs inside are doubled.
+const tmuxPassthroughPrefix = "\033Ptmux;"
+
+// PassthroughUnwrapper removes the tmux passthrough framing ("\033Ptmux;" ... ST)
+// from a stream and undoubles the ESCs of the wrapped content.
+// Runes are fed one by one, runes outside of the framing are passed unchanged.
+// Only ASCII runes are interpreted, so bytes converted to runes can be fed too.
+type PassthroughUnwrapper struct {
+	matched int  // matched runes of the prefix, held back
+	inFrame bool // inside of the framing
+	esc     bool // ESC inside of the framing
+}
+
+// Feed appends the output for r to dst.
+func (u *PassthroughUnwrapper) Feed(dst []rune, r rune) []rune {
+	if u == nil {
+		return append(dst, r)
+	}
+	if u.inFrame {
+		switch {
+		case u.esc && r == '\\':
+			// ST
+			u.inFrame, u.esc = false, false
+		case u.esc:
+			// ESC ESC is a single ESC of the content, anything else is malformed
+			u.esc = false
+			dst = append(dst, '\033')
+			if r != '\033' {
+				return u.Feed(dst, r)
+			}
+		case r == '\033':
+			u.esc = true
+		default:
+			dst = append(dst, r)
+		}
+		return dst
+	}
+	if r == rune(tmuxPassthroughPrefix[u.matched]) {
+		u.matched++
+		if u.matched == len(tmuxPassthroughPrefix) {
+			u.matched = 0
+			u.inFrame = true
+		}
+		return dst
+	}
+	if u.matched > 0 {
+		dst = u.Flush(dst)
+		return u.Feed(dst, r)
+	}
+	return append(dst, r)
+}
+
+// Flush appends the held back start of a possible framing to dst.
+func (u *PassthroughUnwrapper) Flush(dst []rune) []rune {
+	if u == nil || u.matched == 0 {
+		return dst
+	}
+	for _, r := range tmuxPassthroughPrefix[:u.matched] {
+		dst = append(dst, r)
+	}
+	u.matched = 0
+	return dst
+}
+
+// Holding reports how many runes of a possible framing start are held back.
+func (u *PassthroughUnwrapper) Holding() int {
+	if u == nil {
+		return 0
+	}
+	return u.matched
+}
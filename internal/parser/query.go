@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"strings"
+)
+
+// IsQuery reports whether the terminal answers the sequence written to it.
+func IsQuery(seq Sequence) bool {
+	switch seq.Type {
+	case SeqCSI:
+		switch {
+		case seq.Final == 'c' && len(seq.Intermediates) == 0:
+			// DA1, DA2, DA3
+			return seq.Private == 0 || seq.Private == '>' || seq.Private == '='
+		case seq.Final == 'n' && len(seq.Intermediates) == 0:
+			// DSR, e.g. cursor position
+			return seq.Private == 0 || seq.Private == '?'
+		case seq.Is(SeqCSI, 0, ``, 't'):
+			// XTWINOPS reports
+			params := seq.IntParams(0)
+			return len(params) > 0 && params[0] >= 11 && params[0] <= 21
+		case seq.Final == 'p' && seq.Intermediates == `$`:
+			// DECRQM
+			return true
+		case seq.Is(SeqCSI, '>', ``, 'q'):
+			// XTVERSION
+			return true
+		case seq.Is(SeqCSI, '?', ``, 'u'):
+			// kitty keyboard protocol flags
+			return len(seq.Params) == 0
+		case seq.Is(SeqCSI, '?', ``, 'S'):
+			// XTSMGRAPHICS
+			return true
+		}
+	case SeqDCS:
+		// DECRQSS, XTGETTCAP
+		return seq.Final == 'q' && (seq.Intermediates == `$` || seq.Intermediates == `+`)
+	case SeqOSC:
+		// color queries like "11;?", iTerm2 reports
+		return strings.Contains(seq.Payload, `;?`) || strings.HasPrefix(seq.Payload, `1337;Report`)
+	case SeqAPC:
+		// kitty graphics protocol, replies are suppressed with q=2
+		if ctrl, ok := strings.CutPrefix(seq.Payload, `G`); ok {
+			ctrl, _, _ = strings.Cut(ctrl, `;`)
+			for kv := range strings.SplitSeq(ctrl, `,`) {
+				if kv == `q=2` {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// IsQueryReply reports whether the sequence received from the terminal is a reply
+// to a query. Unlike Sequence.IsReply, key presses, mouse events and pastes are excluded.
+//
+// Cursor position reports are indistinguishable from F3 with modifiers
+// ("\033[1;2R") and are treated as replies.
+func IsQueryReply(seq Sequence) bool {
+	switch seq.Type {
+	case SeqDCS, SeqOSC, SeqSOS, SeqPM, SeqAPC:
+		return true
+	case SeqCSI:
+		switch seq.Final {
+		case 'c':
+			// DA1, DA2
+			return seq.Private == '?' || seq.Private == '>' || seq.Private == '='
+		case 'R':
+			// cursor position
+			return len(seq.Intermediates) == 0 && (seq.Private == '?' || len(seq.ParamList()) == 2)
+		case 'n', 't', 'x':
+			// DSR, XTWINOPS, DECREPTPARM
+			return len(seq.Intermediates) == 0
+		case 'y':
+			// DECRPM
+			return seq.Intermediates == `$`
+		case 'u', 'S':
+			// kitty keyboard protocol flags, XTSMGRAPHICS
+			return seq.Private == '?'
+		}
+	}
+	return false
+}
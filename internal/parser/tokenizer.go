@@ -0,0 +1,384 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SeqType is the type of a token produced by the Tokenizer.
+type SeqType uint8
+
+const (
+	SeqText    SeqType = iota // printable characters, e.g. key presses
+	SeqControl                // C0 control character outside of sequences
+	SeqESC                    // ESC [0x20-0x2F]* [0x30-0x7E]
+	SeqCSI                    // Control Sequence Introducer
+	SeqDCS                    // Device Control String
+	SeqOSC                    // Operating System Command
+	SeqSOS                    // Start of String
+	SeqPM                     // Privacy Message
+	SeqAPC                    // Application Program Command
+)
+
+func (t SeqType) String() string {
+	switch t {
+	case SeqText:
+		return `text`
+	case SeqControl:
+		return `control`
+	case SeqESC:
+		return `ESC`
+	case SeqCSI:
+		return `CSI`
+	case SeqDCS:
+		return `DCS`
+	case SeqOSC:
+		return `OSC`
+	case SeqSOS:
+		return `SOS`
+	case SeqPM:
+		return `PM`
+	case SeqAPC:
+		return `APC`
+	}
+	return `unknown`
+}
+
+// Sequence is a single token of terminal input.
+//
+// CSI and DCS sequences are split into private marker, parameters, intermediates and
+// final character, e.g. "\033P1+r544E=787465726D\033\\" (XTGETTCAP reply):
+// Params: "1", Intermediates: "+", Final: 'r', Payload: "544E=787465726D".
+// OSC, SOS, PM and APC only have a Payload.
+type Sequence struct {
+	Type          SeqType
+	Private       rune   // private parameter marker '<', '=', '>', '?' or 0
+	Params        string // parameter bytes [0x30-0x3F] without the private marker
+	Intermediates string // [0x20-0x2F]
+	Final         rune   // [0x40-0x7E] for CSI and DCS, [0x30-0x7E] for ESC
+	Payload       string // string data of DCS, OSC, SOS, PM, APC without terminator
+	Raw           string // complete sequence as received
+}
+
+// Is reports whether the sequence has the given type, private marker, intermediates and final character.
+func (s Sequence) Is(typ SeqType, private rune, intermediates string, final rune) bool {
+	return s.Type == typ && s.Private == private && s.Intermediates == intermediates && s.Final == final
+}
+
+// ParamList returns the ';' separated parameters.
+func (s Sequence) ParamList() []string {
+	if len(s.Params) == 0 {
+		return nil
+	}
+	return strings.Split(s.Params, `;`)
+}
+
+// IntParams returns the numeric parameters, empty or invalid parameters are returned as def.
+// Sub-parameters (':') are ignored.
+func (s Sequence) IntParams(def int) []int {
+	params := s.ParamList()
+	if len(params) == 0 {
+		return nil
+	}
+	ints := make([]int, 0, len(params))
+	for _, p := range params {
+		p, _, _ = strings.Cut(p, `:`)
+		i, err := strconv.Atoi(p)
+		if err != nil {
+			i = def
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// IsReply reports whether the token can be part of a reply to a query.
+func (s Sequence) IsReply() bool { return s.Type != SeqText && s.Type != SeqControl }
+
+type tokState uint8
+
+const (
+	tokGround tokState = iota
+	tokEsc
+	tokCSI
+	tokDCSHeader
+	tokString
+	tokStringEsc
+)
+
+// Tokenizer is a streaming VT500-style tokenizer for terminal input.
+// Both 7-bit (ESC Fe) and 8-bit C1 introducers (as code points U+0080-U+009F) are recognized,
+// iointernal.RuneReader reads raw C1 bytes as these code points.
+// Strings are terminated by ST (ESC \ or 0x9C) or BEL.
+// The tmux passthrough framing is removed from wrapped sequences.
+type Tokenizer struct {
+	unwrap PassthroughUnwrapper
+	runes  []rune
+	state  tokState
+	seq    Sequence
+	raw    strings.Builder
+	buf    strings.Builder // params or payload
+}
+
+// NewTokenizer ...
+func NewTokenizer() *Tokenizer { return &Tokenizer{} }
+
+// Tokenize splits s into tokens. An incomplete sequence at the end is dropped.
+func Tokenize(s string) []Sequence {
+	var seqs []Sequence
+	t := NewTokenizer()
+	for _, r := range s {
+		seqs = append(seqs, t.Feed(r)...)
+	}
+	return seqs
+}
+
+// Feed processes a single rune and returns the tokens completed by it.
+func (t *Tokenizer) Feed(r rune) []Sequence {
+	if t == nil {
+		return nil
+	}
+	t.runes = t.unwrap.Feed(t.runes[:0], r)
+	if len(t.runes) == 1 {
+		return t.feed(t.runes[0])
+	}
+	var seqs []Sequence
+	for _, r := range t.runes {
+		seqs = append(seqs, t.feed(r)...)
+	}
+	return seqs
+}
+
+// Pending returns the input of the incomplete token, including the held back
+// start of a possible passthrough framing.
+func (t *Tokenizer) Pending() string {
+	if t == nil {
+		return ``
+	}
+	u := t.unwrap
+	return string(u.Flush(nil)) + t.raw.String()
+}
+
+// Reset discards the incomplete token.
+func (t *Tokenizer) Reset() {
+	if t == nil {
+		return
+	}
+	t.unwrap = PassthroughUnwrapper{}
+	t.reset()
+}
+
+func (t *Tokenizer) feed(r rune) []Sequence {
+	switch t.state {
+	case tokGround:
+		return t.ground(r)
+	case tokEsc:
+		t.raw.WriteRune(r)
+		switch r {
+		case '[':
+			t.begin(SeqCSI, tokCSI)
+		case 'P':
+			t.begin(SeqDCS, tokDCSHeader)
+		case ']':
+			t.begin(SeqOSC, tokString)
+		case 'X':
+			t.begin(SeqSOS, tokString)
+		case '^':
+			t.begin(SeqPM, tokString)
+		case '_':
+			t.begin(SeqAPC, tokString)
+		default:
+			switch {
+			case r >= 0x20 && r <= 0x2F:
+				t.seq.Intermediates += string(r)
+			case r >= 0x30 && r <= 0x7E:
+				t.seq.Final = r
+				return t.emit()
+			case r == '\033':
+				// ESC ESC - restart
+				t.reset()
+				t.raw.WriteRune(r)
+				t.seq.Type = SeqESC
+			default:
+				// cancel
+				t.reset()
+			}
+		}
+	case tokCSI, tokDCSHeader:
+		t.raw.WriteRune(r)
+		switch {
+		case r >= 0x30 && r <= 0x3F:
+			if t.buf.Len() == 0 && len(t.seq.Intermediates) == 0 && t.seq.Private == 0 && r >= '<' && r <= '?' {
+				t.seq.Private = r
+			} else {
+				t.buf.WriteRune(r)
+			}
+		case r >= 0x20 && r <= 0x2F:
+			t.seq.Intermediates += string(r)
+		case r >= 0x40 && r <= 0x7E:
+			t.seq.Params = t.buf.String()
+			t.buf.Reset()
+			t.seq.Final = r
+			if t.state == tokCSI {
+				return t.emit()
+			}
+			t.state = tokString
+		case r == '\033' || isC1Introducer(r):
+			// sequence aborted
+			t.reset()
+			return t.feed(r)
+		}
+	case tokString:
+		switch {
+		case r == '\a' || r == 0x9C:
+			t.raw.WriteRune(r)
+			return t.emitString()
+		case r == '\033':
+			t.raw.WriteRune(r)
+			t.state = tokStringEsc
+		default:
+			t.raw.WriteRune(r)
+			t.buf.WriteRune(r)
+		}
+	case tokStringEsc:
+		if r == '\\' {
+			t.raw.WriteRune(r)
+			return t.emitString()
+		}
+		// string aborted by a new escape sequence
+		raw := strings.TrimSuffix(t.raw.String(), "\033")
+		t.raw.Reset()
+		t.raw.WriteString(raw)
+		seqs := t.emitString()
+		t.state = tokEsc
+		t.seq.Type = SeqESC
+		t.raw.WriteRune('\033')
+		return append(seqs, t.feed(r)...)
+	}
+	return nil
+}
+
+func (t *Tokenizer) ground(r rune) []Sequence {
+	switch {
+	case r == '\033':
+		t.reset()
+		t.raw.WriteRune(r)
+		t.seq.Type = SeqESC
+		t.state = tokEsc
+		return nil
+	case isC1Introducer(r):
+		t.reset()
+		t.raw.WriteRune(r)
+		switch r {
+		case 0x9B:
+			t.begin(SeqCSI, tokCSI)
+		case 0x90:
+			t.begin(SeqDCS, tokDCSHeader)
+		case 0x9D:
+			t.begin(SeqOSC, tokString)
+		case 0x98:
+			t.begin(SeqSOS, tokString)
+		case 0x9E:
+			t.begin(SeqPM, tokString)
+		case 0x9F:
+			t.begin(SeqAPC, tokString)
+		}
+		return nil
+	case r < 0x20 || r == 0x7F:
+		return []Sequence{{Type: SeqControl, Final: r, Raw: string(r)}}
+	default:
+		return []Sequence{{Type: SeqText, Payload: string(r), Raw: string(r)}}
+	}
+}
+
+func isC1Introducer(r rune) bool {
+	switch r {
+	case 0x90, 0x98, 0x9B, 0x9D, 0x9E, 0x9F:
+		return true
+	}
+	return false
+}
+
+func (t *Tokenizer) begin(typ SeqType, st tokState) {
+	t.seq.Type = typ
+	t.state = st
+}
+
+func (t *Tokenizer) reset() {
+	t.state = tokGround
+	t.seq = Sequence{}
+	t.raw.Reset()
+	t.buf.Reset()
+}
+
+func (t *Tokenizer) emit() []Sequence {
+	seq := t.seq
+	seq.Raw = t.raw.String()
+	t.reset()
+	return []Sequence{seq}
+}
+
+func (t *Tokenizer) emitString() []Sequence {
+	t.seq.Payload = t.buf.String()
+	return t.emit()
+}
+
+var _ Parser = (*SequenceParser)(nil)
+
+// SequenceParser is a Parser tokenizing the reply to a query.
+// Sequences accepted by match are part of the reply, other tokens
+// (key presses, unrelated sequences) are collected as unsolicited input.
+// Parse returns true once n reply sequences were received.
+type SequenceParser struct {
+	tok         Tokenizer
+	match       func(Sequence) bool
+	n           int
+	replies     []Sequence
+	unsolicited []Sequence
+}
+
+// NewSequenceParser returns a SequenceParser. A nil match accepts all escape sequences.
+// n < 1 is treated as 1.
+func NewSequenceParser(match func(Sequence) bool, n int) *SequenceParser {
+	if match == nil {
+		match = Sequence.IsReply
+	}
+	if n < 1 {
+		n = 1
+	}
+	return &SequenceParser{match: match, n: n}
+}
+
+// Parse ...
+func (p *SequenceParser) Parse(r rune) bool {
+	if p == nil {
+		return true
+	}
+	if len(p.replies) >= p.n {
+		return true
+	}
+	for _, seq := range p.tok.Feed(r) {
+		if len(p.replies) < p.n && seq.IsReply() && p.match(seq) {
+			p.replies = append(p.replies, seq)
+		} else {
+			p.unsolicited = append(p.unsolicited, seq)
+		}
+	}
+	return len(p.replies) >= p.n
+}
+
+// Replies returns the sequences belonging to the reply.
+func (p *SequenceParser) Replies() []Sequence {
+	if p == nil {
+		return nil
+	}
+	return p.replies
+}
+
+// Unsolicited returns the tokens not belonging to the reply.
+func (p *SequenceParser) Unsolicited() []Sequence {
+	if p == nil {
+		return nil
+	}
+	return p.unsolicited
+}
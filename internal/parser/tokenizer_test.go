@@ -0,0 +1,121 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+func TestTokenize(t *testing.T) {
+	in := "a\033[?65;4c\u009b>1;2;0c\033P1+r544E=78\033\\\033]11;rgb:0/0/0\a\033P>|XTerm(390)\u009c\r"
+	seqs := parser.Tokenize(in)
+	if !assert.Len(t, seqs, 7) {
+		return
+	}
+	assert.Equal(t, parser.SeqText, seqs[0].Type)
+	assert.True(t, parser.IsDA1Reply(seqs[1]))
+	assert.Equal(t, []int{65, 4}, seqs[1].IntParams(0))
+	assert.True(t, seqs[2].Is(parser.SeqCSI, '>', ``, 'c'))
+	assert.Equal(t, `1;2;0`, seqs[2].Params)
+	assert.True(t, seqs[3].Is(parser.SeqDCS, 0, `+`, 'r'))
+	assert.Equal(t, `1`, seqs[3].Params)
+	assert.Equal(t, `544E=78`, seqs[3].Payload)
+	assert.Equal(t, parser.SeqOSC, seqs[4].Type)
+	assert.Equal(t, `11;rgb:0/0/0`, seqs[4].Payload)
+	assert.True(t, seqs[5].Is(parser.SeqDCS, '>', ``, '|'))
+	assert.Equal(t, `XTerm(390)`, seqs[5].Payload)
+	assert.Equal(t, parser.SeqControl, seqs[6].Type)
+
+	var raw string
+	for _, seq := range seqs {
+		raw += seq.Raw
+	}
+	assert.Equal(t, in, raw)
+}
+
+func TestSequenceParserUnsolicited(t *testing.T) {
+	p := parser.NewSequenceParser(parser.IsDA1Reply, 1)
+	var done bool
+	for _, r := range "x\033[Ay\033[?62c" {
+		done = p.Parse(r)
+	}
+	assert.True(t, done)
+	if assert.Len(t, p.Replies(), 1) {
+		assert.Equal(t, `62`, p.Replies()[0].Params)
+	}
+	assert.Len(t, p.Unsolicited(), 3) // "x", cursor up key, "y"
+}
+
+func TestTokenizePassthrough(t *testing.T) {
+	seqs := parser.Tokenize("\033Ptmux;\033\033P>|tmux 3.4\033\033\\\033\\\033Pt\033[?62c")
+	if !assert.Len(t, seqs, 3) {
+		return
+	}
+	assert.True(t, seqs[0].Is(parser.SeqDCS, '>', ``, '|'))
+	assert.Equal(t, `tmux 3.4`, seqs[0].Payload)
+	assert.Equal(t, "\033P>|tmux 3.4\033\\", seqs[0].Raw)
+	// not a passthrough framing, the DCS is aborted
+	assert.Equal(t, "\033Pt", seqs[1].Raw)
+	assert.True(t, parser.IsDA1Reply(seqs[2]))
+}
+
+func TestTokenizerPending(t *testing.T) {
+	tok := parser.NewTokenizer()
+	for _, r := range "a\033" {
+		tok.Feed(r)
+	}
+	assert.Equal(t, "\033", tok.Pending())
+	tok.Reset()
+	assert.Empty(t, tok.Pending())
+	for _, r := range "\033[1;" {
+		tok.Feed(r)
+	}
+	assert.Equal(t, "\033[1;", tok.Pending())
+}
+
+func TestIsQuery(t *testing.T) {
+	// each sequence is classified as written (query) and as received (reply),
+	// strings received from the terminal are always replies
+	tests := []struct {
+		seq   string
+		query bool
+		reply bool
+	}{
+		{seq: "\033[c", query: true},
+		{seq: "\033[>c", query: true, reply: true},
+		{seq: "\033[?62;4c", reply: true},
+		{seq: "\033[6n", query: true, reply: true},
+		{seq: "\033[12;40R", reply: true},
+		{seq: "\033[16t", query: true, reply: true},
+		{seq: "\033[6;20;10t", reply: true},
+		{seq: "\033[8;24;80t", reply: true},
+		{seq: "\033[?2026$p", query: true},
+		{seq: "\033[?2026;2$y", reply: true},
+		{seq: "\033[>q", query: true},
+		{seq: "\033P>|XTerm(390)\033\\", reply: true},
+		{seq: "\033P+q544E\033\\", query: true, reply: true},
+		{seq: "\033]11;?\a", query: true, reply: true},
+		{seq: "\033]0;title\a", reply: true},
+		{seq: "\033_Gi=1,a=q;AAAA\033\\", query: true, reply: true},
+		{seq: "\033_Ga=T,q=2;AAAA\033\\", reply: true},
+		{seq: "\033[?u", query: true, reply: true},
+		{seq: "\033[?1u", reply: true},
+		// key presses
+		{seq: "\033[A"},
+		{seq: "\033[15~"},
+		{seq: "\033[97;5u"},
+		{seq: "\033[<0;10;5M"},
+		{seq: "\033[200~"},
+		{seq: "\033a"},
+	}
+	for _, tt := range tests {
+		seqs := parser.Tokenize(tt.seq)
+		if !assert.Len(t, seqs, 1, "%q", tt.seq) {
+			continue
+		}
+		assert.Equal(t, tt.query, parser.IsQuery(seqs[0]), "IsQuery(%q)", tt.seq)
+		assert.Equal(t, tt.reply, parser.IsQueryReply(seqs[0]), "IsQueryReply(%q)", tt.seq)
+	}
+}
@@ -16,6 +16,8 @@ const (
 	Mode                        = GeneralPrefix + `mode` /// "tui", "cli" (default)
 	ManualComposition           = GeneralPrefix + `manualComposition`
 	NoCleanUpOnInterrupt        = GeneralPrefix + `noCleanUpOnInterrupt`
+	NoQuery                     = GeneralPrefix + `noQuery`        // skip terminal detection queries, use stored properties
+	ProfileDrawers              = GeneralPrefix + `profileDrawers` // comma separated drawer names stored in a terminal profile
 	TerminalName                = GeneralPrefix + `termName`
 	TerminalPID                 = GeneralPrefix + `termPID`
 	TerminalTTY                 = GeneralPrefix + `termTTY` // directly provided tty by the terminal
@@ -25,6 +27,9 @@ const (
 	TempDir                     = GeneralPrefix + `tempDir`
 	Passages                    = GeneralPrefix + `passages`
 	IsRemote                    = GeneralPrefix + `isRemote`
+	MuxAllowPassthrough         = GeneralPrefix + `muxAllowPassthrough`  // effective tmux allow-passthrough: "on", "off", "all"
+	MuxEnablePassthrough        = GeneralPrefix + `muxEnablePassthrough` // enable tmux allow-passthrough for the pane
+	MuxGraphics                 = GeneralPrefix + `muxGraphics`          // image sequence handling of the multiplexers: "sixel" (zellij), "none" (mosh)
 	IsLinuxConsole              = GeneralPrefix + `linuxConsoleIs`
 	LinuxConsoleMode            = GeneralPrefix + `linuxConsoleMode`
 	AvoidANSI                   = GeneralPrefix + `avoidANSI`
@@ -7,7 +7,6 @@ package mux
 import (
 	"math"
 	"os"
-	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -15,25 +14,75 @@ import (
 	"time"
 
 	"github.com/shirou/gopsutil/v3/net"
-	"github.com/shirou/gopsutil/v3/process"
 
 	"github.com/srlehn/termimg/internal/environ"
 	"github.com/srlehn/termimg/internal/errors"
-	"github.com/srlehn/termimg/internal/procextra"
 	"github.com/srlehn/termimg/internal/propkeys"
 )
 
-var (
-	wrappers = map[string]func(string) string{
-		`tmux`:   tmuxWrap,
-		`screen`: screenWrap,
-	}
+// Graphics describes how a multiplexer handles image sequences.
+type Graphics uint8
+
+const (
+	// GraphicsPassthrough - sequences are passed to the outer terminal (wrapped if necessary)
+	GraphicsPassthrough Graphics = iota
+	// GraphicsSixel - the multiplexer renders sixel images itself, other image protocols are dropped
+	GraphicsSixel
+	// GraphicsNone - only text reaches the outer terminal
+	GraphicsNone
 )
 
+func (g Graphics) String() string {
+	switch g {
+	case GraphicsPassthrough:
+		return `passthrough`
+	case GraphicsSixel:
+		return `sixel`
+	case GraphicsNone:
+		return `none`
+	}
+	return ``
+}
+
+type muxerType struct {
+	wrap     func(string) string // nil if sequences don't need wrapping
+	graphics Graphics
+}
+
+var muxerTypes = map[string]muxerType{
+	`tmux`:   {wrap: tmuxWrap},
+	`screen`: {wrap: screenWrap},
+	// zellij (>= 0.31) renders sixel in its own grid, there is no passthrough
+	// and the kitty graphics protocol isn't supported
+	`zellij`: {graphics: GraphicsSixel},
+	// mosh synchronizes the screen state and drops unknown sequences
+	`mosh`: {graphics: GraphicsNone},
+}
+
+// typeOf returns the handling of the multiplexer name. Names listing the candidates
+// of an unresolved detection (e.g. "ssh|mosh") get the most restrictive graphics
+// handling of the candidates and no wrapping.
+func typeOf(name string) (muxerType, bool) {
+	if typ, ok := muxerTypes[name]; ok || !strings.Contains(name, `|`) {
+		return typ, ok
+	}
+	var (
+		typ   muxerType
+		found bool
+	)
+	for _, candidate := range strings.Split(name, `|`) {
+		if t, ok := muxerTypes[candidate]; ok {
+			typ.graphics = max(typ.graphics, t.graphics)
+			found = true
+		}
+	}
+	return typ, found
+}
+
 type Muxer struct {
 	name       string
-	procServer *process.Process
-	procClient *process.Process
+	procServer Process
+	procClient Process
 	env        environ.Properties
 	ttyInner   string
 	isRemote   bool
@@ -43,11 +92,20 @@ func (m *Muxer) Wrap(s string) string {
 	if m == nil || len(m.name) == 0 {
 		return s
 	}
-	wrapFn, ok := wrappers[m.name]
-	if !ok || wrapFn == nil {
+	typ, ok := typeOf(m.name)
+	if !ok || typ.wrap == nil {
 		return s
 	}
-	return wrapFn(s)
+	return typ.wrap(s)
+}
+
+// Graphics returns how image sequences are handled by the multiplexer.
+func (m *Muxer) Graphics() Graphics {
+	if m == nil {
+		return GraphicsPassthrough
+	}
+	typ, _ := typeOf(m.name)
+	return typ.graphics
 }
 func (m *Muxer) TTY() string {
 	if m == nil || len(m.ttyInner) == 0 {
@@ -63,18 +121,31 @@ func (m *Muxer) IsRemote() bool { return m != nil && m.isRemote }
 type Muxers []*Muxer
 
 func (m Muxers) Wrap(s string) string {
+	for _, wrap := range m.wrappers() {
+		s = wrap(s)
+	}
+	return s
+}
+
+// wrappers returns the wrap functions in the order of application (outermost muxer first).
+func (m Muxers) wrappers() []func(string) string {
+	var wrappers []func(string) string
 	for i := len(m) - 1; i >= 0; i-- {
 		if m[i] == nil || m[i].procServer == nil {
 			continue
 		}
+		typ, ok := typeOf(m[i].name)
+		if !ok || typ.wrap == nil {
+			continue
+		}
 		// skip muxer clients
-		tty, err := procextra.TTYOfProc(m[i].procServer)
+		tty, err := m[i].procServer.TTY()
 		if err != nil || len(tty) == 0 {
 			continue
 		}
-		s = m[i].Wrap(s)
+		wrappers = append(wrappers, typ.wrap)
 	}
-	return s
+	return wrappers
 }
 func (m Muxers) String() string {
 	b := &strings.Builder{}
@@ -89,6 +160,15 @@ func (m Muxers) String() string {
 	}
 	return b.String()
 }
+
+// Graphics returns the most restrictive image sequence handling of the multiplexers.
+func (m Muxers) Graphics() Graphics {
+	g := GraphicsPassthrough
+	for _, muxer := range m {
+		g = max(g, muxer.Graphics())
+	}
+	return g
+}
 func (m Muxers) IsRemote() bool {
 	for _, muxer := range m {
 		if muxer.IsRemote() {
@@ -98,8 +178,6 @@ func (m Muxers) IsRemote() bool {
 	return false
 }
 
-// TODO: func (m Muxers) (Un)Wrapper() io.ReadWriter
-
 func Wrap(s string, pr environ.Properties) string {
 	if pr == nil {
 		return s
@@ -110,33 +188,62 @@ func Wrap(s string, pr environ.Properties) string {
 	}
 	passages := strings.Split(passagesStr, `>`)
 	for _, passage := range passages {
-		wrap, ok := wrappers[passage]
-		if !ok || wrap == nil {
+		typ, ok := typeOf(passage)
+		if !ok || typ.wrap == nil {
 			// TODO should we continue here?
 			continue
 		}
-		s = wrap(s)
+		s = typ.wrap(s)
 	}
 	return s
 }
 
+// GraphicsOf returns the most restrictive image sequence handling of all multiplexers
+// listed in the passages property.
+func GraphicsOf(pr environ.Properties) Graphics {
+	g := GraphicsPassthrough
+	if pr == nil {
+		return g
+	}
+	passagesStr, ok := pr.Property(propkeys.Passages)
+	if !ok || len(passagesStr) == 0 {
+		return g
+	}
+	for _, passage := range strings.Split(passagesStr, `>`) {
+		typ, _ := typeOf(passage)
+		g = max(g, typ.graphics)
+	}
+	return g
+}
+
 // ps -ewwo pid=,ppid=,tty=,comm=
 
-func FindTerminalProcess(pid int32) (procTerm *process.Process, ttyInner string, envInner environ.Properties, passages Muxers, e error) {
+// FindTerminalProcess walks the process tree of the running system up from pid
+// to the terminal process and collects the terminal multiplexers, ssh and
+// other tty passages on the way.
+func FindTerminalProcess(pid int32) (procTerm Process, ttyInner string, envInner environ.Properties, passages Muxers, e error) {
+	return FindTerminalProcessIn(SystemProcessTable(), pid)
+}
+
+// FindTerminalProcessIn is FindTerminalProcess on the processes of pt,
+// e.g. a recorded ProcessSnapshot.
+func FindTerminalProcessIn(pt ProcessTable, pid int32) (procTerm Process, ttyInner string, envInner environ.Properties, passages Muxers, e error) {
 	// TODO handle errors
-	// TODO make this testable...
-	proc, err := process.NewProcess(pid)
+	if pt == nil {
+		return nil, ``, nil, nil, errors.NilParam()
+	}
+	proc, err := pt.Process(pid)
 	if err != nil {
 		return nil, ``, nil, nil, errors.New(err)
 	}
-	var procLast, p *process.Process
+	var procLast, p Process
 	var tty, ttyLast, termType string
 	var isRemoteTotal bool
 Outer:
 	for {
 		for {
 			ttyLast = tty
-			tty, err = procextra.TTYOfProc(proc)
+			tty, err = proc.TTY()
 			if err != nil {
 				break Outer
 			}
@@ -145,15 +252,15 @@ Outer:
 			}
 			procLast = proc
 
-			p, err = procextra.ParentOfProc(proc)
-			if err != nil || p == nil || p.Pid < 2 {
+			p, err = proc.Parent()
+			if err != nil || p == nil || p.PID() < 2 {
 				// break Outer
 				break
 			}
 			proc = p
 		}
-		if proc != nil && proc.Pid == pid {
-			tty, _ := procextra.TTYOfProc(proc)
+		if proc != nil && proc.PID() == pid {
+			tty, _ := proc.TTY()
 			children, err := proc.Children()
 			if err == nil {
 				shellVar, okShell := os.LookupEnv(`SHELL`)
@@ -186,7 +293,7 @@ Outer:
 					if child == nil {
 						continue
 					}
-					ttyChild, err := procextra.TTYOfProc(child)
+					ttyChild, err := child.TTY()
 					// login shells on the console
 					if err != nil || ttyChild != tty {
 						continue
@@ -202,7 +309,7 @@ Outer:
 		}
 		// found a tty change
 		var isRemote bool
-		p, termType, isRemote, err = getClientProc(proc, procLast, termType)
+		p, termType, isRemote, err = getClientProc(pt, proc, procLast, termType)
 		if isRemote {
 			isRemoteTotal = true
 		}
@@ -215,8 +322,8 @@ Outer:
 				if en, err := proc.Environ(); err == nil {
 					env = en
 				}
-				var procClient *process.Process
-				if p != nil && p.Pid != proc.Pid {
+				var procClient Process
+				if p != nil && p.PID() != proc.PID() {
 					procClient = p
 				}
 				passages = append(passages, &Muxer{
@@ -235,7 +342,7 @@ Outer:
 		if p == nil {
 			// unable to find client pid
 			break
-		} else if p.Pid == proc.Pid {
+		} else if p.PID() == proc.PID() {
 			if p, err := proc.Parent(); err == nil && p != nil {
 				termType = ``
 				proc = p
@@ -246,7 +353,7 @@ Outer:
 	// ignore error - empty parent env will only prevent cleaning
 	var envrnOuter []string
 	if proc != nil {
-		envrnOuter, _ = procextra.EnvOfProc(proc)
+		envrnOuter, _ = proc.Environ()
 	}
 	if procLast == nil {
 		if children, err := proc.Children(); err == nil && len(children) > 0 {
@@ -256,8 +363,8 @@ Outer:
 	var errRet error
 	if procLast != nil {
 		var envrnInner []string
-		if procParent, err := procextra.ParentOfProc(procLast); err == nil && procParent != nil {
-			envrnInner, err = procextra.EnvOfProc(procLast)
+		if procParent, err := procLast.Parent(); err == nil && procParent != nil {
+			envrnInner, err = procLast.Environ()
 			if err != nil {
 				errRet = errors.New(err)
 			}
@@ -275,22 +382,22 @@ Outer:
 	return proc, ttyLast, envInner, passages, errRet
 }
 
-func findTTYProc(proc *process.Process) (procTTY, procInner *process.Process, ttyTTY, ttyInner string, e error) {
-	if proc == nil || proc.Pid < 2 {
+func findTTYProc(proc Process) (procTTY, procInner Process, ttyTTY, ttyInner string, e error) {
+	if proc == nil || proc.PID() < 2 {
 		return nil, nil, ``, ``, errors.New(`nil param or 0 or init pid`)
 	}
-	tty, err := procextra.TTYOfProc(proc)
+	tty, err := proc.TTY()
 	if err != nil {
 		return nil, nil, ``, ``, errors.New(err)
 	}
-	var procParent *process.Process
+	var procParent Process
 	var ttyParent string
 	for {
 		procParent, err = proc.Parent()
 		if err != nil {
 			return nil, nil, ``, ``, errors.New(err)
 		}
-		ttyParent, err = procextra.TTYOfProc(procParent)
+		ttyParent, err = procParent.TTY()
 		if err != nil {
 			return nil, nil, ``, ``, errors.New(err)
 		}
@@ -303,7 +410,7 @@ func findTTYProc(proc *process.Process) (procTTY, procInner *process.Process, tt
 	return procParent, proc, ttyParent, tty, nil
 }
 
-func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (procClient *process.Process, termType string, isRemote bool, e error) {
+func getClientProc(pt ProcessTable, procTerm, procInner Process, termTypeLast string) (procClient Process, termType string, isRemote bool, e error) {
 	// procTerm is a terminal, muxer, etc
 	var exe string
 	if x, err := procTerm.Exe(); err == nil {
@@ -314,7 +421,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 	}
 	var preservedVars []string
 	var env environ.Properties
-	if parent, err := procInner.Parent(); err == nil && parent.Pid == procTerm.Pid {
+	if parent, err := procInner.Parent(); err == nil && parent.PID() == procTerm.PID() {
 		envTerm, err := procTerm.Environ()
 		if err != nil && !os.IsPermission(err) {
 			return nil, ``, false, errors.New(err)
@@ -363,35 +470,30 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 		if len(paneID) == 0 {
 			return nil, ``, false, errors.New(`found no tmux pane id`)
 		}
-		info := new(TmuxInfo)
-		if err := info.Query(); err != nil {
-			return nil, ``, false, err
-		}
 		termType = `tmux-server`
-		pidClient := info.ClientPIDOfPane(paneID)
-		procClient, err = process.NewProcess(pidClient)
+		pidClient, err := pt.TmuxClientOfPane(tmuxSocket(envTemp), paneID)
 		if err != nil {
-			return nil, ``, false, errors.New(err)
+			return nil, ``, false, err
 		}
-	} else if sty, isScreen := envTemp.LookupEnv(screenSTYVarName); isScreen && len(sty) > 0 {
-		user, err := user.Current()
+		procClient, err = pt.Process(pidClient)
 		if err != nil {
 			return nil, ``, false, errors.New(err)
 		}
-		if _, err := os.Stat(`/run/screen/S-` + user.Username + `/` + sty); err != nil {
-			// file might not exist --> tmux not screen!
+	} else if sty, isScreen := envTemp.LookupEnv(screenSTYVarName); isScreen && len(sty) > 0 {
+		if !isScreenServer(procTerm, sty) {
+			// $STY inherited --> tmux not screen!
 			procClient, err = procTerm.Parent()
 			if err != nil {
 				return nil, ``, false, errors.New(err)
 			}
 			termType = `tmux-server`
 		} else {
-			pidClient, err := getScreenClientPID(procTerm.Pid)
+			pidClient, err := getScreenClientPID(pt, procTerm, sty)
 			if err != nil {
 				return nil, ``, false, err
 			}
 			termType = `screen-server`
-			procClient, err = process.NewProcess(pidClient)
+			procClient, err = pt.Process(pidClient)
 			if err != nil {
 				return nil, ``, false, errors.New(err)
 			}
@@ -404,7 +506,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 		// TODO find newer clients
 		termType = `zellij-server`
 		var serverCreationTime int64
-		processes, err := process.Processes()
+		processes, err := pt.Processes()
 		if err != nil {
 			goto skipZellijClient
 		}
@@ -417,7 +519,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 			if err != nil {
 				continue
 			}
-			if proc.Pid == procTerm.Pid {
+			if proc.PID() == procTerm.PID() {
 				continue
 			}
 			if int64(math.Abs(float64(clientCreationTime-serverCreationTime))) > zellijServerCreationMaxDur.Milliseconds() {
@@ -454,7 +556,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 	} else if sshTTY, isSSHOrMosh := envTemp.LookupEnv(sshTTYVarName); isSSHOrMosh && len(sshTTY) > 0 {
 		var ttyInner string
 		if procInner != nil {
-			if t, err := procextra.TTYOfProc(procInner); err == nil {
+			if t, err := procInner.TTY(); err == nil {
 				ttyInner = t
 			}
 		}
@@ -467,7 +569,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 				termType = `ssh`
 				var lAddr, rAddr net.Addr
 				var lAddrPort, rAddrPort int
-				processes, err := process.Processes()
+				processes, err := pt.Processes()
 				if err != nil {
 					goto skipSSHClient
 				}
@@ -514,7 +616,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 			} else {
 				termType = `mosh`
 				// look for useless localhost mosh connections otherwise connection is remote...
-				var procs []*process.Process
+				var procs []Process
 				var createdServerMSec int64
 				conns, err := procTerm.Connections()
 				if err != nil || len(conns) == 0 {
@@ -524,7 +626,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 				if err != nil {
 					goto skipMoshClient
 				}
-				procs, err = process.Processes()
+				procs, err = pt.Processes()
 				if err != nil || len(procs) == 0 {
 					goto skipMoshClient
 				}
@@ -595,8 +697,9 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 		if procClient == nil {
 			procClient = procTerm
 		}
-	} else if tt, found := strings.CutSuffix(termTypeLast, `-server`); found {
-		termType = tt + `-client`
+	} else if len(termTypeLast) > 0 && !strings.HasSuffix(termTypeLast, `-client`) {
+		// client of the last passage (muxer client, ssh, ...)
+		termType = strings.TrimSuffix(termTypeLast, `-server`) + `-client`
 	} else {
 		switch exe {
 		case `abduco`:
@@ -606,7 +709,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 			var cwd, sock string
 			var conns []net.ConnectionStat
 			if procInner != nil {
-				ttyInner, err := procextra.TTYOfProc(procInner)
+				ttyInner, err := procInner.TTY()
 				if err != nil {
 					goto skipDTachClient
 				}
@@ -635,12 +738,12 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 				goto skipDTachClient
 			}
 			{
-				processes, err := process.Processes()
+				processes, err := pt.Processes()
 				if err != nil {
 					goto skipDTachClient
 				}
 				for _, proc := range processes {
-					if proc != nil && proc.Pid == procTerm.Pid {
+					if proc != nil && proc.PID() == procTerm.PID() {
 						continue
 					}
 					// socket file name has to be passed to dtach on the command line
@@ -688,7 +791,7 @@ func getClientProc(procTerm, procInner *process.Process, termTypeLast string) (p
 	if procClient == nil {
 		procClient = procTerm
 	}
-	if procClient.Pid < 2 {
+	if procClient.PID() < 2 {
 		return nil, ``, false, errors.New(`unable to find client pid`)
 	}
 	return procClient, termType, isRemote, nil
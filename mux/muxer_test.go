@@ -0,0 +1,192 @@
+package mux
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/propkeys"
+)
+
+// outer terminal with a shell and an optional client process running in it
+func xtermProcs(clientPID int32, clientName string) []ProcessInfo {
+	procs := []ProcessInfo{
+		{PID: 1, Name: `init`, Exe: `/sbin/init`},
+		{PID: 100, PPID: 1, Name: `xterm`, Exe: `/usr/bin/xterm`, Env: []string{`DISPLAY=:0`, `HOME=/home/user`}},
+		{PID: 101, PPID: 100, TTY: `/pts/0`, Name: `bash`, Exe: `/usr/bin/bash`, Env: []string{`DISPLAY=:0`, `HOME=/home/user`, `TERM=xterm`}},
+	}
+	if clientPID > 0 {
+		procs = append(procs, ProcessInfo{
+			PID: clientPID, PPID: 101, TTY: `/pts/0`, Name: clientName, Exe: `/usr/bin/` + clientName,
+			Env: []string{`DISPLAY=:0`, `HOME=/home/user`, `TERM=xterm`}, CreateTime: 1000,
+		})
+	}
+	return procs
+}
+
+func TestFindTerminalProcessIn(t *testing.T) {
+	t.Setenv(`SHELL`, `/usr/bin/bash`)
+	tests := []struct {
+		name       string
+		snapshot   *ProcessSnapshot
+		pid        int32
+		wantTerm   int32
+		wantTTY    string
+		passages   string
+		wantRemote bool
+	}{
+		{
+			name:     "xterm",
+			snapshot: &ProcessSnapshot{Procs: xtermProcs(0, ``)},
+			pid:      101,
+			wantTerm: 100,
+			wantTTY:  `/pts/0`,
+		},
+		{
+			name: "xterm>tmux",
+			snapshot: &ProcessSnapshot{
+				Procs: append(xtermProcs(102, `tmux`),
+					ProcessInfo{PID: 200, PPID: 1, Name: `tmux`, Exe: `/usr/bin/tmux`, Env: []string{`TERM=xterm`}},
+					ProcessInfo{PID: 201, PPID: 200, TTY: `/pts/1`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=tmux-256color`, `TMUX=/tmp/tmux-1000/default,200,0`, `TMUX_PANE=%0`}},
+				),
+				TmuxClients: []TmuxClientInfo{{Socket: `/tmp/tmux-1000/default`, PaneID: `%0`, ClientPID: 102}},
+			},
+			pid:      201,
+			wantTerm: 100,
+			wantTTY:  `/pts/0`,
+			passages: `tmux`,
+		},
+		{
+			name: "xterm>screen",
+			snapshot: &ProcessSnapshot{
+				Procs: append(xtermProcs(102, `screen`),
+					ProcessInfo{PID: 200, PPID: 1, Name: `screen`, Exe: `/usr/bin/screen`, Env: []string{`TERM=xterm`},
+						OpenTTYs: []string{`/dev/pts/0`}},
+					ProcessInfo{PID: 201, PPID: 200, TTY: `/pts/1`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=screen`, `STY=200.pts-0.host`}},
+					// client of another session
+					ProcessInfo{PID: 300, PPID: 1, TTY: `/pts/7`, Name: `screen`, Exe: `/usr/bin/screen`},
+				),
+			},
+			pid:      201,
+			wantTerm: 100,
+			wantTTY:  `/pts/0`,
+			passages: `screen`,
+		},
+		{
+			name: "xterm>zellij",
+			snapshot: &ProcessSnapshot{
+				Procs: append(xtermProcs(102, `zellij`),
+					ProcessInfo{PID: 200, PPID: 1, Name: `zellij`, Exe: `/usr/bin/zellij`, Env: []string{`TERM=xterm`}, CreateTime: 1200},
+					ProcessInfo{PID: 201, PPID: 200, TTY: `/pts/1`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=xterm-256color`, `ZELLIJ=0`, `ZELLIJ_SESSION_NAME=test`}},
+				),
+			},
+			pid:      201,
+			wantTerm: 100,
+			wantTTY:  `/pts/0`,
+			passages: `zellij`,
+		},
+		{
+			name: "xterm>mosh",
+			snapshot: &ProcessSnapshot{
+				Procs: append(xtermProcs(0, ``),
+					// mosh-client connected to the localhost server started over ssh
+					ProcessInfo{PID: 102, PPID: 101, TTY: `/pts/0`, Name: `mosh-client`, Exe: `/usr/bin/mosh-client`,
+						Cmdline: `mosh-client -# localhost | 127.0.0.1 60001`, CreateTime: 1000,
+						Env: []string{`DISPLAY=:0`, `HOME=/home/user`, `TERM=xterm`}},
+					ProcessInfo{PID: 200, PPID: 1, Name: `mosh-server`, Exe: `/usr/bin/mosh-server`, CreateTime: 2500,
+						Env:         []string{`TERM=xterm`, `SSH_CONNECTION=127.0.0.1 50000 127.0.0.1 22`, `SSH_TTY=/dev/pts/3`},
+						Connections: []net.ConnectionStat{{Laddr: net.Addr{IP: `127.0.0.1`, Port: 60001}}}},
+					ProcessInfo{PID: 201, PPID: 200, TTY: `/pts/1`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=xterm-256color`}},
+				),
+			},
+			pid:      201,
+			wantTerm: 100,
+			wantTTY:  `/pts/0`,
+			passages: `mosh`,
+		},
+		{
+			name: "xterm>tmux>ssh>screen",
+			snapshot: &ProcessSnapshot{
+				Procs: append(xtermProcs(102, `tmux`),
+					ProcessInfo{PID: 200, PPID: 1, Name: `tmux`, Exe: `/usr/bin/tmux`, Env: []string{`TERM=xterm`}},
+					ProcessInfo{PID: 201, PPID: 200, TTY: `/pts/1`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=tmux-256color`, `TMUX=/tmp/tmux-1000/default,200,0`, `TMUX_PANE=%3`}},
+					ProcessInfo{PID: 202, PPID: 201, TTY: `/pts/1`, Name: `ssh`, Exe: `/usr/bin/ssh`,
+						Env:         []string{`TERM=tmux-256color`, `TMUX=/tmp/tmux-1000/default,200,0`, `TMUX_PANE=%3`},
+						Connections: []net.ConnectionStat{{Laddr: net.Addr{IP: `192.168.1.2`, Port: 50000}, Raddr: net.Addr{IP: `192.168.1.3`, Port: 22}}}},
+					// remote host
+					ProcessInfo{PID: 300, PPID: 1, Name: `sshd`, Exe: `/usr/sbin/sshd`},
+					ProcessInfo{PID: 301, PPID: 300, Name: `sshd`, Exe: `/usr/sbin/sshd`},
+					ProcessInfo{PID: 302, PPID: 301, TTY: `/pts/5`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=tmux-256color`, `SSH_TTY=/dev/pts/5`, `SSH_CONNECTION=192.168.1.2 50000 192.168.1.3 22`}},
+					ProcessInfo{PID: 303, PPID: 302, TTY: `/pts/5`, Name: `screen`, Exe: `/usr/bin/screen`},
+					ProcessInfo{PID: 400, PPID: 1, Name: `screen`, Exe: `/usr/bin/screen`, OpenTTYs: []string{`/dev/pts/5`}},
+					ProcessInfo{PID: 401, PPID: 400, TTY: `/pts/6`, Name: `bash`, Exe: `/usr/bin/bash`,
+						Env: []string{`TERM=screen`, `STY=400.pts-5.remote`}},
+				),
+				TmuxClients: []TmuxClientInfo{{Socket: `/tmp/tmux-1000/default`, PaneID: `%3`, ClientPID: 102}},
+			},
+			pid:        401,
+			wantTerm:   100,
+			wantTTY:    `/pts/0`,
+			passages:   `screen>ssh>tmux`,
+			wantRemote: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procTerm, ttyInner, envInner, passages, err := FindTerminalProcessIn(tt.snapshot, tt.pid)
+			require.NoError(t, err)
+			require.NotNil(t, procTerm)
+			assert.Equal(t, tt.wantTerm, procTerm.PID())
+			assert.Equal(t, tt.wantTTY, ttyInner)
+			assert.Equal(t, tt.passages, passages.String())
+			assert.Equal(t, tt.wantRemote, passages.IsRemote())
+			passagesProp, _ := envInner.Property(propkeys.Passages)
+			assert.Equal(t, tt.passages, passagesProp)
+		})
+	}
+}
+
+func TestGraphicsOf(t *testing.T) {
+	tests := []struct {
+		passages string
+		want     Graphics
+	}{
+		{passages: ``, want: GraphicsPassthrough},
+		{passages: `tmux`, want: GraphicsPassthrough},
+		{passages: `tmux>zellij`, want: GraphicsSixel},
+		{passages: `ssh>mosh`, want: GraphicsNone},
+		{passages: `ssh|mosh`, want: GraphicsNone}, // undecided between ssh and mosh
+	}
+	for _, tt := range tests {
+		pr := environ.NewProperties()
+		pr.SetProperty(propkeys.Passages, tt.passages)
+		assert.Equal(t, tt.want, GraphicsOf(pr), tt.passages)
+	}
+	assert.Equal(t, GraphicsNone, (&Muxer{name: `ssh|mosh`}).Graphics())
+}
+
+func TestProcessSnapshotJSON(t *testing.T) {
+	s := &ProcessSnapshot{
+		Procs:       append(xtermProcs(102, `tmux`), ProcessInfo{PID: 200, PPID: 1, Name: `tmux`, Env: []string{`TMUX=/tmp/s,200,0`, `TMUX_PANE=%1`}}),
+		TmuxClients: []TmuxClientInfo{{Socket: `/tmp/s`, PaneID: `%1`, ClientPID: 102}},
+	}
+	recorded, err := RecordProcessSnapshot(s)
+	require.NoError(t, err)
+	assert.Equal(t, s, recorded)
+
+	b, err := json.Marshal(recorded)
+	require.NoError(t, err)
+	var loaded ProcessSnapshot
+	require.NoError(t, json.Unmarshal(b, &loaded))
+	assert.Equal(t, s, &loaded)
+}
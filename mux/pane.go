@@ -0,0 +1,175 @@
+package mux
+
+import (
+	"image"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// PaneGeometry maps cell coordinates of the innermost multiplexer pane
+// to the outer terminal.
+type PaneGeometry struct {
+	// Offset is the upper left corner of the innermost pane in the outer terminal.
+	Offset image.Point
+	// Clip is the visible area of the innermost pane in outer terminal cells.
+	// It is empty if no pane geometry is known.
+	Clip image.Rectangle
+}
+
+// Translate returns the pane relative bounds in outer terminal cells clipped to the pane
+// and the visible part of bounds in pane relative cells.
+func (g PaneGeometry) Translate(bounds image.Rectangle) (outer, visible image.Rectangle) {
+	outer = bounds.Add(g.Offset)
+	if !g.Clip.Empty() {
+		outer = outer.Intersect(g.Clip)
+	}
+	return outer, outer.Sub(g.Offset)
+}
+
+// PaneGeometry queries the position of the innermost pane through all nested multiplexers.
+// envInner is the environment inside of the innermost multiplexer.
+// Muxers without panes (screen) don't change the geometry.
+func (m Muxers) PaneGeometry(envInner environ.Properties) (PaneGeometry, error) {
+	var geo PaneGeometry
+	for i, layer := range m.tmuxLayers(envInner) { // innermost first
+		pane, err := layer.pane()
+		if err != nil {
+			return PaneGeometry{}, err
+		}
+		r := image.Rect(int(pane.PaneLeft), int(pane.PaneTop), int(pane.PaneLeft+pane.PaneWidth), int(pane.PaneTop+pane.PaneHeight))
+		r = r.Add(image.Pt(0, pane.statusLinesAbove()))
+		if i == 0 {
+			geo.Clip = r
+		} else {
+			geo.Clip = geo.Clip.Add(r.Min).Intersect(r)
+		}
+		geo.Offset = geo.Offset.Add(r.Min)
+	}
+	return geo, nil
+}
+
+// tmuxLayer is a tmux muxer with the socket of its server.
+type tmuxLayer struct {
+	muxer  *Muxer
+	socket string
+}
+
+func (l tmuxLayer) pane() (*TmuxPane, error) { return l.muxer.tmuxPane(l.socket) }
+
+// tmuxLayers returns the tmux muxers, innermost first.
+func (m Muxers) tmuxLayers(envInner environ.Properties) []tmuxLayer {
+	var layers []tmuxLayer
+	for i, muxer := range m {
+		if muxer == nil || muxer.name != `tmux` {
+			continue
+		}
+		var socket string
+		if i == 0 {
+			if envInner != nil {
+				socket = tmuxSocket(envInner)
+			} else {
+				socket = tmuxSocket(environ.EnvToProperties(os.Environ()))
+			}
+		} else {
+			// the client of the inner muxer runs inside of this one
+			socket = tmuxSocket(m[i-1].clientEnv())
+		}
+		layers = append(layers, tmuxLayer{muxer: muxer, socket: socket})
+	}
+	return layers
+}
+
+func (m *Muxer) clientEnv() environ.Enver {
+	if m == nil || m.procClient == nil {
+		return nil
+	}
+	env, err := m.procClient.Environ()
+	if err != nil {
+		return nil
+	}
+	return environ.EnvToProperties(env)
+}
+
+// tmuxSocket returns the server socket from $TMUX ("socket,pid,session").
+// The default socket is used if empty.
+func tmuxSocket(env environ.Enver) string {
+	if env == nil {
+		return ``
+	}
+	tmuxVar, _ := env.LookupEnv(`TMUX`)
+	socket, _, _ := strings.Cut(tmuxVar, `,`)
+	return socket
+}
+
+func (m *Muxer) tmuxPane(socket string) (*TmuxPane, error) {
+	tty := m.TTY()
+	if len(tty) == 0 {
+		return nil, errors.New(`unknown tmux pane tty`)
+	}
+	sep := `|`
+	repl, err := execTmux[TmuxPane](sep, socket)
+	if err != nil {
+		return nil, err
+	}
+	panes, err := tmuxParseOutput[TmuxPane](repl, sep)
+	if err != nil {
+		return nil, err
+	}
+	for _, pane := range panes {
+		if pane != nil && pane.PaneTTY == tty {
+			return pane, nil
+		}
+	}
+	return nil, errors.New(`tmux pane not found`)
+}
+
+// PaneTracker caches the PaneGeometry. The geometry is queried again
+// after a few seconds or after Invalidate, e.g. when panes were moved or resized.
+type PaneTracker struct {
+	passages Muxers
+	env      environ.Properties
+	mu       sync.Mutex
+	geo      PaneGeometry
+	err      error
+	time     time.Time
+}
+
+// NewPaneTracker returns nil if there are no multiplexers with panes.
+func NewPaneTracker(passages Muxers, envInner environ.Properties) *PaneTracker {
+	for _, muxer := range passages {
+		if muxer != nil && muxer.name == `tmux` {
+			return &PaneTracker{passages: passages, env: envInner}
+		}
+	}
+	return nil
+}
+
+// Geometry ...
+func (p *PaneTracker) Geometry() (PaneGeometry, error) {
+	if p == nil {
+		return PaneGeometry{}, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.time.IsZero() && time.Since(p.time) < validityDuration {
+		return p.geo, p.err
+	}
+	p.geo, p.err = p.passages.PaneGeometry(p.env)
+	p.time = time.Now()
+	return p.geo, p.err
+}
+
+// Invalidate forces a new query on the next call of Geometry.
+func (p *PaneTracker) Invalidate() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.time = time.Time{}
+	p.mu.Unlock()
+}
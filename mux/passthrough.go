@@ -0,0 +1,204 @@
+package mux
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/exc"
+)
+
+// TmuxAllowPassthrough returns the effective tmux allow-passthrough setting
+// of the panes through all nested tmux instances:
+// "off" if any instance drops wrapped sequences, "all" if all instances
+// pass them through for invisible panes too, otherwise "on".
+// Older tmux versions (< 3.3) without the option always pass sequences through.
+// It is empty without tmux.
+func (m Muxers) TmuxAllowPassthrough(envInner environ.Properties) (string, error) {
+	var panes []*TmuxPane
+	for _, layer := range m.tmuxLayers(envInner) {
+		pane, err := layer.pane()
+		if err != nil {
+			return ``, err
+		}
+		panes = append(panes, pane)
+	}
+	return allowPassthroughOf(panes), nil
+}
+
+// allowPassthroughOf combines the allow-passthrough settings of nested panes.
+func allowPassthroughOf(panes []*TmuxPane) string {
+	var ret string
+	for _, pane := range panes {
+		switch pane.allowPassthrough() {
+		case `off`:
+			return `off`
+		case `all`:
+			if len(ret) == 0 {
+				ret = `all`
+			}
+		default:
+			// "on" or not supported by tmux version
+			ret = `on`
+		}
+	}
+	return ret
+}
+
+// EnableTmuxPassthrough sets allow-passthrough for the panes
+// of all nested tmux instances where it is off.
+func (m Muxers) EnableTmuxPassthrough(envInner environ.Properties) error {
+	for _, layer := range m.tmuxLayers(envInner) {
+		pane, err := layer.pane()
+		if err != nil {
+			return err
+		}
+		if pane.allowPassthrough() != `off` {
+			continue
+		}
+		if _, err := runTmux(``, append(tmuxSocketArgs(layer.socket),
+			`set-option`, `-p`, `-t`, pane.PaneID, `allow-passthrough`, `on`)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tmuxSocketArgs(socket string) []string {
+	if len(socket) == 0 {
+		return nil
+	}
+	return []string{`-S`, socket}
+}
+
+// PaneEvent is sent by WatchTmuxPane.
+type PaneEvent struct {
+	// Visible reports whether the pane is shown in the current window of its session
+	// through all nested tmux instances.
+	Visible bool
+	// LayoutChanged is set if the pane might have been moved or resized.
+	LayoutChanged bool
+}
+
+// tmux control mode notifications that might change visibility or layout
+var tmuxNotifications = map[string]bool{ // notification -> layout change
+	`%session-window-changed`: false,
+	`%window-pane-changed`:    false,
+	`%layout-change`:          true,
+	`%window-close`:           true,
+	`%unlinked-window-close`:  true,
+	`%session-changed`:        false,
+}
+
+// WatchTmuxPane attaches a read-only tmux control mode client to the session
+// of each nested tmux instance and sends an event whenever the innermost pane becomes
+// visible or hidden, e.g. by switching windows or zooming a pane, or when the
+// window layout changes. The channel is closed when ctx is done or tmux exits.
+func (m Muxers) WatchTmuxPane(ctx context.Context, envInner environ.Properties) (<-chan PaneEvent, error) {
+	if ctx == nil {
+		return nil, errors.NilParam()
+	}
+	layers := m.tmuxLayers(envInner)
+	if len(layers) == 0 {
+		return nil, errors.New(`not inside of tmux`)
+	}
+	tmuxAbs, err := exc.LookSystemDirs(`tmux`)
+	if err != nil {
+		return nil, err
+	}
+	visible := func() bool {
+		for _, layer := range layers {
+			pane, err := layer.pane()
+			if err != nil || !pane.visible() {
+				return false
+			}
+		}
+		return true
+	}
+
+	notifs := make(chan bool) // layout change
+	var wg sync.WaitGroup
+	for _, layer := range layers {
+		pane, err := layer.pane()
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.CommandContext(ctx, tmuxAbs, append(tmuxSocketArgs(layer.socket),
+			`-C`, `attach-session`, `-r`, `-t`, pane.SessionID)...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, errors.New(err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, errors.New(err)
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, errors.New(err)
+		}
+		// don't receive pane output and don't influence the window size (tmux >= 3.2)
+		_, _ = io.WriteString(stdin, "refresh-client -f no-output,ignore-size\n")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { _ = stdin.Close(); _ = cmd.Wait() }()
+			scanner := bufio.NewScanner(stdout)
+			for scanner.Scan() {
+				notif, _, _ := strings.Cut(scanner.Text(), ` `)
+				if notif == `%exit` {
+					return
+				}
+				layout, ok := tmuxNotifications[notif]
+				if !ok {
+					continue
+				}
+				select {
+				case notifs <- layout:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() { wg.Wait(); close(notifs) }()
+
+	events := make(chan PaneEvent)
+	go func() {
+		defer close(events)
+		vis := visible()
+		for layout := range notifs {
+			visNew := visible()
+			if visNew == vis && !layout {
+				continue
+			}
+			vis = visNew
+			select {
+			case events <- PaneEvent{Visible: vis, LayoutChanged: layout}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// allowPassthrough normalizes the option value,
+// tmux 3.3 has a flag option ("0", "1"), later versions a choice ("off", "on", "all").
+func (p *TmuxPane) allowPassthrough() string {
+	switch p.AllowPassthrough {
+	case `0`, `off`:
+		return `off`
+	case `1`, `on`:
+		return `on`
+	}
+	return p.AllowPassthrough
+}
+
+func (p *TmuxPane) visible() bool {
+	return p != nil && p.WindowActive && (!p.WindowZoomedFlag || p.PaneActive)
+}
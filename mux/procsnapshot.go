@@ -0,0 +1,161 @@
+package mux
+
+import (
+	"os"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// ProcessInfo is a recorded process of a ProcessSnapshot.
+type ProcessInfo struct {
+	PID         int32                `json:"pid"`
+	PPID        int32                `json:"ppid"`
+	TTY         string               `json:"tty,omitempty"` // e.g. "/pts/3"
+	Name        string               `json:"name,omitempty"`
+	Exe         string               `json:"exe,omitempty"`
+	Cmdline     string               `json:"cmdline,omitempty"`
+	Cwd         string               `json:"cwd,omitempty"`
+	Env         []string             `json:"env,omitempty"`
+	CreateTime  int64                `json:"create_time,omitempty"` // milliseconds since the epoch
+	Connections []net.ConnectionStat `json:"connections,omitempty"`
+	OpenTTYs    []string             `json:"open_ttys,omitempty"`
+}
+
+// TmuxClientInfo is a recorded assignment of a tmux pane to an attached client.
+type TmuxClientInfo struct {
+	Socket    string `json:"socket,omitempty"`
+	PaneID    string `json:"pane_id"`
+	ClientPID int32  `json:"client_pid"`
+}
+
+// ProcessSnapshot is a ProcessTable of recorded processes.
+// It can be stored as JSON, e.g. for reproducing the detection of a user report.
+type ProcessSnapshot struct {
+	Procs       []ProcessInfo    `json:"processes"`
+	TmuxClients []TmuxClientInfo `json:"tmux_clients,omitempty"`
+}
+
+var _ ProcessTable = (*ProcessSnapshot)(nil)
+
+// RecordProcessSnapshot records the processes of pt.
+// Information that isn't accessible is left empty.
+func RecordProcessSnapshot(pt ProcessTable) (*ProcessSnapshot, error) {
+	if pt == nil {
+		return nil, errors.NilParam()
+	}
+	procs, err := pt.Processes()
+	if err != nil {
+		return nil, err
+	}
+	s := &ProcessSnapshot{}
+	for _, proc := range procs {
+		if proc == nil {
+			continue
+		}
+		info := ProcessInfo{PID: proc.PID()}
+		if parent, err := proc.Parent(); err == nil && parent != nil {
+			info.PPID = parent.PID()
+		}
+		info.TTY, _ = proc.TTY()
+		info.Name, _ = proc.Name()
+		info.Exe, _ = proc.Exe()
+		info.Cmdline, _ = proc.Cmdline()
+		info.Cwd, _ = proc.Cwd()
+		info.Env, _ = proc.Environ()
+		info.CreateTime, _ = proc.CreateTime()
+		info.Connections, _ = proc.Connections()
+		info.OpenTTYs, _ = proc.OpenTTYs()
+		s.Procs = append(s.Procs, info)
+
+		// tmux panes are identified by the environment of their processes
+		var tmuxVar, paneID string
+		for _, v := range info.Env {
+			if val, ok := strings.CutPrefix(v, `TMUX=`); ok {
+				tmuxVar = val
+			} else if val, ok := strings.CutPrefix(v, `TMUX_PANE=`); ok {
+				paneID = val
+			}
+		}
+		if len(tmuxVar) == 0 || len(paneID) == 0 {
+			continue
+		}
+		socket, _, _ := strings.Cut(tmuxVar, `,`)
+		if _, err := s.TmuxClientOfPane(socket, paneID); err == nil {
+			continue
+		}
+		if pid, err := pt.TmuxClientOfPane(socket, paneID); err == nil {
+			s.TmuxClients = append(s.TmuxClients, TmuxClientInfo{Socket: socket, PaneID: paneID, ClientPID: pid})
+		}
+	}
+	return s, nil
+}
+
+func (s *ProcessSnapshot) Process(pid int32) (Process, error) {
+	if s == nil {
+		return nil, errors.NilReceiver()
+	}
+	for i := range s.Procs {
+		if s.Procs[i].PID == pid {
+			return &snapshotProcess{snapshot: s, info: &s.Procs[i]}, nil
+		}
+	}
+	return nil, errors.New(os.ErrNotExist)
+}
+
+func (s *ProcessSnapshot) Processes() ([]Process, error) {
+	if s == nil {
+		return nil, errors.NilReceiver()
+	}
+	procs := make([]Process, 0, len(s.Procs))
+	for i := range s.Procs {
+		procs = append(procs, &snapshotProcess{snapshot: s, info: &s.Procs[i]})
+	}
+	return procs, nil
+}
+
+func (s *ProcessSnapshot) TmuxClientOfPane(socket, paneID string) (int32, error) {
+	if s == nil {
+		return 0, errors.NilReceiver()
+	}
+	for _, c := range s.TmuxClients {
+		if c.Socket == socket && c.PaneID == paneID {
+			return c.ClientPID, nil
+		}
+	}
+	return 0, errors.New(`unable to find tmux client`)
+}
+
+type snapshotProcess struct {
+	snapshot *ProcessSnapshot
+	info     *ProcessInfo
+}
+
+var _ Process = (*snapshotProcess)(nil)
+
+func (p *snapshotProcess) PID() int32 { return p.info.PID }
+func (p *snapshotProcess) Parent() (Process, error) {
+	return p.snapshot.Process(p.info.PPID)
+}
+func (p *snapshotProcess) Children() ([]Process, error) {
+	var children []Process
+	for i := range p.snapshot.Procs {
+		if p.snapshot.Procs[i].PPID == p.info.PID {
+			children = append(children, &snapshotProcess{snapshot: p.snapshot, info: &p.snapshot.Procs[i]})
+		}
+	}
+	return children, nil
+}
+func (p *snapshotProcess) TTY() (string, error)        { return p.info.TTY, nil }
+func (p *snapshotProcess) Name() (string, error)       { return p.info.Name, nil }
+func (p *snapshotProcess) Exe() (string, error)        { return p.info.Exe, nil }
+func (p *snapshotProcess) Cmdline() (string, error)    { return p.info.Cmdline, nil }
+func (p *snapshotProcess) Cwd() (string, error)        { return p.info.Cwd, nil }
+func (p *snapshotProcess) Environ() ([]string, error)  { return p.info.Env, nil }
+func (p *snapshotProcess) CreateTime() (int64, error)  { return p.info.CreateTime, nil }
+func (p *snapshotProcess) OpenTTYs() ([]string, error) { return p.info.OpenTTYs, nil }
+func (p *snapshotProcess) Connections() ([]net.ConnectionStat, error) {
+	return p.info.Connections, nil
+}
@@ -0,0 +1,135 @@
+package mux
+
+import (
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/procextra"
+)
+
+// Process is a process of a ProcessTable.
+type Process interface {
+	PID() int32
+	Parent() (Process, error)
+	Children() ([]Process, error)
+	// TTY returns the controlling tty without "/dev" prefix, e.g. "/pts/3", or empty.
+	TTY() (string, error)
+	Name() (string, error)
+	Exe() (string, error)
+	Cmdline() (string, error)
+	Cwd() (string, error)
+	Environ() ([]string, error)
+	// CreateTime returns the creation time in milliseconds since the epoch.
+	CreateTime() (int64, error)
+	Connections() ([]net.ConnectionStat, error)
+	// OpenTTYs returns the ttys opened by the process, e.g. "/dev/pts/3".
+	// It fails with errors.ErrUnsupported where the open files aren't listed.
+	OpenTTYs() ([]string, error)
+}
+
+// ProcessTable provides the processes inspected by FindTerminalProcessIn.
+type ProcessTable interface {
+	Process(pid int32) (Process, error)
+	Processes() ([]Process, error)
+	// TmuxClientOfPane returns the pid of a client attached to the session of the pane.
+	// socket is the server socket from $TMUX, the default one if empty.
+	TmuxClientOfPane(socket, paneID string) (int32, error)
+}
+
+// SystemProcessTable returns the processes of the running system.
+func SystemProcessTable() ProcessTable { return systemProcessTable{} }
+
+type systemProcessTable struct{}
+
+var _ ProcessTable = systemProcessTable{}
+
+func (systemProcessTable) Process(pid int32) (Process, error) {
+	p, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return newSystemProcess(p), nil
+}
+
+func (systemProcessTable) Processes() ([]Process, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return wrapSystemProcesses(procs), nil
+}
+
+func (systemProcessTable) TmuxClientOfPane(socket, paneID string) (int32, error) {
+	info := &TmuxInfo{socket: socket}
+	if err := info.Query(); err != nil {
+		return 0, err
+	}
+	pid := info.ClientPIDOfPane(paneID)
+	if pid == 0 {
+		return 0, errors.New(`unable to find tmux client`)
+	}
+	return pid, nil
+}
+
+func (systemProcessTable) ttyLastInputTime(tty string) time.Time { return ttyLastInputTime(tty) }
+func (systemProcessTable) holdsFile(pid int32, path string) bool { return holdsFile(pid, path) }
+
+type systemProcess struct{ p *process.Process }
+
+var _ Process = (*systemProcess)(nil)
+
+func newSystemProcess(p *process.Process) Process {
+	if p == nil {
+		return nil
+	}
+	return &systemProcess{p: p}
+}
+
+func wrapSystemProcesses(procs []*process.Process) []Process {
+	ret := make([]Process, 0, len(procs))
+	for _, p := range procs {
+		if p != nil {
+			ret = append(ret, &systemProcess{p: p})
+		}
+	}
+	return ret
+}
+
+func (s *systemProcess) PID() int32 { return s.p.Pid }
+func (s *systemProcess) Parent() (Process, error) {
+	p, err := procextra.ParentOfProc(s.p)
+	if err != nil {
+		return nil, err
+	}
+	return newSystemProcess(p), nil
+}
+func (s *systemProcess) Children() ([]Process, error) {
+	children, err := s.p.Children()
+	if err != nil {
+		return nil, err
+	}
+	return wrapSystemProcesses(children), nil
+}
+func (s *systemProcess) TTY() (string, error)        { return procextra.TTYOfProc(s.p) }
+func (s *systemProcess) Name() (string, error)       { return s.p.Name() }
+func (s *systemProcess) Exe() (string, error)        { return s.p.Exe() }
+func (s *systemProcess) Cmdline() (string, error)    { return s.p.Cmdline() }
+func (s *systemProcess) Cwd() (string, error)        { return s.p.Cwd() }
+func (s *systemProcess) CreateTime() (int64, error)  { return s.p.CreateTime() }
+func (s *systemProcess) OpenTTYs() ([]string, error) { return openTTYsOfProc(s.p.Pid) }
+func (s *systemProcess) Connections() ([]net.ConnectionStat, error) {
+	return s.p.Connections()
+}
+func (s *systemProcess) Environ() ([]string, error) {
+	env, err := s.p.Environ()
+	if err == nil {
+		return env, nil
+	}
+	if envPlatform, errPlatform := procextra.EnvOfProc(s.p); errPlatform == nil {
+		return envPlatform, nil
+	}
+	return nil, err
+}
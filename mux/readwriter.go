@@ -0,0 +1,331 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+// ReadWriter wraps the escape sequences written to it for the multiplexers
+// and removes the passthrough framing from what is read.
+//
+// Only graphics sequences the multiplexers would otherwise drop are passed through
+// to the outer terminal: image protocols (kitty, sixel, iTerm2, urxvt, DomTerm, Terminology)
+// and other DCS, APC, PM and SOS strings. Text and all other sequences, including
+// queries, are written unchanged, so that the multiplexers keep track of the cursor
+// and answer for the pane. Queries meant for the outer terminal are wrapped
+// by the caller (Wrap) and written as they are.
+//
+// An incomplete sequence at the end of a Write is held back until it is completed
+// by the next Write or until pendingFlushDelay passed, then it is written unchanged.
+type ReadWriter struct {
+	rw       io.ReadWriter
+	wrappers []func(string) string
+
+	wmu          sync.Mutex
+	pending      []byte // incomplete sequence
+	pendingTimer *time.Timer
+	pendingGen   uint64
+	out          []byte
+
+	rmu    sync.Mutex
+	unwrap parser.PassthroughUnwrapper
+	in     []byte
+	runes  []rune
+	errIn  error
+}
+
+var _ io.ReadWriter = (*ReadWriter)(nil)
+
+// ReadWriter returns rw wrapped for the multiplexers with a server on a tty.
+func (m Muxers) ReadWriter(rw io.ReadWriter) *ReadWriter {
+	return newReadWriter(rw, m.wrappers())
+}
+
+// pendingFlushDelay is the time an incomplete sequence is held back for its completion.
+const pendingFlushDelay = 50 * time.Millisecond
+
+func newReadWriter(rw io.ReadWriter, wrappers []func(string) string) *ReadWriter {
+	return &ReadWriter{rw: rw, wrappers: wrappers}
+}
+
+// Unwrap returns the underlying io.ReadWriter.
+func (rw *ReadWriter) Unwrap() io.ReadWriter {
+	if rw == nil {
+		return nil
+	}
+	return rw.rw
+}
+
+func (rw *ReadWriter) wrap(s string) string {
+	for _, wrap := range rw.wrappers {
+		s = wrap(s)
+	}
+	return s
+}
+
+// Write ...
+func (rw *ReadWriter) Write(p []byte) (int, error) {
+	if rw == nil || rw.rw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	if len(rw.wrappers) == 0 {
+		return rw.rw.Write(p)
+	}
+	rw.wmu.Lock()
+	defer rw.wmu.Unlock()
+	rw.pendingGen++
+	if rw.pendingTimer != nil {
+		rw.pendingTimer.Stop()
+	}
+	data := p
+	if len(rw.pending) > 0 {
+		data = append(rw.pending, p...)
+		rw.pending = nil
+	}
+	out := rw.out[:0]
+	for i := 0; i < len(data); {
+		j := bytes.IndexByte(data[i:], '\033')
+		if j < 0 {
+			out = append(out, data[i:]...)
+			break
+		}
+		out = append(out, data[i:i+j]...)
+		i += j
+		end, complete := sequenceEnd(data[i:])
+		if !complete {
+			rw.pending = slices.Clone(data[i:])
+			gen := rw.pendingGen
+			rw.pendingTimer = time.AfterFunc(pendingFlushDelay, func() { rw.flushPending(gen) })
+			break
+		}
+		seq := data[i : i+end]
+		if needsPassthrough(seq) {
+			out = append(out, rw.wrap(string(seq))...)
+		} else {
+			out = append(out, seq...)
+		}
+		i += end
+	}
+	rw.out = out
+	if len(out) > 0 {
+		if _, err := rw.rw.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// WritePassthrough wraps p as a whole and passes it to the outer terminal,
+// e.g. for positioning the cursor outside of the pane.
+func (rw *ReadWriter) WritePassthrough(p []byte) (int, error) {
+	if rw == nil || rw.rw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	if len(rw.wrappers) == 0 {
+		return rw.rw.Write(p)
+	}
+	rw.wmu.Lock()
+	defer rw.wmu.Unlock()
+	if _, err := io.WriteString(rw.rw, rw.wrap(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes a held back incomplete sequence unchanged.
+func (rw *ReadWriter) Flush() error {
+	if rw == nil || rw.rw == nil {
+		return io.ErrClosedPipe
+	}
+	rw.wmu.Lock()
+	defer rw.wmu.Unlock()
+	return rw.flush()
+}
+
+// flushPending flushes the incomplete sequence of the Write with generation gen.
+func (rw *ReadWriter) flushPending(gen uint64) {
+	rw.wmu.Lock()
+	defer rw.wmu.Unlock()
+	if gen != rw.pendingGen {
+		return
+	}
+	_ = rw.flush()
+}
+
+func (rw *ReadWriter) flush() error {
+	if len(rw.pending) == 0 {
+		return nil
+	}
+	_, err := rw.rw.Write(rw.pending)
+	rw.pending = nil
+	return err
+}
+
+// Read ...
+func (rw *ReadWriter) Read(p []byte) (int, error) {
+	if rw == nil || rw.rw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	rw.rmu.Lock()
+	defer rw.rmu.Unlock()
+	for len(rw.in) == 0 {
+		if rw.errIn != nil {
+			err := rw.errIn
+			rw.errIn = nil
+			return 0, err
+		}
+		n, err := rw.rw.Read(p)
+		for _, b := range p[:n] {
+			rw.runes = rw.unwrap.Feed(rw.runes[:0], rune(b))
+			for _, r := range rw.runes {
+				rw.in = append(rw.in, byte(r))
+			}
+		}
+		if rw.unwrap.Holding() == 1 {
+			// don't hold back the Escape key
+			for _, r := range rw.unwrap.Flush(rw.runes[:0]) {
+				rw.in = append(rw.in, byte(r))
+			}
+		}
+		rw.errIn = err
+		if n == 0 && err == nil {
+			return 0, nil
+		}
+	}
+	n := copy(p, rw.in)
+	rw.in = rw.in[n:]
+	if len(rw.in) == 0 {
+		rw.in = nil
+	}
+	return n, nil
+}
+
+// sequenceEnd returns the length of the escape sequence at the start of b (7-bit introducers).
+func sequenceEnd(b []byte) (end int, complete bool) {
+	if len(b) < 2 {
+		return 0, false
+	}
+	switch b[1] {
+	case 'P', '_', ']', '^', 'X':
+		// strings are terminated by ST, OSC also by BEL
+		isTmuxFrame := bytes.HasPrefix(b, []byte("\033Ptmux;"))
+		isScreenFrame := isScreenFrame(b)
+		for i := 2; i < len(b); i++ {
+			switch {
+			case b[i] == '\a' && b[1] == ']':
+				return i + 1, true
+			case b[i] != '\033':
+				continue
+			case i+1 >= len(b):
+				return 0, false
+			case b[i+1] == '\\':
+				return i + 2, true
+			case b[i+1] == '\033' && isTmuxFrame:
+				i++
+			case isScreenFrame:
+				// ESC of the framed sequence
+			default:
+				// aborted by another sequence
+				return i, true
+			}
+		}
+		return 0, false
+	case '[':
+		for i := 2; i < len(b); i++ {
+			switch {
+			case b[i] >= 0x20 && b[i] <= 0x3F:
+			case b[i] >= 0x40 && b[i] <= 0x7E:
+				return i + 1, true
+			default:
+				return i, true
+			}
+		}
+		return 0, false
+	case '}':
+		// Terminology, terminated by NUL
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return i + 1, true
+		}
+		return 0, false
+	}
+	for i := 1; i < len(b); i++ {
+		switch {
+		case b[i] >= 0x20 && b[i] <= 0x2F:
+		case b[i] >= 0x30 && b[i] <= 0x7E:
+			return i + 1, true
+		default:
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// OSC commands of image protocols
+var passthroughOSC = map[string]struct{}{
+	`20`:   {}, // urxvt
+	`72`:   {}, // DomTerm
+	`1337`: {}, // iTerm2
+}
+
+// private modes unknown to multiplexers
+var passthroughModes = map[string]struct{}{
+	`8452`: {}, // sixel cursor placement (mintty, ...)
+}
+
+// isScreenFrame reports whether b starts with a DCS string passed through by screen.
+// The content of other DCS strings doesn't start with ESC.
+func isScreenFrame(b []byte) bool {
+	return len(b) > 2 && b[1] == 'P' && b[2] == '\033'
+}
+
+// needsPassthrough reports whether a complete sequence has to be wrapped.
+func needsPassthrough(raw []byte) bool {
+	if len(raw) < 2 {
+		return false
+	}
+	switch raw[1] {
+	case 'P':
+		// already wrapped if tmux or screen framing
+		return !bytes.HasPrefix(raw, []byte("\033Ptmux;")) && !isScreenFrame(raw)
+	case '_', '^', 'X', '}':
+		// APC, PM, SOS, Terminology
+		return true
+	case ']':
+		cmd, _, _ := bytes.Cut(raw[2:], []byte(`;`))
+		_, ok := passthroughOSC[string(cmd)]
+		return ok
+	case '[':
+		seqs := parser.Tokenize(string(raw))
+		return len(seqs) == 1 && needsPassthroughCSI(seqs[0])
+	}
+	return false
+}
+
+// needsPassthroughCSI reports whether the CSI sequence sets a mode unknown to the multiplexers.
+// Queries are answered by the multiplexers for the pane, e.g. sizes and the cursor position.
+func needsPassthroughCSI(seq parser.Sequence) bool {
+	if seq.Type != parser.SeqCSI || len(seq.Intermediates) > 0 {
+		return false
+	}
+	switch seq.Final {
+	case 'h', 'l':
+		if seq.Private != '?' {
+			return false
+		}
+		for _, mode := range seq.ParamList() {
+			if _, ok := passthroughModes[mode]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
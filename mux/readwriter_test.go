@@ -0,0 +1,167 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func TestReadWriterWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "text", writes: []string{"hello\r\n"}, want: "hello\r\n"},
+		{name: "cursor position", writes: []string{"\033[2;3Hx"}, want: "\033[2;3Hx"},
+		{
+			name:   "kitty",
+			writes: []string{"\033[1;1H\033_Ga=T,f=100;AAAA\033\\"},
+			want:   "\033[1;1H\033Ptmux;\033\033_Ga=T,f=100;AAAA\033\033\\\033\\",
+		},
+		{
+			name:   "sixel",
+			writes: []string{"\033[?8452h\033Pq#0~-\033\\"},
+			want:   "\033Ptmux;\033\033[?8452h\033\\\033Ptmux;\033\033Pq#0~-\033\033\\\033\\",
+		},
+		{name: "other private mode", writes: []string{"\033[?25l"}, want: "\033[?25l"},
+		{name: "iterm2", writes: []string{"\033]1337;File=inline=1:AA\a"}, want: "\033Ptmux;\033\033]1337;File=inline=1:AA\a\033\\"},
+		{name: "title", writes: []string{"\033]0;title\a"}, want: "\033]0;title\a"},
+		{name: "queries", writes: []string{"\033[c\033[>q\033[14t\033[6n"}, want: "\033[c\033[>q\033[14t\033[6n"},
+		{
+			name:   "already wrapped",
+			writes: []string{"\033Ptmux;\033\033_Ga=d\033\033\\\033\\"},
+			want:   "\033Ptmux;\033\033_Ga=d\033\033\\\033\\",
+		},
+		{
+			name:   "terminology",
+			writes: []string{"\033}ib\000  \033}ie\000"},
+			want:   "\033Ptmux;\033\033}ib\000\033\\  \033Ptmux;\033\033}ie\000\033\\",
+		},
+		{
+			name:   "split sequence",
+			writes: []string{"a\033", "_Ga=T;", "AA\033", "\\b"},
+			want:   "a\033Ptmux;\033\033_Ga=T;AA\033\033\\\033\\b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			rw := newReadWriter(readWriter{Writer: &out}, []func(string) string{tmuxWrap})
+			defer rw.Flush()
+			for _, w := range tt.writes {
+				n, err := rw.Write([]byte(w))
+				require.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestReadWriterFlush(t *testing.T) {
+	var out bytes.Buffer
+	rw := newReadWriter(readWriter{Writer: &out}, []func(string) string{tmuxWrap})
+	_, err := rw.Write([]byte("a\033[12"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", out.String(), `incomplete sequence held back`)
+	require.NoError(t, rw.Flush())
+	assert.Equal(t, "a\033[12", out.String())
+	require.NoError(t, rw.Flush())
+	assert.Equal(t, "a\033[12", out.String())
+}
+
+func TestReadWriterFlushDelay(t *testing.T) {
+	out := &syncBuffer{}
+	rw := newReadWriter(readWriter{Writer: out}, []func(string) string{tmuxWrap})
+	_, err := rw.Write([]byte("a\033"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", out.String())
+	assert.Eventually(t, func() bool { return out.String() == "a\033" }, time.Second, pendingFlushDelay/5,
+		`incomplete sequence flushed after delay`)
+
+	// completed before the delay
+	out.Reset()
+	_, err = rw.Write([]byte("\033_Ga=d"))
+	require.NoError(t, err)
+	_, err = rw.Write([]byte("\033\\"))
+	require.NoError(t, err)
+	time.Sleep(2 * pendingFlushDelay)
+	assert.Equal(t, "\033Ptmux;\033\033_Ga=d\033\033\\\033\\", out.String())
+}
+
+func TestReadWriterScreenFrame(t *testing.T) {
+	var out bytes.Buffer
+	rw := newReadWriter(readWriter{Writer: &out}, []func(string) string{screenWrap})
+	wrapped := screenWrap("\033[c")
+	_, err := rw.Write([]byte(wrapped + "x"))
+	require.NoError(t, err)
+	assert.Equal(t, wrapped+"x", out.String(), `already wrapped for screen`)
+}
+
+// syncBuffer is written to by the flush timer.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func TestReadWriterRead(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "\033[?62;4c", want: "\033[?62;4c"},
+		{name: "escape key", in: "\033", want: "\033"},
+		{name: "wrapped", in: "x\033Ptmux;\033\033P>|XTerm(390)\033\033\\\033\\y", want: "x\033P>|XTerm(390)\033\\y"},
+		{name: "no framing", in: "\033P1$r0m\033\\", want: "\033P1$r0m\033\\"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a lone ESC at the end of a read is passed on as Escape key
+			rw := newReadWriter(readWriter{Reader: &chunkReader{r: strings.NewReader(tt.in), size: 3}}, nil)
+			b, err := io.ReadAll(rw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+// chunkReader splits replies into small reads.
+type chunkReader struct {
+	r    io.Reader
+	size int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	return c.r.Read(p[:min(len(p), c.size)])
+}
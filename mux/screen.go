@@ -1,166 +1,268 @@
 package mux
 
 import (
-	"bufio"
-	"bytes"
+	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/exc"
 )
 
-func screenWrap(s string) string {
+func screenWrap(s string) string { return screenWrapLimit(s, screenStringLimit()) }
+
+// screenWrapLimit wraps s into DCS strings which GNU screen passes through
+// with at most limit bytes of content each.
+//
+// screen collects the content of a DCS string and writes it unchanged to the outer
+// terminal when the string is terminated. Overlong strings are truncated, so s is
+// split into multiple DCS strings. An ST ("\033\\") contained in s can't be passed in one
+// piece: inside of a string "\033\033\\" stores a single ESC before terminating the
+// string, the backslash is sent as the first byte of the following string.
+// Chunks are never split within UTF-8 encoded runes.
+func screenWrapLimit(s string, limit int) string {
+	const (
+		DCS = "\033P"
+		ST  = "\033\\"
+	)
+	limit = max(limit, utf8.UTFMax)
+	b := &strings.Builder{}
+	b.Grow(len(s) + (len(s)/limit+strings.Count(s, ST)+1)*len(DCS+ST))
+	b.WriteString(DCS)
+	var n int // content bytes of the current string
+	for i := 0; i < len(s); {
+		r := 1
+		if s[i] >= utf8.RuneSelf {
+			_, r = utf8.DecodeRuneInString(s[i:])
+		}
+		if n+r > limit || (s[i] == '\\' && n > 0 && s[i-1] == '\033') {
+			// previous byte was an ESC of an ST or the string is full
+			b.WriteString(ST + DCS)
+			n = 0
+		}
+		b.WriteString(s[i : i+r])
+		n += r
+		i += r
+	}
+	b.WriteString(ST)
+	return b.String()
+}
+
+// screenStringLimit returns the maximum content size of strings for the screen version.
+func screenStringLimit() int {
 	/*
 	   # https://github.com/chromium/hterm/blob/6846a85/etc/osc52.sh#L23
 	   #
 	   #  (v4.2.1) Apr 2014 - today: 768 bytes
 	   #  Aug 2008 - Apr 2014 (v4.2.0): 512 bytes
 	   #  ??? - Aug 2008 (v4.0.3): 256 bytes
-	   # Since v4.2.0 is only ~4 years old, we'll use the 256 limit.
-	   # We can probably switch to the 768 limit in 2022.
 	*/
-	// # DCS("\033P") + (256|512|768)-4 + ST("\033\\")
-	// TODO split containted ST ("\033\\")!
-	DCS := "\033P"
-	ST := "\033\\"
-	var limit int = 256
+	// buffer size (MAXSTR) minus terminating NUL byte
 	ver := getScreenVersion()
-	if ver[0] >= 4 {
-		if ver[1] > 2 || (ver[1] == 2 && ver[2] >= 1) {
-			limit = 768
-		} else if ver[2] >= 3 {
-			limit = 512
-		}
-	}
-	limitScreen := limit
-	limit -= len(DCS) + 2*len(ST)
-	parts := strings.Split(s, ST)
-	b := &strings.Builder{}
-	b.Grow(len(s) + (len(parts)+len(s)/limitScreen+1)*len(DCS+ST))
-	initPart := 1
-	b.WriteString(DCS)
-	for _, part := range parts {
-		if initPart == 0 {
-			b.WriteString("\033" + ST + DCS + `\`)
-		}
-		initPart = 0
-		i := limit + initPart
-		j := 0
-		var newPart = true
-		for ; i < len(part); i += limit + initPart {
-			if initPart == 0 && !newPart {
-				b.WriteString(ST + DCS)
-			}
-			b.WriteString(part[j:i])
-			j = i
-			newPart = false
-		}
-		if !newPart {
-			b.WriteString(ST + DCS)
-		}
-		b.WriteString(part[j:])
+	switch {
+	case ver[0] > 4,
+		ver[0] == 4 && (ver[1] > 2 || (ver[1] == 2 && ver[2] >= 1)):
+		return 768 - 1
+	case ver[0] == 4 && (ver[1] > 0 || ver[2] > 3):
+		return 512 - 1
 	}
-	b.WriteString(ST)
-
-	return b.String()
+	// also used if the version is unknown
+	return 256 - 1
 }
 
-func getScreenClientPID(pidServer int32) (int32, error) {
-	lsofExeAbs, err := exc.LookSystemDirs(`lsof`)
-	if err != nil {
+// getScreenClientPID returns the pid of the screen client process attached to the session
+// sty of the server.
+// Clients are screen processes on the ttys opened by the server. Clients holding the session
+// socket are preferred, clients naming another session on their command line are skipped.
+// If multiple clients remain (screen -x), the client of the display that received
+// input most recently is chosen.
+func getScreenClientPID(pt ProcessTable, procServer Process, sty string) (int32, error) {
+	if pt == nil || procServer == nil {
+		return 0, errors.NilParam()
+	}
+	// the screen server opens the ttys of its clients for output,
+	// without procfs they are unknown and all clients of the session are candidates
+	ttys, err := procServer.OpenTTYs()
+	if err != nil && !errors.Is(err, errors.ErrUnsupported) {
 		return 0, err
 	}
-	lsofReplTTY, err := exec.Command(
-		lsofExeAbs,
-		`-p`, strconv.Itoa(int(pidServer)),
-		`-a`,
-		`+D`, `/dev/pts/`,
-		`-Fn`,
-	).Output() // TODO use go
-	_ = err // lsof exits with exit code > 0 even when successful
-	scannerTTY := bufio.NewScanner(bytes.NewBuffer(lsofReplTTY))
-	var tty string
-	for scannerTTY.Scan() {
-		line := scannerTTY.Text()
-		t, found := strings.CutPrefix(line, `n`)
-		if found {
-			// TODO multi clients
-			tty = t
-			break
-		}
-	}
-	if len(tty) == 0 {
+	if err == nil && len(ttys) == 0 {
 		return 0, errors.New(`unable to find tty attached to screen server`)
 	}
-	lsofReplPIDClient, err := exec.Command(lsofExeAbs, `-Fpc`, tty).Output() // TODO use go
+	procs, err := pt.Processes()
+	if err != nil {
+		return 0, err
+	}
+	lastInput, _ := pt.(interface{ ttyLastInputTime(tty string) time.Time })
+	holder, _ := pt.(interface {
+		holdsFile(pid int32, path string) bool
+	})
+	sock, err := screenSocket(sty)
 	if err != nil {
-		return 0, errors.New(err)
-	}
-	scannerPIDClient := bufio.NewScanner(bytes.NewBuffer(lsofReplPIDClient))
-	var pidStr string
-	var succeeded bool
-	pidServerStr := `p` + strconv.Itoa(int(pidServer))
-	for scannerPIDClient.Scan() {
-		line := scannerPIDClient.Text()
-		if strings.HasPrefix(line, `p`) {
-			pidStr = line
+		holder = nil
+	}
+	type screenClient struct {
+		pid       int32
+		holdsSock bool
+		lastInput time.Time
+	}
+	var client screenClient
+	for _, proc := range procs {
+		if proc == nil || proc.PID() == procServer.PID() {
 			continue
 		}
-		if line == `c`+`screen` && pidStr != pidServerStr {
-			// TODO multi clients
-			succeeded = true
-			break
+		name, err := proc.Name()
+		if err != nil || !strings.EqualFold(name, `screen`) {
+			continue
+		}
+		tty, err := proc.TTY()
+		if err != nil || len(tty) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(tty, `/dev/`) {
+			tty = `/dev` + tty
+		}
+		if ttys != nil && !slices.Contains(ttys, tty) {
+			continue
+		}
+		if cmdline, err := proc.Cmdline(); err == nil && !screenCmdlineOfSession(cmdline, sty) {
+			continue
+		}
+		c := screenClient{pid: proc.PID()}
+		if holder != nil {
+			c.holdsSock = holder.holdsFile(c.pid, sock)
+		}
+		if lastInput != nil {
+			c.lastInput = lastInput.ttyLastInputTime(tty)
+		}
+		switch {
+		case client.pid == 0,
+			c.holdsSock && !client.holdsSock,
+			c.holdsSock == client.holdsSock && c.lastInput.After(client.lastInput):
+			client = c
 		}
 	}
-	if !succeeded || len(pidStr) == 0 {
-		return 0, errors.New(`unable to find process which have "` + tty + `" opened`)
+	if client.pid == 0 {
+		return 0, errors.New(`unable to find screen client process`)
 	}
-	pidClient, err := strconv.Atoi(strings.TrimPrefix(pidStr, `p`))
-	if err != nil {
-		return 0, errors.New(err)
+	return client.pid, nil
+}
+
+// screenCmdlineOfSession reports whether the command line of a screen client might attach
+// to the session sty ("pid.tty.host" or "pid.name").
+// screen selects the session by a prefix of its full name or of the name after the pid.
+// Command lines without a session name match.
+func screenCmdlineOfSession(cmdline, sty string) bool {
+	args := strings.Fields(cmdline)
+	for i := 1; i < len(args); i++ {
+		opt, isOpt := strings.CutPrefix(args[i], `-`)
+		if !isOpt || !strings.ContainsAny(opt, `rRx`) || strings.ContainsAny(opt, `SX`) {
+			continue
+		}
+		if i+1 >= len(args) || strings.HasPrefix(args[i+1], `-`) {
+			return true
+		}
+		name := args[i+1]
+		_, sessionName, _ := strings.Cut(sty, `.`)
+		return strings.HasPrefix(sty, name) || strings.HasPrefix(sessionName, name)
 	}
-	return int32(pidClient), nil
+	return true
 }
 
-var screenVersion [3]uint
+// isScreenServer reports whether the process is the server of the session $STY ("pid.tty.host").
+func isScreenServer(proc Process, sty string) bool {
+	if proc == nil || len(sty) == 0 {
+		return false
+	}
+	if pidStr, _, ok := strings.Cut(sty, `.`); ok && pidStr == strconv.Itoa(int(proc.PID())) {
+		return true
+	}
+	if name, err := proc.Name(); err == nil && strings.EqualFold(name, `screen`) {
+		return true
+	}
+	_, err := screenSocket(sty)
+	return err == nil
+}
 
-func getScreenVersion() [3]uint {
-	// e.g.: "Screen version 4.08.00 (GNU) 05-Feb-20"
-	if screenVersion != [3]uint{} {
-		return screenVersion
+// screenSocket returns the path of the socket of the session $STY.
+func screenSocket(sty string) (string, error) {
+	if len(sty) == 0 {
+		return ``, errors.New(`empty screen session name`)
 	}
-	var ver [3]uint
+	var dirs []string
+	if dir, ok := os.LookupEnv(`SCREENDIR`); ok && len(dir) > 0 {
+		dirs = append(dirs, dir)
+	}
+	if u, err := user.Current(); err == nil {
+		for _, dir := range []string{`/run/screen`, `/var/run/screen`, `/tmp/screens`, `/tmp/uscreens`} {
+			dirs = append(dirs, filepath.Join(dir, `S-`+u.Username))
+		}
+		if len(u.HomeDir) > 0 {
+			dirs = append(dirs, filepath.Join(u.HomeDir, `.screen`))
+		}
+	}
+	for _, dir := range dirs {
+		sock := filepath.Join(dir, filepath.Base(sty))
+		if _, err := os.Stat(sock); err == nil {
+			return sock, nil
+		}
+	}
+	return ``, errors.New(`unable to find screen socket`)
+}
+
+var (
+	screenVersion     [3]uint
+	screenVersionOnce sync.Once
+)
+
+// getScreenVersion returns the version of the screen executable.
+// It is only queried once and zero if unknown.
+func getScreenVersion() [3]uint {
+	screenVersionOnce.Do(func() { screenVersion = queryScreenVersion() })
+	return screenVersion
+}
+
+func queryScreenVersion() [3]uint {
 	screenExe, err := exc.LookSystemDirs(`screen`)
 	if err != nil {
-		return ver
+		return [3]uint{}
 	}
 	cmd := exec.Command(screenExe, `-v`)
 	cmd.Env = []string{`LC_ALL=C`}
 	repl, err := cmd.Output()
 	if err != nil {
-		return ver
-	}
-	screenVersionPrefix := `Screen version `
-	verParts := strings.Split(strings.SplitN(strings.TrimPrefix(string(repl), screenVersionPrefix), ` `, 2)[0], `.`)
-	if len(verParts) != 3 {
-		return ver
+		return [3]uint{}
 	}
-	major, err := strconv.ParseUint(verParts[0], 10, 64)
-	if err != nil {
+	return parseScreenVersion(string(repl))
+}
+
+// parseScreenVersion parses the output of "screen -v",
+// e.g.: "Screen version 4.08.00 (GNU) 05-Feb-20".
+func parseScreenVersion(repl string) [3]uint {
+	var ver [3]uint
+	verStr, ok := strings.CutPrefix(strings.TrimSpace(repl), `Screen version `)
+	if !ok {
 		return ver
 	}
-	minor, err := strconv.ParseUint(verParts[1], 10, 64)
-	if err != nil {
+	verStr, _, _ = strings.Cut(verStr, ` `)
+	verParts := strings.Split(verStr, `.`)
+	if len(verParts) != 3 {
 		return ver
 	}
-	patch, err := strconv.ParseUint(verParts[2], 10, 64)
-	if err != nil {
-		return ver
+	for i, part := range verParts {
+		v, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return [3]uint{}
+		}
+		ver[i] = uint(v)
 	}
-	ver = [3]uint{uint(major), uint(minor), uint(patch)}
-	screenVersion = ver
 	return ver
 }
 
@@ -0,0 +1,121 @@
+//go:build linux
+
+package mux
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// procRoot is the mount point of procfs.
+var procRoot = `/proc`
+
+// openTTYsOfProc returns the ttys opened by the process.
+func openTTYsOfProc(pid int32) ([]string, error) {
+	return openTTYsIn(filepath.Join(procRoot, strconv.Itoa(int(pid)), `fd`))
+}
+
+// openTTYsIn returns the ttys linked in the fd directory of a process.
+func openTTYsIn(fdDir string) ([]string, error) {
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	var ttys []string
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		// window ptys are held as /dev/ptmx
+		if !strings.HasPrefix(target, `/dev/pts/`) && !strings.HasPrefix(target, `/dev/tty`) {
+			continue
+		}
+		if target == `/dev/tty` || slices.Contains(ttys, target) {
+			continue
+		}
+		ttys = append(ttys, target)
+	}
+	return ttys, nil
+}
+
+// holdsFile reports whether the process has the file at path open.
+// screen sessions communicate over a named pipe or a unix socket: the named pipe
+// is the same file as the fd target, a socket is matched by the inodes of the sockets
+// bound to path in /proc/net/unix.
+func holdsFile(pid int32, path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	fdDir := filepath.Join(procRoot, strconv.Itoa(int(pid)), `fd`)
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return false
+	}
+	var sockets []uint64
+	if fi.Mode()&os.ModeSocket != 0 {
+		sockets = unixSocketInodes(path)
+	}
+	for _, e := range entries {
+		fd := filepath.Join(fdDir, e.Name())
+		target, err := os.Readlink(fd)
+		if err != nil {
+			continue
+		}
+		if inoStr, ok := strings.CutPrefix(target, `socket:[`); ok {
+			ino, err := strconv.ParseUint(strings.TrimSuffix(inoStr, `]`), 10, 64)
+			if err == nil && slices.Contains(sockets, ino) {
+				return true
+			}
+			continue
+		}
+		if fdInfo, err := os.Stat(fd); err == nil && os.SameFile(fi, fdInfo) {
+			return true
+		}
+	}
+	return false
+}
+
+// unixSocketInodes returns the inodes of the unix sockets bound to path.
+func unixSocketInodes(path string) []uint64 {
+	f, err := os.Open(filepath.Join(procRoot, `net`, `unix`))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	// Num RefCount Protocol Flags Type St Inode Path
+	var inodes []uint64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 || fields[7] != path {
+			continue
+		}
+		if ino, err := strconv.ParseUint(fields[6], 10, 64); err == nil {
+			inodes = append(inodes, ino)
+		}
+	}
+	return inodes
+}
+
+// ttyLastInputTime returns the access time of the tty, which is updated on reads.
+func ttyLastInputTime(tty string) time.Time {
+	fi, err := os.Stat(tty)
+	if err != nil {
+		return time.Time{}
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return time.Time{}
+	}
+	return time.Unix(st.Atim.Unix())
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package mux
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProcRoot replaces procfs by an empty directory for the test.
+func fakeProcRoot(t *testing.T) string {
+	t.Helper()
+	root, prev := t.TempDir(), procRoot
+	t.Cleanup(func() { procRoot = prev })
+	procRoot = root
+	return root
+}
+
+// fakeProcFds links the fds of the process pid in a procfs tree below root.
+func fakeProcFds(t *testing.T, root string, pid int32, targets ...string) {
+	t.Helper()
+	fdDir := filepath.Join(root, fmt.Sprint(pid), `fd`)
+	require.NoError(t, os.MkdirAll(fdDir, 0o700))
+	for fd, target := range targets {
+		require.NoError(t, os.Symlink(target, filepath.Join(fdDir, fmt.Sprint(fd))))
+	}
+}
+
+func TestOpenTTYsOfProc(t *testing.T) {
+	root := fakeProcRoot(t)
+	fakeProcFds(t, root, 42,
+		`/dev/pts/3`, `/dev/pts/3`, `/dev/pts/3`, `/dev/ptmx`, `/dev/tty`, `/dev/tty1`, `socket:[123]`, `/dev/null`)
+	ttys, err := openTTYsOfProc(42)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`/dev/pts/3`, `/dev/tty1`}, ttys)
+
+	_, err = openTTYsOfProc(43)
+	assert.Error(t, err)
+}
+
+func TestHoldsFile(t *testing.T) {
+	root := fakeProcRoot(t)
+
+	// named pipe sessions
+	fifo := filepath.Join(t.TempDir(), `200.pts-0.host`)
+	require.NoError(t, syscall.Mkfifo(fifo, 0o600))
+	other := filepath.Join(t.TempDir(), `300.pts-1.host`)
+	require.NoError(t, syscall.Mkfifo(other, 0o600))
+	fakeProcFds(t, root, 42, `/dev/pts/3`, fifo)
+	fakeProcFds(t, root, 43, `/dev/pts/4`, other)
+	assert.True(t, holdsFile(42, fifo))
+	assert.False(t, holdsFile(43, fifo))
+	assert.False(t, holdsFile(44, fifo), `no process`)
+
+	// socket sessions
+	sock := filepath.Join(t.TempDir(), `400.pts-2.host`)
+	l, err := net.Listen(`unix`, sock)
+	require.NoError(t, err)
+	defer l.Close()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, `net`), 0o700))
+	netUnix := "Num       RefCount Protocol Flags    Type St Inode Path\n" +
+		"0000000000000000: 00000002 00000000 00010000 0001 01 777 " + sock + "\n" +
+		"0000000000000000: 00000003 00000000 00000000 0001 03 778 " + sock + "\n" +
+		"0000000000000000: 00000003 00000000 00000000 0001 03 779\n" +
+		"0000000000000000: 00000002 00000000 00010000 0001 01 780 /run/other.sock\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, `net`, `unix`), []byte(netUnix), 0o600))
+	assert.Equal(t, []uint64{777, 778}, unixSocketInodes(sock))
+	fakeProcFds(t, root, 45, `/dev/pts/5`, `socket:[778]`)
+	fakeProcFds(t, root, 46, `/dev/pts/6`, `socket:[779]`, `socket:[780]`)
+	assert.True(t, holdsFile(45, sock))
+	assert.False(t, holdsFile(46, sock))
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package mux
+
+import (
+	"os"
+	"time"
+
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// openTTYsOfProc returns the ttys opened by the process.
+// Without procfs the open files aren't listed.
+func openTTYsOfProc(pid int32) ([]string, error) { return nil, errors.ErrUnsupported }
+
+// holdsFile reports whether the process has the file at path open, it is unknown without procfs.
+func holdsFile(pid int32, path string) bool { return false }
+
+func ttyLastInputTime(tty string) time.Time {
+	fi, err := os.Stat(tty)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
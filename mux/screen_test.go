@@ -0,0 +1,216 @@
+package mux
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// screenUnwrap mimics the string handling of GNU screen (ansi.c) for DCS strings:
+// the content of each string is written to the outer terminal when it is terminated by ST.
+// Inside of a string ESC ESC stores a single ESC without leaving the escape state.
+// It fails if a string would have been truncated or if there is output outside of strings.
+func screenUnwrap(t *testing.T, s string, limit int) string {
+	t.Helper()
+	const (
+		stGround = iota
+		stEsc
+		stString
+		stStringEsc
+	)
+	var (
+		out   strings.Builder
+		str   []byte
+		state = stGround
+	)
+	store := func(c byte) {
+		if len(str) >= limit {
+			t.Fatalf("string truncated by screen after %d bytes: %q", limit, str)
+		}
+		str = append(str, c)
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch state {
+		case stGround:
+			if c != '\033' {
+				t.Fatalf("unwrapped byte %q at offset %d", c, i)
+			}
+			state = stEsc
+		case stEsc:
+			if c != 'P' {
+				t.Fatalf("unexpected sequence ESC %q at offset %d", c, i)
+			}
+			str = str[:0]
+			state = stString
+		case stString:
+			if c == '\033' {
+				state = stStringEsc
+				continue
+			}
+			store(c)
+		case stStringEsc:
+			switch c {
+			case '\\':
+				out.Write(str)
+				state = stGround
+			case '\033':
+				store('\033')
+			default:
+				store('\033')
+				store(c)
+				state = stString
+			}
+		}
+	}
+	if state != stGround {
+		t.Fatalf("unterminated string")
+	}
+	return out.String()
+}
+
+func TestScreenWrap(t *testing.T) {
+	const limit = 767
+	kittyChunk := "\033_Gf=100,a=T,m=1;" + strings.Repeat("QUJD", 1024) + "\033\\"
+	sixel := "\033Pq#0;2;0;0;0#1;2;100;100;0" + strings.Repeat("#1~~@@vv@@~~@@~~$-", 200) + "\033\\"
+	tests := []struct {
+		name  string
+		in    string
+		limit int
+	}{
+		{name: "empty", in: ``, limit: limit},
+		{name: "short", in: "\033[6n", limit: limit},
+		{name: "exact limit", in: strings.Repeat(`a`, limit), limit: limit},
+		{name: "limit exceeded", in: strings.Repeat(`a`, limit+1), limit: limit},
+		{name: "embedded ST", in: "\033]1337;File=inline=1:AAAA\033\\", limit: limit},
+		{name: "multiple ST", in: "\033_Ga=d\033\\\033_Ga=T;AAAA\033\\", limit: limit},
+		{name: "ST only", in: "\033\\", limit: limit},
+		{name: "ESC at string end", in: strings.Repeat(`a`, 9) + "\033\\bc", limit: 10},
+		{name: "backslash at string start", in: strings.Repeat(`a`, 10) + "\\\033\\", limit: 10},
+		{name: "ESC ESC", in: "a\033\033\\b\033\033c", limit: limit},
+		{name: "ESC before other sequence", in: "\033P\033[1m\033\\", limit: limit},
+		{name: "utf-8 at boundary", in: strings.Repeat(`a`, 8) + "äöü€", limit: 10},
+		{name: "kitty", in: kittyChunk, limit: limit},
+		{name: "kitty small limit", in: kittyChunk, limit: 255},
+		{name: "sixel", in: sixel, limit: 511},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := screenWrapLimit(tt.in, tt.limit)
+			require.True(t, strings.HasPrefix(wrapped, "\033P"))
+			require.True(t, strings.HasSuffix(wrapped, "\033\\"))
+			assert.Equal(t, tt.in, screenUnwrap(t, wrapped, tt.limit))
+		})
+	}
+}
+
+func TestParseScreenVersion(t *testing.T) {
+	tests := []struct {
+		repl string
+		ver  [3]uint
+	}{
+		{repl: "Screen version 4.08.00 (GNU) 05-Feb-20\n", ver: [3]uint{4, 8, 0}},
+		{repl: "Screen version 4.02.01 (GNU) 28-Apr-14", ver: [3]uint{4, 2, 1}},
+		{repl: "Screen version 5.0.0 (build on 2024-08-29 21:55:15)", ver: [3]uint{5, 0, 0}},
+		{repl: "Screen version 4.00.03jw4 (FAU) 2-May-06", ver: [3]uint{}},
+		{repl: "bash: screen: command not found", ver: [3]uint{}},
+		{repl: ``, ver: [3]uint{}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ver, parseScreenVersion(tt.repl), tt.repl)
+	}
+}
+
+func TestScreenCmdlineOfSession(t *testing.T) {
+	const sty = `1234.pts-0.host`
+	tests := []struct {
+		cmdline string
+		want    bool
+	}{
+		{`screen`, true},
+		{`screen -x`, true},
+		{`screen -d -r`, true},
+		{`screen -x 1234`, true},
+		{`screen -r 1234.pts-0.host`, true},
+		{`screen -DR pts-0`, true},
+		{`screen -x 99`, false},
+		{`screen -dr other`, false},
+		{`screen -S work -x`, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, screenCmdlineOfSession(tt.cmdline, sty), tt.cmdline)
+	}
+}
+
+// screenTable adds the session socket holders and the tty input times to a snapshot.
+type screenTable struct {
+	*ProcessSnapshot
+	holders   []int32
+	lastInput map[string]time.Time
+}
+
+func (s *screenTable) holdsFile(pid int32, _ string) bool    { return slices.Contains(s.holders, pid) }
+func (s *screenTable) ttyLastInputTime(tty string) time.Time { return s.lastInput[tty] }
+
+func TestGetScreenClientPID(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(`SCREENDIR`, dir)
+	const sty = `200.pts-0.host`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, sty), nil, 0o600))
+	now := time.Now()
+	snapshot := func() *ProcessSnapshot {
+		return &ProcessSnapshot{Procs: []ProcessInfo{
+			{PID: 200, Name: `screen`, OpenTTYs: []string{`/dev/pts/0`, `/dev/pts/1`, `/dev/pts/2`}},
+			{PID: 300, TTY: `/pts/0`, Name: `screen`, Cmdline: `screen -x`},
+			{PID: 301, TTY: `/pts/1`, Name: `screen`, Cmdline: `screen -x 200`},
+			{PID: 302, TTY: `/pts/2`, Name: `screen`, Cmdline: `screen -r other`},
+			{PID: 303, TTY: `/pts/3`, Name: `screen`, Cmdline: `screen -x`},
+		}}
+	}
+	tests := []struct {
+		name      string
+		holders   []int32
+		lastInput map[string]time.Time
+		want      int32
+	}{
+		{`latest input`, nil, map[string]time.Time{`/dev/pts/0`: now, `/dev/pts/1`: now.Add(time.Second)}, 301},
+		{`socket holder`, []int32{300}, map[string]time.Time{`/dev/pts/1`: now}, 300},
+		{`other session`, nil, map[string]time.Time{`/dev/pts/2`: now}, 300},
+		{`tty not of the server`, []int32{303}, map[string]time.Time{`/dev/pts/3`: now}, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pt := &screenTable{ProcessSnapshot: snapshot(), holders: tt.holders, lastInput: tt.lastInput}
+			procServer, err := pt.Process(200)
+			require.NoError(t, err)
+			pid, err := getScreenClientPID(pt, procServer, sty)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pid)
+		})
+	}
+
+	pt := &screenTable{ProcessSnapshot: snapshot(), lastInput: map[string]time.Time{`/dev/pts/3`: now}}
+	procServer, err := pt.Process(200)
+	require.NoError(t, err)
+	// without procfs all clients of the session are candidates
+	pid, err := getScreenClientPID(pt, noOpenTTYs{procServer}, sty)
+	require.NoError(t, err)
+	assert.Equal(t, int32(303), pid)
+
+	pt.Procs[0].OpenTTYs = nil
+	_, err = getScreenClientPID(pt, procServer, sty)
+	assert.Error(t, err, `no tty attached to the server`)
+}
+
+// noOpenTTYs is a process on a system without procfs.
+type noOpenTTYs struct{ Process }
+
+func (noOpenTTYs) OpenTTYs() ([]string, error) { return nil, errors.ErrUnsupported }
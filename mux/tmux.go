@@ -27,20 +27,42 @@ type TmuxPane struct {
 	// PaneRight uint
 	PaneTop uint
 	// PaneBottom uint
-	PaneID    string
-	PaneIndex uint
-	PanePID   string
-	PaneTTY   string
+	PaneID     string
+	PaneIndex  uint
+	PanePID    string
+	PaneTTY    string
+	PaneActive bool
 	// PanePipe    bool
 	// PaneCurrentCommand string
 	// AlternateOn bool
 	// OriginFlag bool
-	WindowID    string
-	WindowIndex uint
+	WindowID         string
+	WindowIndex      uint
+	WindowActive     bool // current window of the session
+	WindowZoomedFlag bool
 	// WindowName string
 	SessionID string
 	// SessionName string
 	PID uint // server pid
+	// options can be used as format variables (tmux >= 3.3)
+	AllowPassthrough string `tmux:"allow-passthrough"` // on, off, all
+	Status           string `tmux:"status"`            // on, off, 2-5 lines
+	StatusPosition   string `tmux:"status-position"`   // top, bottom
+}
+
+// statusLinesAbove returns the number of status bar lines above the panes of the window,
+// PaneTop is relative to the first line below them.
+func (p *TmuxPane) statusLinesAbove() int {
+	if p == nil || p.StatusPosition != `top` {
+		return 0
+	}
+	switch p.Status {
+	case `on`:
+		return 1
+	case `2`, `3`, `4`, `5`:
+		return int(p.Status[0] - '0')
+	}
+	return 0
 }
 
 func (p *TmuxPane) Args() []string { return []string{`list-panes`, `-a`} }
@@ -65,6 +87,7 @@ type TmuxClient struct {
 func (p *TmuxClient) Args() []string { return []string{`list-clients`} }
 
 type TmuxInfo struct {
+	socket  string // default socket if empty
 	time    time.Time
 	panes   []*TmuxPane
 	clients []*TmuxClient
@@ -99,7 +122,7 @@ func (i *TmuxInfo) Query() error {
 		return nil
 	}
 	sep := `|`
-	replPanes, err := execTmux[TmuxPane](sep)
+	replPanes, err := execTmux[TmuxPane](sep, i.socket)
 	if err != nil {
 		return err
 	}
@@ -108,7 +131,7 @@ func (i *TmuxInfo) Query() error {
 		return err
 	}
 	i.panes = panes
-	replClients, err := execTmux[TmuxClient](sep)
+	replClients, err := execTmux[TmuxClient](sep, i.socket)
 	if err != nil {
 		return err
 	}
@@ -127,6 +150,10 @@ func getFieldNames(p any) []string {
 	}
 	var fields []string
 	for i := 0; i < t.Elem().NumField(); i++ {
+		if tag, ok := t.Elem().Field(i).Tag.Lookup(`tmux`); ok {
+			fields = append(fields, tag)
+			continue
+		}
 		fieldName := t.Elem().Field(i).Name
 		fieldNameSnakeCase := strcase.ToSnake(fieldName)
 		// don't split "UTF8"
@@ -147,7 +174,8 @@ func getFieldNames(p any) []string {
 	return fields
 }
 
-func execTmux[T any](sep string) (string, error) {
+// execTmux runs the list command of T with the server socket (default if empty).
+func execTmux[T any](sep, socket string) (string, error) {
 	tmuxAbs, err := exc.LookSystemDirs(`tmux`)
 	if err != nil {
 		return ``, err
@@ -162,17 +190,22 @@ func execTmux[T any](sep string) (string, error) {
 	if arger, ok := any(obj).(internal.Arger); ok {
 		args = arger.Args()
 	}
-	command := exec.Command(
-		tmuxAbs,
-		append(
-			// append([]string{`-S`, `/tmp/tmux-` + strconv.Itoa(os.Getuid()) + `/default`}, args...),
-			args,
-			[]string{
-				`-F`,
-				fmtStr,
-			}...)...,
-	)
-	repl, err := command.Output()
+	if len(socket) > 0 {
+		args = append([]string{`-S`, socket}, args...)
+	}
+	return runTmux(tmuxAbs, append(args, `-F`, fmtStr)...)
+}
+
+// runTmux runs a tmux command, tmuxAbs is looked up if empty.
+func runTmux(tmuxAbs string, args ...string) (string, error) {
+	if len(tmuxAbs) == 0 {
+		var err error
+		tmuxAbs, err = exc.LookSystemDirs(`tmux`)
+		if err != nil {
+			return ``, err
+		}
+	}
+	repl, err := exec.Command(tmuxAbs, args...).Output()
 	if err != nil {
 		return ``, errors.New(err)
 	}
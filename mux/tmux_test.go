@@ -0,0 +1,62 @@
+package mux
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTmuxStatusLinesAbove(t *testing.T) {
+	tests := []struct {
+		status, position string
+		lines            int
+	}{
+		{status: `on`, position: `top`, lines: 1},
+		{status: `on`, position: `bottom`, lines: 0},
+		{status: `off`, position: `top`, lines: 0},
+		{status: `3`, position: `top`, lines: 3},
+		{status: `3`, position: `bottom`, lines: 0},
+		{status: ``, position: ``, lines: 0}, // tmux < 3.3
+	}
+	for _, tt := range tests {
+		p := &TmuxPane{Status: tt.status, StatusPosition: tt.position}
+		assert.Equal(t, tt.lines, p.statusLinesAbove(), tt.status+` `+tt.position)
+	}
+}
+
+func TestTmuxAllowPassthrough(t *testing.T) {
+	tests := []struct {
+		option, want string
+	}{
+		{`0`, `off`}, // tmux 3.3 flag option
+		{`1`, `on`},
+		{`off`, `off`},
+		{`on`, `on`},
+		{`all`, `all`},
+		{``, ``}, // tmux < 3.3
+	}
+	for _, tt := range tests {
+		p := &TmuxPane{AllowPassthrough: tt.option}
+		assert.Equal(t, tt.want, p.allowPassthrough(), tt.option)
+	}
+}
+
+func TestAllowPassthroughOf(t *testing.T) {
+	pane := func(option string) *TmuxPane { return &TmuxPane{AllowPassthrough: option} }
+	tests := []struct {
+		name  string
+		panes []*TmuxPane
+		want  string
+	}{
+		{`no tmux`, nil, ``},
+		{`single`, []*TmuxPane{pane(`all`)}, `all`},
+		{`nested all`, []*TmuxPane{pane(`all`), pane(`all`)}, `all`},
+		{`inner all, outer on`, []*TmuxPane{pane(`all`), pane(`on`)}, `on`},
+		{`inner on, outer all`, []*TmuxPane{pane(`1`), pane(`all`)}, `on`},
+		{`any off`, []*TmuxPane{pane(`all`), pane(`0`), pane(`on`)}, `off`},
+		{`old tmux`, []*TmuxPane{pane(``), pane(`all`)}, `on`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, allowPassthroughOf(tt.panes), tt.name)
+	}
+}
@@ -0,0 +1,178 @@
+// Package qcache implements a persistent term.QueryCache under the XDG cache directory.
+//
+// Usage:
+//
+//	qc, err := qcache.New(``, qcache.DefaultTTL)
+//	...
+//	tm, err := term.NewTerminal(termimg.DefaultConfig, term.SetQueryCache(qc))
+package qcache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/term"
+)
+
+// DefaultTTL is the time after which a cached reply is queried again.
+const DefaultTTL = 7 * 24 * time.Hour
+
+var _ term.QueryCache = (*FileCache)(nil)
+
+// FileCache stores the replies for each terminal identity in a separate JSON file.
+type FileCache struct {
+	dir     string
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]map[string]entry // identity -> query -> entry
+}
+
+type entry struct {
+	Reply  string    `json:"reply"`
+	Stored time.Time `json:"stored"`
+}
+
+// New returns a cache storing its files in dir.
+// If dir is empty, a termimg directory in os.UserCacheDir() is used
+// ($XDG_CACHE_HOME/termimg on unix).
+// Entries older than ttl are ignored, a ttl <= 0 disables expiry.
+func New(dir string, ttl time.Duration) (*FileCache, error) {
+	if len(dir) == 0 {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, errors.New(err)
+		}
+		dir = filepath.Join(cacheDir, consts.LibraryName, `queries`)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.New(err)
+	}
+	return &FileCache{
+		dir:     dir,
+		ttl:     ttl,
+		entries: make(map[string]map[string]entry),
+	}, nil
+}
+
+// LoadReply ...
+func (c *FileCache) LoadReply(identity, qs string) (string, bool) {
+	if c == nil || len(identity) == 0 {
+		return ``, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.load(identity)[qs]
+	if !ok || c.expired(e) {
+		return ``, false
+	}
+	return e.Reply, true
+}
+
+// StoreReply ...
+func (c *FileCache) StoreReply(identity, qs, repl string) error {
+	if c == nil {
+		return errors.NilReceiver()
+	}
+	if len(identity) == 0 {
+		return errors.New(`empty terminal identity`)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := c.load(identity)
+	m[qs] = entry{Reply: repl, Stored: time.Now()}
+	for k, e := range m {
+		if c.expired(e) {
+			delete(m, k)
+		}
+	}
+	return c.save(identity, m)
+}
+
+// Invalidate removes all cached replies of the terminal identity.
+func (c *FileCache) Invalidate(identity string) error {
+	if c == nil {
+		return errors.NilReceiver()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, identity)
+	if err := os.Remove(c.filename(identity)); err != nil && !os.IsNotExist(err) {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// Clear removes all cached replies.
+func (c *FileCache) Clear() error {
+	if c == nil {
+		return errors.NilReceiver()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]map[string]entry)
+	files, err := filepath.Glob(filepath.Join(c.dir, `*.json`))
+	if err != nil {
+		return errors.New(err)
+	}
+	var errs []error
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *FileCache) filename(identity string) string {
+	return filepath.Join(c.dir, filepath.Base(identity)+`.json`)
+}
+
+func (c *FileCache) expired(e entry) bool {
+	return c.ttl > 0 && time.Since(e.Stored) > c.ttl
+}
+
+// load must be called with c.mu held.
+func (c *FileCache) load(identity string) map[string]entry {
+	if m, ok := c.entries[identity]; ok {
+		return m
+	}
+	m := make(map[string]entry)
+	b, err := os.ReadFile(c.filename(identity))
+	if err == nil {
+		_ = json.Unmarshal(b, &m) // start over on corrupt files
+	}
+	c.entries[identity] = m
+	return m
+}
+
+// save must be called with c.mu held.
+func (c *FileCache) save(identity string, m map[string]entry) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return errors.New(err)
+	}
+	// write to temporary file first for atomic replacement
+	f, err := os.CreateTemp(c.dir, filepath.Base(identity)+`.*.tmp`)
+	if err != nil {
+		return errors.New(err)
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return errors.New(err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return errors.New(err)
+	}
+	if err := os.Rename(f.Name(), c.filename(identity)); err != nil {
+		_ = os.Remove(f.Name())
+		return errors.New(err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package qcache_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/srlehn/termimg/internal/queries"
+	"github.com/srlehn/termimg/query/qcache"
+)
+
+func TestFileCachePersistence(t *testing.T) {
+	dir := t.TempDir()
+	id := `0123456789abcdef`
+	repl := queries.CSI + `?65;1;9c`
+
+	qc, err := qcache.New(dir, qcache.DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qc.StoreReply(id, queries.DA1, repl); err != nil {
+		t.Fatal(err)
+	}
+
+	// new instance reads from disk
+	qc2, err := qcache.New(dir, qcache.DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := qc2.LoadReply(id, queries.DA1)
+	assert.True(t, ok)
+	assert.Equal(t, repl, got)
+	_, ok = qc2.LoadReply(`fedcba9876543210`, queries.DA1)
+	assert.False(t, ok)
+
+	if err := qc2.Invalidate(id); err != nil {
+		t.Fatal(err)
+	}
+	_, ok = qc2.LoadReply(id, queries.DA1)
+	assert.False(t, ok)
+}
+
+func TestFileCacheTTL(t *testing.T) {
+	qc, err := qcache.New(t.TempDir(), time.Nanosecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qc.StoreReply(`id`, queries.DA2, queries.CSI+`>1;2;0c`); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	_, ok := qc.LoadReply(`id`, queries.DA2)
+	assert.False(t, ok)
+}
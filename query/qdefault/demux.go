@@ -0,0 +1,194 @@
+package qdefault
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+// replyDemuxer separates the replies to queries from the other input, e.g. key presses.
+// Replies received while a query is active are passed to it, late replies
+// to timed out queries are discarded, everything else is buffered as input.
+type replyDemuxer struct {
+	mu           sync.Mutex
+	inputCond    *sync.Cond
+	tok          parser.Tokenizer
+	active       bool
+	replies      []string
+	notify       chan struct{} // replies or progress of the active query
+	swallowUntil time.Time
+	inNonStd     bool // inside of a nonstandard reply
+	nonStdEnd    rune // terminator of the nonstandard reply
+	input        []byte
+	err          error
+	escDelay     time.Duration
+	escTimer     *time.Timer
+	escGen       uint64
+}
+
+func newReplyDemuxer(escDelay time.Duration) *replyDemuxer {
+	d := &replyDemuxer{
+		notify:   make(chan struct{}, 1),
+		escDelay: escDelay,
+	}
+	d.inputCond = sync.NewCond(&d.mu)
+	return d
+}
+
+// feed processes a rune read from the tty.
+func (d *replyDemuxer) feed(r rune) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.active {
+		// progress
+		d.signal()
+	}
+	for _, seq := range d.tok.Feed(r) {
+		d.route(seq)
+	}
+	if d.tok.Pending() == "\033" {
+		// an Escape key press isn't followed by further input
+		d.escGen++
+		gen := d.escGen
+		if d.escTimer != nil {
+			d.escTimer.Stop()
+		}
+		d.escTimer = time.AfterFunc(d.escDelay, func() { d.flushEscape(gen) })
+	}
+}
+
+func (d *replyDemuxer) flushEscape(gen uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if gen != d.escGen || d.tok.Pending() != "\033" {
+		return
+	}
+	d.tok.Reset()
+	d.addInput("\033")
+}
+
+func (d *replyDemuxer) route(seq parser.Sequence) {
+	isReply := parser.IsQueryReply(seq)
+	if d.inNonStd {
+		if seq.Type == parser.SeqText || seq.Type == parser.SeqControl {
+			isReply = true
+			d.inNonStd = seq.Raw != string(d.nonStdEnd)
+		} else {
+			d.inNonStd = false
+		}
+	} else if d.active {
+		// Terminology and iTerm2 replies continue after the sequence up to a terminator
+		switch {
+		case seq.Is(parser.SeqESC, 0, ``, '}'):
+			// Terminology: "\033}" ... "\000"
+			isReply, d.inNonStd, d.nonStdEnd = true, true, '\000'
+		case seq.Is(parser.SeqCSI, 0, ``, 'I') && len(seq.Params) == 0:
+			// iTerm2: "\033[ITERM2 3.5.0n", otherwise a focus event
+			isReply, d.inNonStd, d.nonStdEnd = true, true, 'n'
+		}
+	}
+	switch {
+	case !isReply:
+		d.addInput(seq.Raw)
+	case d.active:
+		d.replies = append(d.replies, seq.Raw)
+		d.signal()
+	case time.Now().Before(d.swallowUntil):
+		// late reply
+	default:
+		d.addInput(seq.Raw)
+	}
+}
+
+func (d *replyDemuxer) signal() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (d *replyDemuxer) addInput(s string) {
+	d.input = append(d.input, s...)
+	d.inputCond.Broadcast()
+}
+
+// fail stops the delivery after a read error.
+func (d *replyDemuxer) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.signal()
+	d.inputCond.Broadcast()
+}
+
+func (d *replyDemuxer) failed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err != nil
+}
+
+// begin starts a query.
+func (d *replyDemuxer) begin() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active = true
+	d.replies = nil
+	select {
+	case <-d.notify:
+	default:
+	}
+}
+
+// takeReplies returns the replies received since the last call
+// and the read error after which no further replies arrive.
+func (d *replyDemuxer) takeReplies() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	replies := d.replies
+	d.replies = nil
+	return replies, d.err
+}
+
+// end ends a query, replies arriving within swallow are discarded.
+func (d *replyDemuxer) end(swallow time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active = false
+	d.replies = nil
+	d.swallowUntil = time.Now().Add(swallow)
+}
+
+// readInput blocks until input is available.
+func (d *replyDemuxer) readInput(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.input) == 0 && d.err == nil {
+		d.inputCond.Wait()
+	}
+	if len(d.input) == 0 {
+		return 0, d.err
+	}
+	n := copy(p, d.input)
+	d.input = d.input[n:]
+	if len(d.input) == 0 {
+		d.input = nil
+	}
+	return n, nil
+}
+
+// close unblocks input reads.
+func (d *replyDemuxer) close() {
+	d.fail(os.ErrClosed)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.escTimer != nil {
+		d.escTimer.Stop()
+	}
+}
@@ -5,7 +5,9 @@
 package qdefault
 
 import (
+	"io"
 	"log"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,14 +26,18 @@ const (
 
 var _ term.Querier = (*querierDefault)(nil)
 var _ term.CachedQuerier = (*querierDefault)(nil)
+var _ term.BatchQuerier = (*querierDefault)(nil)
+var _ term.InputReader = (*querierDefault)(nil)
 
 func NewQuerier() term.Querier { return &querierDefault{} }
 
+// querierDefault keeps reading the tty after the first query.
+// Replies are separated from other input (replyDemuxer), which is buffered for ReadInput.
 type querierDefault struct {
 	muQuery         sync.Mutex
-	r               chan rune
-	drain           atomic.Value // bool
-	prevQueryFailed atomic.Value // bool
+	muRead          sync.Mutex
+	dmx             *replyDemuxer
+	prevQueryFailed atomic.Bool
 	logger          *log.Logger
 	timeOutInterval time.Duration
 	timeOutMax      time.Duration
@@ -43,68 +49,82 @@ func (q *querierDefault) Close() error {
 	if q == nil {
 		return nil
 	}
-	q.r = nil
-	drain, okDrain := q.drain.Load().(bool)
-	fail, okFail := q.prevQueryFailed.Load().(bool)
-	if (!okDrain || !drain) || (!okFail || fail) {
+	q.muRead.Lock()
+	dmx := q.dmx
+	q.muRead.Unlock()
+	if dmx == nil {
+		return nil
+	}
+	if q.prevQueryFailed.Load() {
+		// swallow late replies instead of leaving them to the shell
 		if q.closeWait == 0 {
 			q.closeWait = closeWaitDefault
 		}
 		time.Sleep(q.closeWait)
 	}
+	dmx.close()
 	return nil
 }
 
-func (q *querierDefault) startReading(tty term.TTY) {
+func (q *querierDefault) setDefaults() {
+	if q.timeOutMax == 0 {
+		q.timeOutMax = timeOutMaxDefault
+	}
+	if q.timeOutInterval == 0 {
+		// mlterm: avg: ~30µs, spikes: 1.5ms
+		// VTE-based terminals seem to take much longer
+		q.timeOutInterval = timeOutIntervalDefault
+	}
+}
+
+func (q *querierDefault) startReading(tty term.TTY) *replyDemuxer {
 	if q == nil {
 		panic(`nil receiver`)
 	}
-	if q.r != nil {
-		return
+	q.muRead.Lock()
+	defer q.muRead.Unlock()
+	if q.dmx != nil {
+		return q.dmx
 	}
-	q.r = make(chan rune)
+	q.setDefaults()
+	dmx := newReplyDemuxer(q.timeOutInterval)
+	q.dmx = dmx
 	runeReader := iointernal.NewRuneReader(tty)
 
 	go func() {
-		var (
-			rDr           rune
-			errDr         error
-			drain         bool
-			drainLeftOver bool
-		)
-
-	read:
 		for {
-			var r rune
-			var err error
-			if !drain && drainLeftOver {
-				r, err = rDr, errDr
-			} else {
-				// TODO use io.Reader
-				// (mattn/go-tty.TTY didn't provide a Read method)
-				r, _, err = runeReader.ReadRune()
-			}
-			if dr, ok := q.drain.Load().(bool); ok {
-				drain = dr
-			}
-			if drain {
-				rDr, errDr = r, err
-				drainLeftOver = true
+			// TODO use io.Reader
+			// (mattn/go-tty.TTY didn't provide a Read method)
+			r, _, err := runeReader.ReadRune()
+			if dmx.failed() {
+				return
 			}
-			if !drain && err != nil && q.logger != nil {
-				q.logger.Println(err)
-			}
-			if q.r == nil { // TODO guard this?
-				break read
-			}
-			if !drain {
-				select {
-				case q.r <- r:
-				case <-time.After(q.timeOutInterval):
+			if err != nil {
+				if errors.Is(err, io.EOF) || errors.Is(err, os.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+					dmx.fail(err)
+					return
+				}
+				// e.g. read deadlines
+				if q.logger != nil {
+					q.logger.Println(err)
 				}
+				continue
 			}
+			dmx.feed(r)
 		}
 	}()
+	return dmx
+}
+
+// ReadInput reads the input received outside of query replies, e.g. key presses.
+func (q *querierDefault) ReadInput(tty term.TTY, p []byte) (int, error) {
+	if q == nil {
+		return 0, errors.NilReceiver()
+	}
+	if tty == nil {
+		return 0, errors.NilParam()
+	}
+	return q.startReading(tty).readInput(p)
 }
 
 // Query ...
@@ -112,85 +132,89 @@ func (q *querierDefault) Query(qs string, tty term.TTY, p term.Parser) (string,
 	if q == nil {
 		return ``, errors.NilReceiver()
 	}
-	q.muQuery.Lock()
-	defer q.muQuery.Unlock()
-	q.startReading(tty)
-	q.drain.Store(false)
-	defer func() { q.drain.Store(true) }()
-	tty.Write([]byte(qs))
-	var (
-		repl        string
-		errRead     error
-		readStop    bool
-		time1       time.Time
-		readChan    = make(chan struct{}, 1)
-		timeChan    = make(chan struct{})
-		timeoutChan = make(chan struct{})
-	)
+	repl, err := q.query(qs, tty, p)
+	if err != nil {
+		return ``, err
+	}
+	return repl, nil
+}
 
-	if q.timeOutMax == 0 {
-		q.timeOutMax = timeOutMaxDefault
+// QueryBatch sends the queries in a single write followed by a DA1 sentinel.
+// On timeouts the replies received so far are returned.
+func (q *querierDefault) QueryBatch(tty term.TTY, batch ...term.BatchQuery) ([]term.BatchReply, error) {
+	if q == nil {
+		return nil, errors.NilReceiver()
 	}
-	if q.timeOutInterval == 0 {
-		// mlterm: avg: ~30µs, spikes: 1.5ms
-		// VTE-based terminals seem to take much longer
-		q.timeOutInterval = timeOutIntervalDefault
+	if len(batch) == 0 {
+		return nil, nil
 	}
+	dmx := term.NewBatchDemuxer(batch...)
+	_, err := q.query(dmx.Query(), tty, dmx)
+	replies := dmx.Replies()
+	if err != nil {
+		for _, repl := range replies {
+			if repl.Err == nil {
+				// partial success
+				return replies, nil
+			}
+		}
+		return replies, err
+	}
+	return replies, nil
+}
 
-	// stop reading if interval between single reads is too large
-	go func() {
-		for range timeChan {
-			time1 = time.Now()
-			go func(time2 time.Time) {
-				<-time.After(q.timeOutInterval)
-				if time1 == time2 { // time1 was not updated in q.timeOutInterval
-					timeoutChan <- struct{}{}
-				}
-			}(time1)
+// query returns the partial reply on errors
+func (q *querierDefault) query(qs string, tty term.TTY, p term.Parser) (repl string, err error) {
+	q.muQuery.Lock()
+	defer q.muQuery.Unlock()
+	dmx := q.startReading(tty)
+	dmx.begin()
+	failed := true
+	defer func() {
+		q.prevQueryFailed.Store(failed)
+		if failed {
+			// replies to a timed out query may still arrive
+			dmx.end(q.timeOutMax)
+		} else {
+			dmx.end(q.timeOutInterval)
 		}
 	}()
-	defer func() { timeChan = nil }()
+	if _, err := tty.Write([]byte(qs)); err != nil {
+		return ``, errors.New(err)
+	}
+
+	timerMax := time.NewTimer(q.timeOutMax)
+	defer timerMax.Stop()
+	// stop reading if interval between single reads is too large
+	timerInterval := time.NewTimer(q.timeOutInterval)
+	defer timerInterval.Stop()
 
-	readChan <- struct{}{}
-read:
 	for {
 		select {
-		case <-readChan:
-			timeChan <- struct{}{}
-			if errRead != nil {
-				return ``, errRead
+		case <-dmx.notify:
+			timerInterval.Reset(q.timeOutInterval)
+			replies, errRead := dmx.takeReplies()
+			for _, reply := range replies {
+				for _, r := range reply {
+					repl += string(r)
+					if p != nil && p.Parse(r) {
+						failed = false
+						return repl, nil
+					}
+				}
 			}
-			if readStop {
-				break read
+			if errRead != nil {
+				return repl, errRead
 			}
-			go func() {
-				r, ok := <-q.r
-				if !ok {
-					q.r = nil
-					errRead = errors.New(`tty read chan closed`)
-					return
-				}
-				timeChan <- struct{}{}
-				repl += string(r)
-				readStop = p != nil && p.Parse(r)
-				readChan <- struct{}{}
-			}()
-		case <-time.After(q.timeOutMax):
-			q.prevQueryFailed.Store(true)
-			return ``, errors.New(`time out`)
-		case <-timeoutChan:
+		case <-timerMax.C:
+			return repl, errors.New(`time out`)
+		case <-timerInterval.C:
 			if p == nil {
-				break read
-			} else {
-				q.prevQueryFailed.Store(true)
-				return ``, errors.New(consts.ErrTimeoutInterval)
+				return repl, nil
 			}
+			return repl, errors.New(consts.ErrTimeoutInterval)
 		}
 	}
-
-	q.prevQueryFailed.Store(p == nil)
-
-	return repl, nil
 }
 
 // CachedQuery ...
@@ -1,14 +1,19 @@
 package qdefault_test
 
 import (
+	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/srlehn/termimg/internal/consts"
 	"github.com/srlehn/termimg/internal/dummytty"
 	"github.com/srlehn/termimg/internal/parser"
 	"github.com/srlehn/termimg/internal/queries"
 	"github.com/srlehn/termimg/query/qdefault"
+	"github.com/srlehn/termimg/term"
 )
 
 func TestQDefaultQuery(t *testing.T) {
@@ -25,3 +30,115 @@ func TestQDefaultQuery(t *testing.T) {
 	}
 	assert.Equal(t, replDummy, repl)
 }
+
+func TestQDefaultQuery8BitCSI(t *testing.T) {
+	// raw 8-bit CSI (0x9B), not UTF-8 encoded
+	tty, err := dummytty.New("\x9b?65;1;9c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qu := qdefault.NewQuerier()
+	repl, err := qu.Query(queries.DA1, tty, parser.StopOnC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "\u009b?65;1;9c", repl)
+}
+
+func TestQDefaultQueryBatch(t *testing.T) {
+	// no reply to DA3, key press before the replies
+	replDummy := `k` + queries.CSI + `>1;10;0c` + queries.DCS + `>|XTerm(390)` + queries.ST + queries.CSI + `?65;1;9c`
+	tty, err := dummytty.New(replDummy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qu := qdefault.NewQuerier()
+	replies, err := term.QueryBatch(qu, tty,
+		term.BatchQuery{Query: queries.DA2, ReplyPrefixes: []string{queries.CSI + `>`}},
+		term.BatchQuery{Query: queries.DA3, ReplyPrefixes: []string{queries.DCS + `!|`}},
+		term.BatchQuery{Query: queries.XTVERSION, ReplyPrefixes: []string{queries.DCS + `>|`}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, replies, 3) {
+		assert.Equal(t, queries.CSI+`>1;10;0c`, replies[0].Reply)
+		assert.NoError(t, replies[0].Err)
+		assert.ErrorIs(t, replies[1].Err, consts.ErrQueryUnsupported)
+		assert.Equal(t, queries.DCS+`>|XTerm(390)`+queries.ST, replies[2].Reply)
+		assert.NoError(t, replies[2].Err)
+	}
+}
+
+func TestQDefaultQueryBatchDA1Sentinel(t *testing.T) {
+	// a trailing DA1 query is the sentinel and must not be sent twice
+	batch := []term.BatchQuery{
+		{Query: queries.DA2, ReplyPrefixes: []string{queries.CSI + `>`}},
+		{Query: queries.DA1},
+	}
+	assert.Equal(t, queries.DA2+queries.DA1, term.NewBatchDemuxer(batch...).Query())
+
+	replDummy := queries.CSI + `>1;10;0c` + queries.CSI + `?65;1;9c`
+	tty, err := dummytty.New(replDummy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies, err := term.QueryBatch(qdefault.NewQuerier(), tty, batch...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, replies, 2) {
+		assert.Equal(t, queries.CSI+`>1;10;0c`, replies[0].Reply)
+		assert.Equal(t, queries.CSI+`?65;1;9c`, replies[1].Reply)
+		assert.NoError(t, replies[1].Err)
+	}
+}
+
+// pipeTTY is read from the terminal side of a pipe.
+type pipeTTY struct{ *io.PipeReader }
+
+func (pipeTTY) Write(b []byte) (int, error) { return len(b), nil }
+func (pipeTTY) TTYDevName() string          { return `pipe` }
+
+func TestQDefaultInputDemux(t *testing.T) {
+	rd, wr := io.Pipe()
+	tty := pipeTTY{PipeReader: rd}
+	qu := qdefault.NewQuerier()
+	ir, ok := qu.(term.InputReader)
+	require.True(t, ok)
+
+	// key presses while the terminal answers
+	go func() { wr.Write([]byte(`k` + queries.CSI + `?65;1;9c`)) }()
+	repl, err := qu.Query(queries.DA1, tty, parser.StopOnC)
+	require.NoError(t, err)
+	assert.Equal(t, queries.CSI+`?65;1;9c`, repl)
+
+	// late reply to a timed out query
+	_, err = qu.Query(queries.DA1, tty, parser.StopOnC)
+	require.Error(t, err)
+	go func() { wr.Write([]byte(queries.CSI + `?65;1;9c` + `ey`)) }()
+
+	b := make([]byte, 3)
+	n, err := io.ReadAtLeast(readerFunc(func(p []byte) (int, error) { return ir.ReadInput(tty, p) }), b, 3)
+	require.NoError(t, err)
+	assert.Equal(t, `key`, string(b[:n]))
+
+	// Escape key
+	go func() { wr.Write([]byte("\033")) }()
+	done := make(chan string, 1)
+	go func() {
+		n, _ := ir.ReadInput(tty, b)
+		done <- string(b[:n])
+	}()
+	select {
+	case s := <-done:
+		assert.Equal(t, "\033", s)
+	case <-time.After(time.Second):
+		t.Fatal(`Escape key held back`)
+	}
+	wr.Close()
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
@@ -0,0 +1,229 @@
+package term
+
+import (
+	"strings"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/parser"
+	"github.com/srlehn/termimg/internal/queries"
+)
+
+// BatchQuery is a single query of a batch sent with QueryBatch.
+type BatchQuery struct {
+	Query string
+	// Parser reports the end of the reply (optional).
+	// The reply ends with the first escape sequence during which Parser returns true.
+	// Without Parser the reply consists of a single escape sequence.
+	Parser Parser
+	// ReplyPrefixes are the possible starts of the reply (optional),
+	// e.g. CSI+">" for DA2. They are used for assigning replies to queries
+	// when the terminal skips unsupported queries.
+	// Replies in the format of DA1 (CSI ? Ps c) are only assigned to queries with
+	// a matching prefix, otherwise they are taken for the DA1 sentinel.
+	ReplyPrefixes []string
+}
+
+func (bq BatchQuery) matches(seq string, isDA1Repl bool) bool {
+	if len(bq.ReplyPrefixes) == 0 {
+		return !isDA1Repl
+	}
+	for _, prefix := range bq.ReplyPrefixes {
+		if strings.HasPrefix(seq, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// BatchReply is the reply to a BatchQuery.
+type BatchReply struct {
+	Reply string
+	// Err is consts.ErrQueryUnsupported if the terminal didn't reply before
+	// answering the DA1 sentinel.
+	Err error
+}
+
+// BatchQuerier is implemented by Queriers that send multiple queries in a single write.
+type BatchQuerier interface {
+	QueryBatch(tty TTY, batch ...BatchQuery) ([]BatchReply, error)
+}
+
+// QueryBatch sends all queries at once followed by a DA1 query as sentinel.
+// As terminals reply in order and every terminal answers DA1, queries without reply
+// are marked as unsupported as soon as the DA1 reply arrives instead of waiting for a timeout.
+// A DA1 query at the end of the batch isn't sent twice, it receives the sentinel reply.
+// Replies received before an error are returned together with the error.
+func QueryBatch(qu Querier, tty TTY, batch ...BatchQuery) ([]BatchReply, error) {
+	if qu == nil || tty == nil {
+		return nil, errors.NilParam()
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+	if bq, ok := qu.(BatchQuerier); ok {
+		return bq.QueryBatch(tty, batch...)
+	}
+	dmx := NewBatchDemuxer(batch...)
+	_, err := qu.Query(dmx.Query(), tty, dmx)
+	return dmx.Replies(), err
+}
+
+var _ Parser = (*BatchDemuxer)(nil)
+
+// BatchDemuxer is a Parser that assigns the replies to a query batch to the single queries.
+// Parse returns true when the reply to the DA1 sentinel was received.
+type BatchDemuxer struct {
+	batch       []BatchQuery
+	replies     []BatchReply
+	answered    []bool
+	cur         int // first query without reply
+	active      int // query with an incomplete multi-sequence reply, -1 if none
+	tok         parser.Tokenizer
+	unsolicited []Sequence
+	done        bool
+	sentinel    bool // the last query is DA1 and serves as sentinel
+}
+
+// NewBatchDemuxer ...
+func NewBatchDemuxer(batch ...BatchQuery) *BatchDemuxer {
+	return &BatchDemuxer{
+		batch:    batch,
+		replies:  make([]BatchReply, len(batch)),
+		answered: make([]bool, len(batch)),
+		active:   -1,
+		sentinel: len(batch) > 0 && batch[len(batch)-1].Query == queries.DA1,
+	}
+}
+
+// Query returns the concatenated queries followed by the DA1 sentinel.
+func (d *BatchDemuxer) Query() string {
+	if d == nil {
+		return ``
+	}
+	b := &strings.Builder{}
+	for _, bq := range d.batch {
+		b.WriteString(bq.Query)
+	}
+	if !d.sentinel {
+		b.WriteString(queries.DA1)
+	}
+	return b.String()
+}
+
+// Done reports whether the reply to the DA1 sentinel was received.
+func (d *BatchDemuxer) Done() bool { return d != nil && d.done }
+
+// Replies returns the replies in the order of the queries.
+// Queries without reply are marked unsupported if the sentinel was received.
+func (d *BatchDemuxer) Replies() []BatchReply {
+	if d == nil {
+		return nil
+	}
+	replies := make([]BatchReply, len(d.replies))
+	copy(replies, d.replies)
+	for i := range replies {
+		if d.answered[i] {
+			continue
+		}
+		if d.done {
+			replies[i].Err = consts.ErrQueryUnsupported
+		} else {
+			replies[i].Err = consts.ErrTimeoutInterval
+		}
+	}
+	return replies
+}
+
+// Unsolicited returns the input which isn't part of any reply, e.g. key presses.
+func (d *BatchDemuxer) Unsolicited() []Sequence {
+	if d == nil {
+		return nil
+	}
+	return d.unsolicited
+}
+
+// Parse ...
+func (d *BatchDemuxer) Parse(r rune) bool {
+	if d == nil || d.done {
+		return true
+	}
+	for _, seq := range d.tok.Feed(r) {
+		if d.done || !seq.IsReply() {
+			// bytes outside of escape sequences are not part of any reply
+			d.unsolicited = append(d.unsolicited, seq)
+			continue
+		}
+		d.dispatch(seq)
+	}
+	return d.done
+}
+
+// dispatch assigns a complete escape sequence.
+func (d *BatchDemuxer) dispatch(seq Sequence) {
+	raw := sevenBitSequence(seq)
+	if d.active >= 0 {
+		d.feed(d.active, raw)
+		return
+	}
+	isDA1Repl := parser.IsDA1Reply(seq)
+	last := len(d.batch)
+	if d.sentinel {
+		last--
+	}
+	for i := d.cur; i < last; i++ {
+		if !d.batch[i].matches(raw, isDA1Repl) {
+			continue
+		}
+		// preceding queries were skipped by the terminal
+		d.cur = i
+		d.feed(i, raw)
+		return
+	}
+	if isDA1Repl {
+		if d.sentinel {
+			d.feed(last, raw)
+		}
+		d.done = true
+		return
+	}
+	d.unsolicited = append(d.unsolicited, seq)
+}
+
+// sevenBitSequence returns the raw sequence with 8-bit C1 introducer and terminator
+// replaced by their 7-bit equivalents.
+func sevenBitSequence(seq Sequence) string {
+	raw := seq.Raw
+	for c1, esc := range map[string]string{
+		"\u009b": queries.CSI, "\u0090": queries.DCS, "\u009d": queries.ESC + `]`,
+		"\u0098": queries.ESC + `X`, "\u009e": queries.ESC + `^`, "\u009f": queries.ESC + `_`,
+	} {
+		if r, found := strings.CutPrefix(raw, c1); found {
+			raw = esc + r
+			break
+		}
+	}
+	if r, found := strings.CutSuffix(raw, "\u009c"); found {
+		raw = r + queries.ST
+	}
+	return raw
+}
+
+func (d *BatchDemuxer) feed(i int, seq string) {
+	d.replies[i].Reply += seq
+	complete := d.batch[i].Parser == nil
+	if !complete {
+		for _, r := range seq {
+			if d.batch[i].Parser.Parse(r) {
+				complete = true
+			}
+		}
+	}
+	if complete {
+		d.answered[i] = true
+		d.active = -1
+		d.cur = i + 1
+	} else {
+		d.active = i
+	}
+}
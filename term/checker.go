@@ -211,16 +211,28 @@ func (c *termCheckerCore) NewTerminal(opts ...Option) (*Terminal, error) {
 		}
 	}
 
+	tm.setupMuxPassthrough()
+
 	drCkInp := &drawerCheckerInput{
 		Properties: tm.properties,
-		Querier:    tm.querier,
-		TTY:        tm.tty,
+		Querier:    newCtxQuerier(tm.detectionCtx, tm.querier),
+		TTY:        tm.queryTTY(),
 		w:          w,
 		name:       c.parent.Name(),
 	}
-	drawers, drProps, err := drawersFor(drCkInp)
-	if logx.IsErr(err, tm, slog.LevelInfo) {
-		return nil, err
+	var drawers []Drawer
+	var drProps Properties
+	if drawersStored, ok := storedDrawers(tm.properties); ok {
+		drawers = drawersStored
+	} else {
+		drs, prs, err := drawersFor(tm.detectionCtx, drCkInp)
+		if len(drs) == 0 && logx.IsErr(err, tm, slog.LevelInfo) {
+			return nil, err
+		}
+		if err != nil {
+			logx.Info(`drawer detection interrupted, using the drawers found so far`, tm, `error`, err, `drawers`, len(drs))
+		}
+		drawers, drProps = drs, prs
 	}
 	if len(drawers) == 0 {
 		// TODO one drawer should always be provided!
@@ -341,6 +353,27 @@ func (c *termCheckerCore) NewTerminal(opts ...Option) (*Terminal, error) {
 	return tm, nil
 }
 
+// storedDrawers returns the drawers listed in a saved profile if querying is disabled.
+func storedDrawers(pr Properties) ([]Drawer, bool) {
+	if pr == nil {
+		return nil, false
+	}
+	if noQuery, ok := pr.Property(propkeys.NoQuery); !ok || noQuery != `true` {
+		return nil, false
+	}
+	drNamesStr, ok := pr.Property(propkeys.ProfileDrawers)
+	if !ok || len(drNamesStr) == 0 {
+		return nil, false
+	}
+	var drs []Drawer
+	for _, drName := range strings.Split(drNamesStr, `,`) {
+		if dr := GetRegDrawerByName(drName); dr != nil {
+			drs = append(drs, dr)
+		}
+	}
+	return drs, len(drs) > 0
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 func termGenericPreCheck(pr Properties) {
@@ -366,6 +399,9 @@ func termGenericCheck(tty TTY, qu Querier, pr Properties) {
 	if _, avoidANSI := pr.Property(propkeys.AvoidANSI); avoidANSI {
 		return
 	}
+	// single round trip, the sequential queries below are only sent
+	// for the properties that are still missing
+	_ = queryIdentificationBatch(qu, tty, pr, pr)
 	_ = QueryDeviceAttributes(qu, tty, pr, pr)
 	if _, avoidTCap := pr.Property(propkeys.AvoidTCap); !avoidTCap {
 		for _, spcl := range xtGetTCapSpecialStrs {
@@ -0,0 +1,222 @@
+package term
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// damageFullRatio is the share of changed cells above which the whole canvas is redrawn.
+// Each changed region is sent as an image of its own, for large changes this costs more
+// than it saves.
+const damageFullRatio = 0.5
+
+// Invalidate forgets the pixels on screen, the next Draw redraws the whole canvas,
+// e.g. after the screen was erased.
+func (c *Canvas) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.drawn = nil
+	n := c.bounds.Dx() * c.bounds.Dy()
+	if n < 0 {
+		n = 0
+	}
+	if len(c.dirty) != n {
+		c.dirty = make([]bool, n)
+	} else {
+		clear(c.dirty)
+	}
+}
+
+// markDirty marks the cell of the canvas pixel x, y as changed.
+func (c *Canvas) markDirty(x, y int) {
+	if c.drawn == nil {
+		return
+	}
+	cx, cy := c.cellOf(x, y)
+	if i := cy*c.bounds.Dx() + cx; i >= 0 && i < len(c.dirty) {
+		c.dirty[i] = true
+	}
+}
+
+// cellOf returns the cell of the canvas containing the canvas pixel x, y.
+func (c *Canvas) cellOf(x, y int) (cx, cy int) {
+	if c.cellW <= 0 || c.cellH <= 0 {
+		return 0, 0
+	}
+	cx = int(float64(x+c.boundsPixels.Min.X)/c.cellW) - c.bounds.Min.X
+	cy = int(float64(y+c.boundsPixels.Min.Y)/c.cellH) - c.bounds.Min.Y
+	return min(max(cx, 0), c.bounds.Dx()-1), min(max(cy, 0), c.bounds.Dy()-1)
+}
+
+// cellPixels returns the canvas pixels of the canvas cells r.
+func (c *Canvas) cellPixels(r image.Rectangle) image.Rectangle {
+	r = r.Add(c.bounds.Min)
+	px := image.Rect(
+		int(float64(r.Min.X)*c.cellW), int(float64(r.Min.Y)*c.cellH),
+		int(float64(r.Max.X)*c.cellW), int(float64(r.Max.Y)*c.cellH),
+	)
+	return px.Sub(c.boundsPixels.Min).Intersect(c.Bounds())
+}
+
+// damage returns the regions of canvas cells changed since the last draw.
+// ok is false if the whole canvas has to be drawn.
+func (c *Canvas) damage(img image.Image) (cells []image.Rectangle, ok bool) {
+	if c.drawn == nil {
+		return nil, false
+	}
+	if size, ok := sizeOf(img); !ok || size != c.drawn.Bounds().Size() || size != c.Bounds().Size() {
+		return nil, false
+	}
+	w, h := c.bounds.Dx(), c.bounds.Dy()
+	if w <= 0 || h <= 0 || len(c.dirty) != w*h {
+		return nil, false
+	}
+	dirty := c.dirty
+	if img != c.drawing || c.dirtyUnknown {
+		// compare the image with the pixels on screen
+		src := toRGBA(img)
+		dirty = make([]bool, w*h)
+		for cy := range h {
+			for cx := range w {
+				r := c.cellPixels(image.Rect(cx, cy, cx+1, cy+1))
+				dirty[cy*w+cx] = !rgbaEqual(src, c.drawn, r)
+			}
+		}
+	}
+	var n int
+	for _, d := range dirty {
+		if d {
+			n++
+		}
+	}
+	if float64(n) > damageFullRatio*float64(w*h) {
+		return nil, false
+	}
+	return dirtyRegions(dirty, w, h), true
+}
+
+// regionDrawer is implemented by drawers whose images stay addressable in the terminal (kitty).
+// DrawRegion replaces the pixels in region of the image drawn last into the cells of bounds
+// with the ones of img, which has the size of that image.
+// The changed cells are drawn as images of their own with the other drawers.
+type regionDrawer interface {
+	DrawRegion(img image.Image, region, bounds image.Rectangle, tm *Terminal) error
+}
+
+// drawCells draws the regions of canvas cells of img.
+func (c *Canvas) drawCells(img image.Image, cells []image.Rectangle) error {
+	src := toRGBA(img)
+	rd, _ := c.drawnWith.(regionDrawer)
+	for _, r := range cells {
+		px := c.cellPixels(r).Add(src.Rect.Min)
+		var err error
+		if rd != nil {
+			err = rd.DrawRegion(src, px, c.bounds, c.terminal)
+		} else {
+			err = c.drawAt(src.SubImage(px), r.Add(c.bounds.Min))
+		}
+		if err != nil {
+			c.Invalidate()
+			return err
+		}
+	}
+	c.remember(src, cells)
+	return nil
+}
+
+// remember stores the pixels of img drawn in the regions of canvas cells, all for nil cells.
+func (c *Canvas) remember(img image.Image, cells []image.Rectangle) {
+	size := c.Bounds().Size()
+	if sz, ok := sizeOf(img); !ok || sz != size {
+		c.Invalidate()
+		return
+	}
+	if c.drawn == nil || c.drawn.Bounds().Size() != size {
+		c.drawn = image.NewRGBA(image.Rectangle{Max: size})
+		cells = nil
+	}
+	if cells == nil {
+		draw.Draw(c.drawn, c.drawn.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	for _, r := range cells {
+		px := c.cellPixels(r)
+		draw.Draw(c.drawn, px, img, img.Bounds().Min.Add(px.Min), draw.Src)
+	}
+	clear(c.dirty)
+	c.dirtyUnknown = false
+}
+
+// dirtyRegions merges the changed cells of a w x h grid into rectangles:
+// runs of cells in a row, stacked when the rows below have the same run.
+func dirtyRegions(dirty []bool, w, h int) []image.Rectangle {
+	var rects []image.Rectangle
+	open := make(map[[2]int]int) // run → index in rects, for the previous row
+	for y := range h {
+		next := make(map[[2]int]int)
+		for x := 0; x < w; {
+			if !dirty[y*w+x] {
+				x++
+				continue
+			}
+			x0 := x
+			for x < w && dirty[y*w+x] {
+				x++
+			}
+			run := [2]int{x0, x}
+			if i, ok := open[run]; ok {
+				rects[i].Max.Y = y + 1
+				next[run] = i
+				continue
+			}
+			rects = append(rects, image.Rect(x0, y, x, y+1))
+			next[run] = len(rects) - 1
+		}
+		open = next
+	}
+	return rects
+}
+
+// sizeOf returns the pixel size of img without decoding a *Image.
+func sizeOf(img image.Image) (image.Point, bool) {
+	switch img := img.(type) {
+	case nil:
+		return image.Point{}, false
+	case *Image:
+		if img == nil || img.Original == nil {
+			return image.Point{}, false
+		}
+		return img.Original.Bounds().Size(), true
+	default:
+		return img.Bounds().Size(), true
+	}
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// rgbaEqual reports whether the pixels of r (relative to the bounds of the images) are equal.
+func rgbaEqual(a, b *image.RGBA, r image.Rectangle) bool {
+	ra, rb := r.Add(a.Rect.Min), r.Add(b.Rect.Min)
+	for y := 0; y < r.Dy(); y++ {
+		ia, ib := a.PixOffset(ra.Min.X, ra.Min.Y+y), b.PixOffset(rb.Min.X, rb.Min.Y+y)
+		n := 4 * r.Dx()
+		if !bytes.Equal(a.Pix[ia:ia+n], b.Pix[ib:ib+n]) {
+			return false
+		}
+	}
+	return true
+}
+
+func colorEqual(a, b color.Color) bool {
+	return color.RGBAModel.Convert(a) == color.RGBAModel.Convert(b)
+}
@@ -0,0 +1,99 @@
+package term
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirtyRegions(t *testing.T) {
+	tests := []struct {
+		name  string
+		dirty []string
+		want  []image.Rectangle
+	}{
+		{`clean`, []string{`....`, `....`}, nil},
+		{`single cell`, []string{`..x.`, `....`}, []image.Rectangle{image.Rect(2, 0, 3, 1)}},
+		{`run`, []string{`.xxx`, `....`}, []image.Rectangle{image.Rect(1, 0, 4, 1)}},
+		{`stacked runs`, []string{`.xx.`, `.xx.`, `....`}, []image.Rectangle{image.Rect(1, 0, 3, 2)}},
+		{`differing runs`, []string{`xx..`, `xxx.`}, []image.Rectangle{image.Rect(0, 0, 2, 1), image.Rect(0, 1, 3, 2)}},
+		{`interrupted stack`, []string{`x...`, `....`, `x...`}, []image.Rectangle{image.Rect(0, 0, 1, 1), image.Rect(0, 2, 1, 3)}},
+		{`two runs in a row`, []string{`x.xx`, `x.xx`}, []image.Rectangle{image.Rect(0, 0, 1, 2), image.Rect(2, 0, 4, 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := len(tt.dirty[0]), len(tt.dirty)
+			dirty := make([]bool, 0, w*h)
+			for _, row := range tt.dirty {
+				for _, c := range row {
+					dirty = append(dirty, c == 'x')
+				}
+			}
+			assert.Equal(t, tt.want, dirtyRegions(dirty, w, h))
+		})
+	}
+}
+
+// newDamageCanvas returns a canvas of 4 x 2 cells with 2 x 2 pixels per cell.
+func newDamageCanvas() *Canvas {
+	c := &Canvas{
+		bounds:       image.Rect(0, 0, 4, 2),
+		boundsPixels: image.Rect(0, 0, 8, 4),
+		cellW:        2,
+		cellH:        2,
+	}
+	c.Invalidate()
+	return c
+}
+
+func TestDamage(t *testing.T) {
+	c := newDamageCanvas()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+
+	_, ok := c.damage(img)
+	assert.False(t, ok, `nothing drawn yet`)
+
+	c.remember(img, nil)
+	cells, ok := c.damage(img)
+	assert.True(t, ok)
+	assert.Empty(t, cells)
+
+	changed := image.NewRGBA(img.Rect)
+	changed.Set(3, 1, color.White) // cell 1, 0
+	changed.Set(7, 3, color.White) // cell 3, 1
+	cells, ok = c.damage(changed)
+	assert.True(t, ok)
+	assert.Equal(t, []image.Rectangle{image.Rect(1, 0, 2, 1), image.Rect(3, 1, 4, 2)}, cells)
+
+	c.remember(changed, cells)
+	cells, ok = c.damage(changed)
+	assert.True(t, ok)
+	assert.Empty(t, cells, `changed cells are remembered`)
+
+	mostly := image.NewRGBA(img.Rect)
+	for x := range 8 {
+		mostly.Set(x, 0, color.White)
+		mostly.Set(x, 2, color.White)
+	}
+	_, ok = c.damage(mostly)
+	assert.False(t, ok, `most cells changed`)
+
+	_, ok = c.damage(image.NewRGBA(image.Rect(0, 0, 6, 4)))
+	assert.False(t, ok, `size differs`)
+
+	c.Invalidate()
+	_, ok = c.damage(changed)
+	assert.False(t, ok, `invalidated`)
+}
+
+func TestDamageSetCells(t *testing.T) {
+	c := newDamageCanvas()
+	c.drawing = image.NewRGBA(image.Rect(0, 0, 8, 4))
+	c.remember(c.drawing, nil)
+	c.markDirty(5, 2) // cell 2, 1
+	cells, ok := c.damage(c.drawing)
+	assert.True(t, ok)
+	assert.Equal(t, []image.Rectangle{image.Rect(2, 1, 3, 2)}, cells)
+}
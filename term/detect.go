@@ -0,0 +1,226 @@
+package term
+
+import (
+	"context"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/logx"
+	"github.com/srlehn/termimg/internal/propkeys"
+	"github.com/srlehn/termimg/internal/queries"
+)
+
+var _ Querier = (*ctxQuerier)(nil)
+var _ BatchQuerier = (*ctxQuerier)(nil)
+
+// ctxQuerier refuses to send further queries once the detection context is done
+// and stops waiting for the reply of a running query.
+type ctxQuerier struct {
+	Querier
+	ctx context.Context
+}
+
+func newCtxQuerier(ctx context.Context, qu Querier) Querier {
+	if ctx == nil || qu == nil || ctx.Done() == nil {
+		return qu
+	}
+	return &ctxQuerier{Querier: qu, ctx: ctx}
+}
+
+func (q *ctxQuerier) Query(qs string, tty TTY, p Parser) (string, error) {
+	if q == nil || q.Querier == nil {
+		return ``, errors.NilReceiver()
+	}
+	if err := q.ctx.Err(); err != nil {
+		return ``, errors.New(err)
+	}
+	type result struct {
+		repl string
+		err  error
+	}
+	var g parserGuard
+	done := make(chan result, 1)
+	go func() {
+		repl, err := q.Querier.Query(qs, tty, g.wrap(p))
+		done <- result{repl: repl, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.repl, res.err
+	case <-q.ctx.Done():
+		g.abandon()
+		return ``, errors.New(q.ctx.Err())
+	}
+}
+
+// QueryBatch forwards the batch to the wrapped Querier like Query.
+func (q *ctxQuerier) QueryBatch(tty TTY, batch ...BatchQuery) ([]BatchReply, error) {
+	if q == nil || q.Querier == nil {
+		return nil, errors.NilReceiver()
+	}
+	if err := q.ctx.Err(); err != nil {
+		return nil, errors.New(err)
+	}
+	type result struct {
+		replies []BatchReply
+		err     error
+	}
+	var g parserGuard
+	guarded := make([]BatchQuery, len(batch))
+	for i, bq := range batch {
+		bq.Parser = g.wrap(bq.Parser)
+		guarded[i] = bq
+	}
+	done := make(chan result, 1)
+	go func() {
+		replies, err := QueryBatch(q.Querier, tty, guarded...)
+		done <- result{replies: replies, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.replies, res.err
+	case <-q.ctx.Done():
+		g.abandon()
+		return nil, errors.New(q.ctx.Err())
+	}
+}
+
+// parserGuard stops feeding the parsers of an abandoned query.
+// The query keeps running until the querier times out, the caller owns the parsers again.
+type parserGuard struct {
+	mu        sync.Mutex
+	abandoned bool
+}
+
+func (g *parserGuard) wrap(p Parser) Parser {
+	if p == nil {
+		return nil
+	}
+	return ParserFunc(func(r rune) bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.abandoned {
+			return true
+		}
+		return p.Parse(r)
+	})
+}
+
+func (g *parserGuard) abandon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.abandoned = true
+}
+
+// Unwrap returns the wrapped Querier.
+func (q *ctxQuerier) Unwrap() Querier {
+	if q == nil {
+		return nil
+	}
+	return q.Querier
+}
+
+// checkExcludeAll runs the query-less CheckExclude methods concurrently.
+// The properties are merged in checker order.
+func checkExcludeAll(terminalCheckers []TermChecker, env Properties, logger logx.LoggerProvider) Properties {
+	prs := make([]Properties, len(terminalCheckers))
+	var wg sync.WaitGroup
+	for i, tchk := range terminalCheckers {
+		if tchk == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					logx.IsErr(errors.New(r), logger, slog.LevelError, `checker`, tchk.Name())
+				}
+			}()
+			_, prs[i] = tchk.CheckExclude(environ.CloneProperties(env))
+		}()
+	}
+	wg.Wait()
+	pr := environ.NewProperties()
+	for _, prE := range prs {
+		pr.MergeProperties(prE)
+	}
+	return pr
+}
+
+// queryIdentificationBatch sends the generic identification queries
+// (DA1, DA2, DA3, XTGETTCAP, XTVERSION) with QueryBatch in a single write.
+// Only one round trip is required and unsupported queries don't cost a timeout.
+func queryIdentificationBatch(qu Querier, tty TTY, prIn, prOut Properties) error {
+	if qu == nil || tty == nil || prIn == nil || prOut == nil {
+		return errors.NilParam()
+	}
+	if _, avoidDA1 := prIn.Property(propkeys.AvoidDA1); avoidDA1 {
+		return errors.New(`DA1 sentinel unavailable`)
+	}
+	_, avoidDA2 := prIn.Property(propkeys.AvoidDA2)
+	_, avoidDA3 := prIn.Property(propkeys.AvoidDA3)
+	_, avoidTCap := prIn.Property(propkeys.AvoidTCap)
+
+	var batch []BatchQuery
+	if !avoidDA2 {
+		batch = append(batch, BatchQuery{Query: queries.DA2, ReplyPrefixes: []string{queries.CSI + `>`}})
+	}
+	if !avoidDA3 {
+		batch = append(batch, BatchQuery{Query: queries.DA3, ReplyPrefixes: []string{queries.DCS + `!|`}})
+	}
+	tcaps := make(map[int]string) // batch index -> capability name
+	for _, tcap := range xtGetTCapSpecialStrs {
+		if avoidTCap {
+			break
+		}
+		tcaps[len(batch)] = tcap
+		batch = append(batch, BatchQuery{
+			Query:         queries.DCS + `+q` + strings.ToUpper(hex.EncodeToString([]byte(tcap))) + queries.ST,
+			ReplyPrefixes: []string{queries.DCS + `1+r`, queries.DCS + `0+r`},
+		})
+	}
+	batch = append(batch, BatchQuery{Query: queries.XTVERSION, ReplyPrefixes: []string{queries.DCS + `>|`}})
+	// DA1 last: QueryBatch doesn't repeat it and assigns it the sentinel reply
+	batch = append(batch, BatchQuery{Query: queries.DA1})
+
+	replies, err := QueryBatch(qu, tty, batch...)
+	if err != nil {
+		return err
+	}
+
+	for i, bq := range batch {
+		repl := replies[i]
+		if repl.Err != nil && !errors.Is(repl.Err, consts.ErrQueryUnsupported) {
+			continue
+		}
+		switch bq.Query {
+		case queries.DA1:
+			extractDA1(repl.Reply, prOut)
+		case queries.DA2:
+			extractDA2(repl.Reply, prOut)
+		case queries.DA3:
+			extractDA3(repl.Reply, prOut)
+		case queries.XTVERSION:
+			// empty if unsupported
+			xtVer, _ := extractXTVersion(repl.Reply)
+			prOut.SetProperty(propkeys.XTVERSION, xtVer)
+		default:
+			if tcap, isTCap := tcaps[i]; isTCap {
+				// empty reply if unsupported
+				_, _ = extractXTGetTCap(tcap, repl.Reply, prOut)
+			}
+		}
+	}
+	if avoidDA2 || avoidDA3 {
+		// remaining device attributes are queried by QueryDeviceAttributes
+		return nil
+	}
+	prOut.SetProperty(propkeys.DeviceAttributesWereQueried, `true`)
+	return nil
+}
@@ -0,0 +1,66 @@
+package term
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/queries"
+)
+
+// querierBlocking feeds the parser after the reply was given up.
+type querierBlocking struct{ release chan struct{} }
+
+func (q *querierBlocking) Query(qs string, tty TTY, p Parser) (string, error) {
+	<-q.release
+	replay(queries.CSI+`?62c`, p)
+	return ``, nil
+}
+
+func TestCtxQuerierInterruptsQuery(t *testing.T) {
+	inner := &querierBlocking{release: make(chan struct{})}
+	defer close(inner.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	qu := newCtxQuerier(ctx, inner)
+
+	var parsed int
+	start := time.Now()
+	_, err := qu.Query(queries.DA1, &ttyDummy{}, ParserFunc(func(rune) bool { parsed++; return false }))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Zero(t, parsed)
+}
+
+// drawerDeadline is applicable and lets the detection deadline pass during its check.
+type drawerDeadline struct {
+	drawerRecorder
+	cancel context.CancelFunc
+}
+
+func (d *drawerDeadline) Name() string { return `deadline` }
+func (d *drawerDeadline) IsApplicable(DrawerCheckerInput) (bool, Properties) {
+	d.cancel()
+	return true, nil
+}
+
+func TestDrawersForDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	first, deadline, skipped := &drawerRecorder{}, &drawerDeadline{cancel: cancel}, &drawerRecorder{}
+	prev := drawersRegistered
+	t.Cleanup(func() { drawersRegistered = prev })
+	drawersRegistered = []Drawer{first, deadline, skipped}
+
+	inp := &drawerCheckerInput{Properties: environ.NewProperties()}
+	drs, _, err := drawersFor(ctx, inp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []Drawer{first, deadline}, drs, `drawers found before the deadline`)
+
+	drs, _, err = drawersFor(ctx, inp)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, drs)
+}
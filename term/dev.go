@@ -24,5 +24,5 @@ func (t *Terminal) Exe() string {
 }
 
 func XTGetTCap(tm *Terminal, tcap string) (string, error) {
-	return xtGetTCap(tcap, tm.querier, tm.tty, tm.properties, tm.properties)
+	return xtGetTCap(tcap, tm.querier, tm.queryTTY(), tm.properties, tm.properties)
 }
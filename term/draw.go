@@ -8,6 +8,7 @@ import (
 	"log/slog"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/btree"
@@ -96,6 +97,18 @@ type Canvas struct {
 	lastScreenshotTaken time.Time
 	lastSetX            int // draw.Draw: for y{for x{}}
 	closed              chan struct{}
+
+	// damage tracking
+	cellW, cellH float64     // cell size in pixels
+	drawn        *image.RGBA // pixels on screen, nil if unknown
+	dirty        []bool      // cells changed by Set since the last draw
+	dirtyUnknown bool        // drawing wasn't changed by Set alone
+	drawnWith    Drawer      // drawer of the last draw
+
+	// video pacing and statistics
+	videoMu    sync.Mutex
+	video      videoState
+	videoLevel atomic.Int32
 }
 
 func (c *Canvas) Set(x, y int, col color.Color) {
@@ -110,21 +123,26 @@ func (c *Canvas) Set(x, y int, col color.Color) {
 		c.drawing.Bounds().Dy() != c.boundsPixels.Dy() {
 		c.lastSetX = -2
 		c.drawing = image.NewRGBA(image.Rect(0, 0, c.boundsPixels.Dx(), c.boundsPixels.Dy()))
+		c.dirtyUnknown = true
 	}
 	if c.image != nil {
 		if c.lastSetX < -1 &&
 			c.drawing.Bounds().Dx() == c.image.Bounds().Dx() &&
 			c.drawing.Bounds().Dy() == c.image.Bounds().Dy() {
 			draw.Draw(c.drawing, c.drawing.Bounds(), c.image, c.image.Bounds().Min, draw.Src)
+			c.dirtyUnknown = true
 		}
 		util.TryClose(c.image)
 		c.image = nil
 	}
+	if !colorEqual(c.drawing.At(x, y), col) {
+		c.markDirty(x, y)
+	}
 	c.drawing.Set(x, y, col)
 	if ((x == 0 && y == 0) ||
 		(x == c.boundsPixels.Dx()-1 && y == c.boundsPixels.Dy()-1)) &&
 		(x-c.lastSetX == 1 || x-c.lastSetX == -1) {
-		err := c.terminal.Draw(c.drawing, c.bounds)
+		err := c.Draw(nil)
 		logx.IsErr(err, c.terminal, slog.LevelError)
 	}
 	c.lastSetX = x
@@ -192,6 +210,8 @@ func (c *Canvas) SetCellArea(bounds image.Rectangle) error {
 	c.boundsPixels = boundsPixels
 	c.drawing = image.NewRGBA(image.Rect(0, 0, boundsPixels.Dx(), boundsPixels.Dy()))
 	c.lastSetX = -2
+	c.cellW, c.cellH = cpw, cph
+	c.Invalidate()
 	return nil
 }
 func (c *Canvas) CellArea() image.Rectangle { return c.bounds }
@@ -205,7 +225,8 @@ func (c *Canvas) SetImage(img image.Image) error {
 	return nil
 }
 
-// Draw flushes stored image when img is nil
+// Draw flushes stored image when img is nil.
+// Images with the pixel size of the canvas only redraw the cells changed since the last draw.
 func (c *Canvas) Draw(img image.Image) error {
 	if c == nil {
 		return errors.NilReceiver()
@@ -229,10 +250,26 @@ func (c *Canvas) Draw(img image.Image) error {
 			return logx.Err(`nothing to draw`, c.terminal, slog.LevelError)
 		}
 	}
+	if cells, ok := c.damage(c.image); ok {
+		if err := c.drawCells(c.image, cells); !logx.IsErr(err, c.terminal, slog.LevelInfo) {
+			return nil
+		}
+	}
+	if err := c.drawAt(c.image, c.bounds); err != nil {
+		c.Invalidate()
+		return err
+	}
+	c.remember(c.image, nil)
+	return nil
+}
+
+// drawAt draws img into the cells of bounds with the first working drawer.
+func (c *Canvas) drawAt(img image.Image, bounds image.Rectangle) error {
 	var errs []error
-	for _, dr := range drawers {
-		err := Draw(c.image, c.bounds, c.terminal, dr)
+	for _, dr := range c.terminal.Drawers() {
+		err := Draw(img, bounds, c.terminal, dr)
 		if !logx.IsErr(err, c.terminal, slog.LevelInfo) {
+			c.drawnWith = dr
 			goto successfulDraw
 		}
 		errs = append(errs, err)
@@ -248,15 +285,13 @@ func (c *Canvas) Video(ctx context.Context, vid <-chan image.Image, frameDur tim
 		return logx.Err(errors.NilParam(), c.terminal, slog.LevelError)
 	}
 	_ = c.terminal.SetOptions(TUIMode)
-	// TODO count miss/success ratio, avg draw time, etc
+	c.startVideo(frameDur)
 
 	drawFnChan, err := c.prepImagesParallelOrdered(ctx, vid, frameDur, runtime.NumCPU())
 	if err != nil {
 		return err
 	}
 
-	tm := time.Now()
-	var tmLast time.Time
 outer:
 	for {
 		select {
@@ -264,19 +299,36 @@ outer:
 			if !ok {
 				break outer
 			}
-			tm, tmLast = time.Now(), tm
-			frameTime := tm.Sub(tmLast)
+			if drawFn.fn == nil || c.late(drawFn.id) {
+				c.frameDropped()
+				logx.Debug("dropped frame", c.terminal, "frame", drawFn.id)
+				continue
+			}
+			// frames are drawn at their due time, not one frame duration after the last one
+			for wait := time.Until(c.due(drawFn.id)); wait > 0; wait = time.Until(c.due(drawFn.id)) {
+				select {
+				case <-time.After(min(wait, videoClockPoll)):
+				case <-c.closed:
+					break outer
+				case <-ctx.Done():
+					break outer
+				}
+			}
+			latency := time.Since(c.due(drawFn.id))
+			tm := time.Now()
 			err := logx.TimeIt(drawFn.fn, `image drawing`, c.terminal, `drawer`, c.terminal.Drawers()[0].Name())
 			logx.IsErr(err, c.terminal, slog.LevelError)
+			drawTime := time.Since(tm)
+			c.frameDrawn(drawTime, latency)
+			if hook := c.videoFrameHook(); hook != nil {
+				hook(c.Stats())
+			}
 			if c.drawing != nil {
 				util.TryClose(c.drawing)
 				c.drawing = nil
 			}
-			drawTime := time.Since(tm)
-			logx.Debug("durations", c.terminal, "draw-duration", drawTime, "frame-time", frameTime)
-			if drawTime < frameDur {
-				time.Sleep(frameDur - drawTime)
-			}
+			c.Invalidate()
+			logx.Debug("durations", c.terminal, "draw-duration", drawTime, "latency", latency)
 		case <-c.closed:
 			break outer
 		case <-ctx.Done():
@@ -311,26 +363,22 @@ func (c *Canvas) prepImagesParallelOrdered(ctx context.Context, vid <-chan image
 				return true
 			})
 		}()
-		var drFnLast drawFn
+		var next int
 		for drFn := range drawFnUnorderedChan {
-			var isNext bool
-			if drFn.id == drFnLast.id+1 {
-				isNext = true
-			} else {
-				tr.DescendRange(drFn, drFnLast, func(item drawFn) bool {
-					if item.id == drFnLast.id+1 {
-						isNext = true
-						return false
-					}
-					return true
-				})
-			}
-			if isNext {
-				drawFnChan <- drFn
-				tr.Delete(drFnLast)
-				drFnLast = drFn
-			} else {
-				tr.ReplaceOrInsert(drFn)
+			tr.ReplaceOrInsert(drFn)
+			// pass on the buffered frames following the last one
+			for {
+				first, ok := tr.Min()
+				if !ok || first.id != next {
+					break
+				}
+				select {
+				case drawFnChan <- first:
+				case <-ctx.Done():
+					return
+				}
+				tr.DeleteMin()
+				next++
 			}
 			logx.Debug("b-tree", c.terminal, "node-count", tr.Len())
 		}
@@ -344,7 +392,11 @@ func (c *Canvas) prepImagesParallelUnordered(ctx context.Context, vid <-chan ima
 		frame := 0
 		for img := range vid {
 			logx.Debug("frame", c.terminal, "frame", frame)
-			vidwid <- imgWithID{id: frame, img: img}
+			select {
+			case vidwid <- imgWithID{id: frame, img: img}:
+			case <-ctx.Done():
+				return
+			}
 			frame++
 		}
 	}()
@@ -364,7 +416,11 @@ func (c *Canvas) prepImagesParallelUnordered(ctx context.Context, vid <-chan ima
 			workerID := i
 			for drawFn := range drawFnChan {
 				logx.Debug("drawer func id", c.terminal, "worker-id", workerID, "frame", drawFn.id)
-				drawFnCombChan <- drawFn
+				select {
+				case drawFnCombChan <- drawFn:
+				case <-ctx.Done():
+					return
+				}
 			}
 		})
 	}
@@ -390,9 +446,21 @@ func (c *Canvas) prepImages(ctx context.Context, imgChan <-chan imgWithID) (<-ch
 				if !ok {
 					return
 				}
-				drFn, err := dr.Prepare(ctx, imgwid.img, c.bounds, c.terminal)
-				if !logx.IsErr(err, c.terminal, slog.LevelInfo) && drFn != nil {
-					drawFnChan <- drawFn{id: imgwid.id, fn: drFn}
+				// late and failed frames are passed on without a draw func,
+				// the ordering waits for every id
+				var drFn func() error
+				if !c.late(imgwid.id) {
+					start := time.Now()
+					fn, err := dr.Prepare(ctx, c.reduce(imgwid.img), c.bounds, c.terminal)
+					if !logx.IsErr(err, c.terminal, slog.LevelInfo) {
+						c.frameEncoded(time.Since(start))
+						drFn = fn
+					}
+				}
+				select {
+				case drawFnChan <- drawFn{id: imgwid.id, fn: drFn}:
+				case <-ctx.Done():
+					return
 				}
 				go func(imgLast image.Image) { util.TryClose(imgLast) }(c.image)
 				c.image = imgwid.img
@@ -1,26 +1,49 @@
 package term
 
 import (
+	"context"
+	"slices"
+
 	"github.com/srlehn/termimg/internal/environ"
 	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/propkeys"
+	"github.com/srlehn/termimg/mux"
 )
 
 // DrawersFor ...
 func DrawersFor(inp DrawerCheckerInput) ([]Drawer, error) {
-	drs, _, err := drawersFor(inp)
+	drs, _, err := drawersFor(context.Background(), inp)
 	return drs, err
 }
 
-func drawersFor(inp DrawerCheckerInput) ([]Drawer, Properties, error) {
+// drawersFor returns the applicable drawers.
+// When ctx is done, the remaining drawers aren't checked and the drawers found so far
+// are returned together with the error of ctx.
+func drawersFor(ctx context.Context, inp DrawerCheckerInput) ([]Drawer, Properties, error) {
 	if inp == nil {
 		return nil, nil, errors.NilParam()
 	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	prs := environ.NewProperties()
-	var applDrawers []Drawer
+	graphics := mux.GraphicsOf(inp)
+	var (
+		applDrawers []Drawer
+		errCtx      error
+	)
 	for _, dr := range drawersRegistered {
 		if dr == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			// deadline exceeded - decide with the checks completed so far
+			errCtx = errors.New(err)
+			break
+		}
+		if !isDrawerPassable(dr.Name(), graphics) {
+			continue
+		}
 		isApplicable, pr := dr.IsApplicable(inp)
 		if !isApplicable {
 			continue
@@ -30,8 +53,35 @@ func drawersFor(inp DrawerCheckerInput) ([]Drawer, Properties, error) {
 	}
 	if len(applDrawers) == 0 {
 		prs = nil
+	} else if graphics != mux.GraphicsPassthrough {
+		prs.SetProperty(propkeys.MuxGraphics, graphics.String())
+	}
+	return applDrawers, prs, errCtx
+}
+
+// drawersInband send their images as escape sequences through the tty.
+var drawersInband = []string{
+	`terminology`,
+	`iterm2`,
+	`kitty`,
+	`sixel`,
+	`domterm`,
+	`urxvt`,
+}
+
+// isDrawerPassable reports whether the images of the drawer reach the outer terminal
+// through the terminal multiplexers (zellij, mosh, ...).
+func isDrawerPassable(drawerName string, graphics mux.Graphics) bool {
+	if !slices.Contains(drawersInband, drawerName) {
+		return true
+	}
+	switch graphics {
+	case mux.GraphicsSixel:
+		return drawerName == `sixel`
+	case mux.GraphicsNone:
+		return false
 	}
-	return applDrawers, prs, nil
+	return true
 }
 
 var drawersRegistered []Drawer
@@ -14,6 +14,7 @@ import (
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/internal/propkeys"
+	"github.com/srlehn/termimg/mux"
 	"github.com/srlehn/termimg/wm"
 )
 
@@ -277,12 +278,16 @@ var (
 	CLIMode              Option = cliMode
 	ManualComposition    Option = manualComposition    // disable terminal detection
 	NoCleanUpOnInterrupt Option = noCleanUpOnInterrupt // disable terminal cleanup on Interrupt or TERM signal
+	NoQuery              Option = noQuery              // skip terminal detection, requires properties from a saved profile
+	EnableMuxPassthrough Option = enableMuxPassthrough // enable tmux allow-passthrough for the pane if it is off
 )
 
 var tuiMode Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.Mode, `tui`); return nil })
 var cliMode Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.Mode, `cli`); return nil })
 var manualComposition Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.ManualComposition, `true`); return nil })
 var noCleanUpOnInterrupt Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.NoCleanUpOnInterrupt, `true`); return nil })
+var noQuery Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.NoQuery, `true`); return nil })
+var enableMuxPassthrough Option = OptFunc(func(t *Terminal) error { t.SetProperty(propkeys.MuxEnablePassthrough, `true`); return nil })
 
 // replaceTerminal is for injecting an already set up *terminal.Terminal into *termCheckerCore.NewTerminal()
 // replacing its dummy one.
@@ -368,6 +373,8 @@ func setEnvAndMuxers(overwrite bool) Option {
 			t.SetProperty(propkeys.EnvIsLoaded, `true`)
 		}
 		t.passages = passages
+		t.muxRW = nil
+		t.panes = mux.NewPaneTracker(passages, t.properties)
 
 		// X11 Resources
 
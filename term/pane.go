@@ -0,0 +1,140 @@
+package term
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"log/slog"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/logx"
+	"github.com/srlehn/termimg/internal/propkeys"
+)
+
+// OuterBounds translates cell bounds relative to the innermost multiplexer pane
+// (tmux, also nested) to cells of the outer terminal and clips them to the pane.
+// visible is the clipped part of bounds in pane relative cells.
+// Without multiplexer panes outer and visible equal bounds.
+func (t *Terminal) OuterBounds(bounds image.Rectangle) (outer, visible image.Rectangle, _ error) {
+	if t == nil {
+		return image.Rectangle{}, image.Rectangle{}, errors.NilReceiver()
+	}
+	if t.panes == nil {
+		return bounds, bounds, nil
+	}
+	geo, err := t.panes.Geometry()
+	if err != nil {
+		return bounds, bounds, err
+	}
+	outer, visible = geo.Translate(bounds)
+	return outer, visible, nil
+}
+
+// InvalidatePaneGeometry forces a new query of the multiplexer pane positions,
+// e.g. after panes were moved or resized.
+func (t *Terminal) InvalidatePaneGeometry() {
+	if t == nil {
+		return
+	}
+	t.panes.Invalidate()
+}
+
+// setupMuxPassthrough stores the effective tmux allow-passthrough setting
+// and enables passthrough first if requested with EnableMuxPassthrough.
+func (t *Terminal) setupMuxPassthrough() {
+	if t == nil || t.panes == nil {
+		return
+	}
+	if enable, ok := t.Property(propkeys.MuxEnablePassthrough); ok && enable == `true` {
+		_ = logx.IsErr(t.passages.EnableTmuxPassthrough(t.properties), t, slog.LevelInfo)
+	}
+	allow, err := t.passages.TmuxAllowPassthrough(t.properties)
+	if logx.IsErr(err, t, slog.LevelInfo) || len(allow) == 0 {
+		return
+	}
+	t.SetProperty(propkeys.MuxAllowPassthrough, allow)
+	if allow == `off` {
+		logx.Info(`tmux allow-passthrough is off, wrapped sequences are dropped`, t)
+	}
+}
+
+// placementClearer is implemented by drawers whose images are placed over the cells
+// and stay on screen when the multiplexer redraws a hidden pane.
+type placementClearer interface {
+	ClearPlacements(tm *Terminal) error
+}
+
+// WatchMuxPane watches the terminal multiplexer (tmux) pane of the terminal.
+// When the pane is hidden, e.g. by switching the tmux window, onChange(false) is called.
+// Images that are placed over the cells (kitty) are cleared if tmux passes sequences
+// of invisible panes through (allow-passthrough all), otherwise they stay on screen:
+// tmux reports the switch after it happened and then drops the clearing sequences.
+// When the pane becomes visible again or the layout changed, onChange(true) is called
+// so that the caller can redraw its images.
+// Watching stops when ctx is done.
+func (t *Terminal) WatchMuxPane(ctx context.Context, onChange func(visible bool)) error {
+	if t == nil {
+		return errors.NilReceiver()
+	}
+	if ctx == nil {
+		return errors.NilParam()
+	}
+	events, err := t.passages.WatchTmuxPane(ctx, t.properties)
+	if err != nil {
+		return err
+	}
+	clearHidden := t.hiddenPanePassthrough()
+	if !clearHidden {
+		logx.Info(`tmux allow-passthrough isn't "all", images placed over the cells stay on screen while the pane is hidden`, t)
+	}
+	go func() {
+		for ev := range events {
+			if ev.LayoutChanged {
+				t.panes.Invalidate()
+			}
+			if !ev.Visible && clearHidden {
+				ClearPlacements(t)
+			}
+			if onChange != nil {
+				onChange(ev.Visible)
+			}
+		}
+	}()
+	return nil
+}
+
+// hiddenPanePassthrough reports whether tmux passes the sequences of invisible panes through.
+func (t *Terminal) hiddenPanePassthrough() bool {
+	allow, ok := t.Property(propkeys.MuxAllowPassthrough)
+	return ok && allow == `all`
+}
+
+// ClipImageToCells returns the part of img, which is scaled to the cell area bounds,
+// that covers the cell area visible.
+func ClipImageToCells(img image.Image, bounds, visible image.Rectangle) (image.Image, error) {
+	if img == nil {
+		return nil, errors.NilParam()
+	}
+	if visible == bounds {
+		return img, nil
+	}
+	if visible.Empty() || bounds.Empty() {
+		return nil, errors.New(`image is not visible`)
+	}
+	b := img.Bounds()
+	scale := func(v, from, to int) int { return v * to / from }
+	r := image.Rect(
+		scale(visible.Min.X-bounds.Min.X, bounds.Dx(), b.Dx()),
+		scale(visible.Min.Y-bounds.Min.Y, bounds.Dy(), b.Dy()),
+		scale(visible.Max.X-bounds.Min.X, bounds.Dx(), b.Dx()),
+		scale(visible.Max.Y-bounds.Min.Y, bounds.Dy(), b.Dy()),
+	).Add(b.Min)
+	if simg, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return simg.SubImage(r), nil
+	}
+	m := image.NewNRGBA(image.Rectangle{Max: r.Size()})
+	draw.Draw(m, m.Bounds(), img, r.Min, draw.Src)
+	return m, nil
+}
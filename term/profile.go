@@ -0,0 +1,210 @@
+package term
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/srlehn/termimg/env/advanced"
+	"github.com/srlehn/termimg/internal"
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/propkeys"
+)
+
+// profileFormatVersion is increased when the meaning of stored properties changes.
+const profileFormatVersion = 1
+
+// environment variables that identify the terminal instance a profile was created for
+var profileIdentityEnvVars = []string{
+	`TERM`,
+	`TERM_PROGRAM`,
+	`TERM_PROGRAM_VERSION`,
+	`VTE_VERSION`,
+	`KONSOLE_VERSION`,
+	`XTERM_VERSION`,
+	`MLTERM`,                  // mlterm version
+	`TERMINAL_VERSION_STRING`, // contour
+	`WINDOWID`,
+	`KITTY_WINDOW_ID`,
+	`ALACRITTY_WINDOW_ID`,
+	`WEZTERM_PANE`,
+	`TMUX`,
+	`TMUX_PANE`,
+	`STY`,
+}
+
+// properties that are only valid within the process that created them
+var profileExcludedPrefixes = []string{
+	propkeys.EnvPrefix,
+	propkeys.XResourcesPrefix,
+	propkeys.QueryCachePrefix, // keyed by parser address
+	propkeys.PTYName,
+	propkeys.TempDir,
+	propkeys.EnvIsLoaded,
+	propkeys.Mode,
+	propkeys.ManualComposition,
+	propkeys.NoCleanUpOnInterrupt,
+	propkeys.NoQuery,
+	propkeys.MuxAllowPassthrough, // can be changed at any time
+	propkeys.MuxEnablePassthrough,
+}
+
+// ErrProfileOutdated is returned by LoadProfile if the terminal changed since the profile was saved.
+var ErrProfileOutdated = errors.New(`terminal profile is outdated`)
+
+type profile struct {
+	FormatVersion int               `json:"formatVersion"`
+	Library       string            `json:"library"`
+	Identity      map[string]string `json:"identity"`
+	Properties    map[string]string `json:"properties"`
+}
+
+// SaveProfile writes the resolved terminal properties as JSON to w.
+// A Terminal can later be recreated without terminal detection from the
+// snapshot with LoadProfile, SetProprietor and NoQuery.
+func (t *Terminal) SaveProfile(w io.Writer) error {
+	if err := errors.NilReceiver(t, t.properties); err != nil {
+		return err
+	}
+	if w == nil {
+		return errors.NilParam()
+	}
+	prof := &profile{
+		FormatVersion: profileFormatVersion,
+		Library:       consts.LibraryName,
+		Identity:      profileIdentity(t.properties),
+		Properties:    make(map[string]string),
+	}
+	for k, v := range environ.CloneProperties(t.properties).ExportProperties() {
+		if isProfileExcluded(k) {
+			continue
+		}
+		prof.Properties[k] = v
+	}
+	drs := make([]string, 0, len(t.drawers))
+	for _, dr := range t.drawers {
+		if dr == nil {
+			continue
+		}
+		drs = append(drs, dr.Name())
+	}
+	prof.Properties[propkeys.ProfileDrawers] = strings.Join(drs, `,`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent(``, "\t")
+	if err := enc.Encode(prof); err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// SaveProfileFile writes the terminal profile to the file filename.
+func (t *Terminal) SaveProfileFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.New(err)
+	}
+	if err := t.SaveProfile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
+
+// LoadProfile reads a profile written by SaveProfile.
+// The profile is rejected with ErrProfileOutdated if the terminal identity
+// (TERM, terminal version, window, multiplexer session) of the terminal
+// managing ptyName differs from the saved one.
+//
+// Usage:
+//
+//	pr, err := term.LoadProfile(f, ``)
+//	...
+//	tm, err := term.NewTerminal(termimg.DefaultConfig, term.SetProprietor(pr, true), term.NoQuery)
+func LoadProfile(r io.Reader, ptyName string) (Properties, error) {
+	prof, err := readProfile(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(ptyName) == 0 {
+		ptyName = internal.DefaultTTYDevice()
+	}
+	env, _, err := advanced.GetEnv(ptyName)
+	if err != nil && env == nil {
+		return nil, err
+	}
+	return prof.properties(env)
+}
+
+func readProfile(r io.Reader) (*profile, error) {
+	if r == nil {
+		return nil, errors.NilParam()
+	}
+	prof := &profile{}
+	if err := json.NewDecoder(r).Decode(prof); err != nil {
+		return nil, errors.New(err)
+	}
+	if prof.FormatVersion != profileFormatVersion || prof.Library != consts.LibraryName {
+		return nil, errors.New(ErrProfileOutdated)
+	}
+	return prof, nil
+}
+
+// properties returns the stored properties if the identity of the terminal in env
+// matches the saved one.
+func (p *profile) properties(env environ.Enver) (Properties, error) {
+	idCur := profileIdentity(env)
+	if len(idCur) != len(p.Identity) {
+		return nil, errors.New(ErrProfileOutdated)
+	}
+	for k, v := range idCur {
+		if vSaved, ok := p.Identity[k]; !ok || vSaved != v {
+			return nil, errors.New(ErrProfileOutdated)
+		}
+	}
+	pr := environ.NewProperties()
+	for k, v := range p.Properties {
+		if isProfileExcluded(k) {
+			continue
+		}
+		pr.SetProperty(k, v)
+	}
+	return pr, nil
+}
+
+// LoadProfileFile reads the profile from the file filename.
+func LoadProfileFile(filename, ptyName string) (Properties, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	defer f.Close()
+	return LoadProfile(f, ptyName)
+}
+
+func profileIdentity(env environ.Enver) map[string]string {
+	id := make(map[string]string)
+	if env == nil {
+		return id
+	}
+	for _, k := range profileIdentityEnvVars {
+		if v, ok := env.LookupEnv(k); ok {
+			id[k] = v
+		}
+	}
+	return id
+}
+
+func isProfileExcluded(key string) bool {
+	for _, prefix := range profileExcludedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package term
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/propkeys"
+)
+
+// newProfileTerminal returns a terminal with the environment env and a detected terminal name.
+func newProfileTerminal(env ...string) *Terminal {
+	tm := newDummyTerminal()
+	tm.properties.MergeProperties(environ.EnvToProperties(env))
+	tm.SetProperty(propkeys.TerminalName, `kitty`)
+	tm.SetProperty(propkeys.PTYName, `/dev/pts/3`)
+	tm.drawers = []Drawer{&drawerRecorder{}}
+	return tm
+}
+
+func TestProfileRoundTrip(t *testing.T) {
+	env := []string{`TERM=xterm-kitty`, `TERM_PROGRAM_VERSION=0.35.2`, `KITTY_WINDOW_ID=1`, `HOME=/home/user`}
+	tm := newProfileTerminal(env...)
+	var buf bytes.Buffer
+	require.NoError(t, tm.SaveProfile(&buf))
+
+	prof, err := readProfile(&buf)
+	require.NoError(t, err)
+	pr, err := prof.properties(environ.EnvToProperties(env))
+	require.NoError(t, err)
+
+	name, ok := pr.Property(propkeys.TerminalName)
+	assert.True(t, ok)
+	assert.Equal(t, `kitty`, name)
+	drawers, _ := pr.Property(propkeys.ProfileDrawers)
+	assert.Equal(t, `recorder`, drawers)
+	_, ok = pr.Property(propkeys.PTYName)
+	assert.False(t, ok, `process specific properties aren't stored`)
+	_, ok = pr.LookupEnv(`HOME`)
+	assert.False(t, ok, `the environment isn't stored`)
+}
+
+func TestProfileOutdated(t *testing.T) {
+	env := []string{`TERM=xterm-kitty`, `TERM_PROGRAM_VERSION=0.35.2`}
+	var buf bytes.Buffer
+	require.NoError(t, newProfileTerminal(env...).SaveProfile(&buf))
+	prof, err := readProfile(&buf)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		env  []string
+	}{
+		{`changed version`, []string{`TERM=xterm-kitty`, `TERM_PROGRAM_VERSION=0.36.0`}},
+		{`added variable`, []string{`TERM=xterm-kitty`, `TERM_PROGRAM_VERSION=0.35.2`, `TMUX=/tmp/tmux-1000/default,1,0`}},
+		{`removed variable`, []string{`TERM=xterm-kitty`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := prof.properties(environ.EnvToProperties(tt.env))
+			assert.True(t, errors.Is(err, ErrProfileOutdated))
+		})
+	}
+	_, err = prof.properties(environ.EnvToProperties(append(env, `HOME=/root`)))
+	assert.NoError(t, err, `other variables don't identify the terminal`)
+
+	_, err = readProfile(bytes.NewBufferString(`{"formatVersion":0,"library":"termimg"}`))
+	assert.True(t, errors.Is(err, ErrProfileOutdated), `format version`)
+}
@@ -21,6 +21,28 @@ type Querier interface {
 	Query(string, TTY, Parser) (string, error)
 }
 
+// InputReader is implemented by queriers that keep reading the tty.
+// Input received outside of replies, e.g. key presses, is buffered for ReadInput.
+type InputReader interface {
+	ReadInput(tty TTY, p []byte) (int, error)
+}
+
+// inputReader returns the InputReader behind wrapping queriers (persistentQuerier, ctxQuerier).
+// Reading the tty next to the reader of the querier would split the input between both.
+func inputReader(qu Querier) (InputReader, bool) {
+	for qu != nil {
+		if ir, ok := qu.(InputReader); ok {
+			return ir, true
+		}
+		uw, ok := qu.(interface{ Unwrap() Querier })
+		if !ok {
+			return nil, false
+		}
+		qu = uw.Unwrap()
+	}
+	return nil, false
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 // CachedQuerier ...
@@ -124,7 +146,6 @@ func (t *ttyDummy) TTYDevName() string {
 
 // QueryDeviceAttributes should only be used for external TermCheckers
 func QueryDeviceAttributes(qu Querier, tty TTY, prIn, prOut Properties) error {
-	// TODO add mux.Wrap()
 	if qu == nil || tty == nil || prIn == nil {
 		return errors.NilParam()
 	}
@@ -162,90 +183,15 @@ func QueryDeviceAttributes(qu Querier, tty TTY, prIn, prOut Properties) error {
 		repl, err := cqu.CachedQuery(da.qs, tty, da.p, prIn)
 		if err != nil {
 			errs = append(errs, err)
+			continue
 		}
 		switch da.qs {
 		case queries.DA1:
-			// DA1 - Primary Device Attributes
-			// https://vt100.net/docs/vt510-rm/DA1.html
-			// remove CSI+"?" (control sequence introducer)
-			repl, found := strings.CutPrefix(repl, queries.CSI+`?`)
-			if !found {
-				goto skipExtraction
-			}
-			// remove CSI terminator
-			repl, found = strings.CutSuffix(repl, `c`)
-			if !found {
-				goto skipExtraction
-			}
-			attrs := strings.Split(repl, `;`)
-			prOut.SetProperty(propkeys.DeviceClass, attrs[0])
-			if len(attrs) == 1 {
-				goto skipExtraction
-			}
-			attrs = attrs[1:]
-			prOut.SetProperty(propkeys.DeviceAttributes, strings.Join(attrs, `;`))
-			for _, attr := range attrs {
-				switch attr {
-				case `3`: // https://terminalguide.namepad.de/seq/csi_sc/
-					prOut.SetProperty(propkeys.ReGISCapable, `true`)
-				case `4`:
-					prOut.SetProperty(propkeys.SixelCapable, `true`)
-				case `18`:
-					prOut.SetProperty(propkeys.WindowingCapable, `true`)
-				}
-			}
-		case queries.DA2: // Model & Version
-			// https://vt100.net/docs/vt510-rm/DA2.html
-			// https://terminalguide.namepad.de/seq/csi_sc__q/
-			// remove CSI+">" (control sequence introducer)
-			repl, found := strings.CutPrefix(repl, queries.CSI+`>`)
-			if !found {
-				goto skipExtraction
-			}
-			// remove CSI terminator
-			repl, found = strings.CutSuffix(repl, `c`)
-			if !found {
-				goto skipExtraction
-			}
-			attrs := strings.Split(repl, `;`)
-			if len(attrs) != 3 {
-				goto skipExtraction
-			}
-			prOut.SetProperty(propkeys.DA2Model, attrs[0])
-			prOut.SetProperty(propkeys.DA2Version, attrs[1])
-			prOut.SetProperty(propkeys.DA2Keyboard, attrs[2])
-			model, err := strconv.Atoi(attrs[0])
-			if err == nil && model >= 0x20 && model <= 0x7E {
-				// store if printable
-				prOut.SetProperty(propkeys.DA2ModelLetter, string(rune(model)))
-			}
+			extractDA1(repl, prOut)
+		case queries.DA2:
+			extractDA2(repl, prOut)
 		case queries.DA3:
-			// DA3 - Tertiary Device Attributes
-			// https://vt100.net/docs/vt510-rm/DA3.html
-			// DECRPTUI - Report Terminal Unit ID
-			// https://www.vt100.net/docs/vt510-rm/DECRPTUI.html
-			var replDec []byte
-			// remove DCS+"!|" (device control string)
-			repl, found := strings.CutPrefix(repl, "\033P!|")
-			if !found {
-				goto skipExtraction
-			}
-			// remove ST (string terminator)
-			repl, found = strings.CutSuffix(repl, "\033\\")
-			if !found {
-				goto skipExtraction
-			}
-			replDec, err = hex.DecodeString(repl)
-			if err != nil {
-				goto skipExtraction
-			}
-			prOut.SetProperty(propkeys.DA3IDHex, repl)
-			repl = string(replDec)
-			prOut.SetProperty(propkeys.DA3ID, repl)
-		}
-	skipExtraction:
-		if err != nil {
-			errs = append(errs, err)
+			extractDA3(repl, prOut)
 		}
 	}
 	err := errors.Join(errs...)
@@ -255,6 +201,76 @@ func QueryDeviceAttributes(qu Querier, tty TTY, prIn, prOut Properties) error {
 	return nil
 }
 
+// DA1 - Primary Device Attributes
+// https://vt100.net/docs/vt510-rm/DA1.html
+func extractDA1(repl string, prOut Properties) bool {
+	seq, found := findSequence(repl, parser.IsDA1Reply)
+	if !found {
+		return false
+	}
+	da1, err := ParseDA1(seq)
+	if err != nil {
+		return false
+	}
+	prOut.SetProperty(propkeys.DeviceClass, da1.Class)
+	if len(da1.Attributes) == 0 {
+		return true
+	}
+	prOut.SetProperty(propkeys.DeviceAttributes, strings.Join(da1.Attributes, `;`))
+	for _, attr := range da1.Attributes {
+		switch attr {
+		case `3`: // https://terminalguide.namepad.de/seq/csi_sc/
+			prOut.SetProperty(propkeys.ReGISCapable, `true`)
+		case `4`:
+			prOut.SetProperty(propkeys.SixelCapable, `true`)
+		case `18`:
+			prOut.SetProperty(propkeys.WindowingCapable, `true`)
+		}
+	}
+	return true
+}
+
+// DA2 - Secondary Device Attributes (Model & Version)
+// https://vt100.net/docs/vt510-rm/DA2.html
+// https://terminalguide.namepad.de/seq/csi_sc__q/
+func extractDA2(repl string, prOut Properties) bool {
+	seq, found := findSequence(repl, func(seq Sequence) bool { return seq.Is(SeqCSI, '>', ``, 'c') })
+	if !found {
+		return false
+	}
+	da2, err := ParseDA2(seq)
+	if err != nil {
+		return false
+	}
+	prOut.SetProperty(propkeys.DA2Model, da2.Model)
+	prOut.SetProperty(propkeys.DA2Version, da2.Version)
+	prOut.SetProperty(propkeys.DA2Keyboard, da2.Keyboard)
+	model, err := strconv.Atoi(da2.Model)
+	if err == nil && model >= 0x20 && model <= 0x7E {
+		// store if printable
+		prOut.SetProperty(propkeys.DA2ModelLetter, string(rune(model)))
+	}
+	return true
+}
+
+// DA3 - Tertiary Device Attributes
+// https://vt100.net/docs/vt510-rm/DA3.html
+// DECRPTUI - Report Terminal Unit ID
+// https://www.vt100.net/docs/vt510-rm/DECRPTUI.html
+func extractDA3(repl string, prOut Properties) bool {
+	seq, found := findSequence(repl, func(seq Sequence) bool { return seq.Is(SeqDCS, 0, `!`, '|') })
+	if !found {
+		return false
+	}
+	da3, err := ParseDA3(seq)
+	if err != nil {
+		return false
+	}
+	prOut.SetProperty(propkeys.DA3IDHex, da3.IDHex)
+	prOut.SetProperty(propkeys.DA3ID, da3.ID)
+	return true
+}
+
 var (
 	xtGetTCapSpecialStrs = []string{`TN`, `Co`, `RGB`}
 )
@@ -278,106 +294,88 @@ func xtGetTCap(tcap string, qu Querier, tty TTY, prIn, prOut Properties) (string
 	// add DA1 so that we don't have to wait for a timeout
 	qsXTGETTCAP := queries.DCS + `+q` + tcapHex + queries.ST + queries.DA1
 
-	var encounteredST bool
-	var prs ParserFunc = func(r rune) bool {
-		if r == '[' {
-			// CSI not DSC, so no reply to XTGETTCAP query
-			encounteredST = true
-			return false
-		}
-		if encounteredST {
-			if parser.StopOnAlpha(r) {
-				return true
-			} else {
-				return false
-			}
-		}
-		if r == '\\' || r == '\a' {
-			encounteredST = true
-		}
-		return false
-	}
-
 	if prOut == nil {
 		prOut = environ.NewProperties()
 	}
-	setProps := func(pr Properties, repl string) {
-		pr.SetProperty(propkeys.XTGETTCAPKeyNamePrefix+tcapHex, repl)
-		switch tcap {
-		case `TN`, `Co`, `RGB`:
-			pr.SetProperty(propkeys.XTGETTCAPSpecialPrefix+tcap, repl)
-		}
-	}
-	repl, err := CachedQuery(qu, qsXTGETTCAP, tty, prs, prIn, prOut)
+	repl, err := CachedQuery(qu, qsXTGETTCAP, tty, parser.NewDA1SentinelParser(), prIn, prOut)
 	if err != nil {
 		if err.Error() == consts.ErrTimeoutInterval.Error() {
-			setProps(prOut, ``)
+			setXTGetTCapProps(prOut, tcap, ``)
 			return ``, nil
 		} else {
 			return ``, err
 		}
 	}
-	replParts := strings.SplitN(repl, `[`, 2) // split at CSI
-	if len(replParts) < 2 {
-		return ``, errors.New(`found no CSI in reply`)
+	seq, found := findSequence(repl, func(seq Sequence) bool { return seq.Type == SeqDCS && seq.Final == 'r' })
+	if !found {
+		// only DA1 reply
+		return extractXTGetTCap(tcap, ``, prOut)
 	}
-	errStrUknownFormat := `unknown reply format`
-	repl = strings.TrimSuffix(replParts[0], "\033") // separate, because of xterm
+	return extractXTGetTCap(tcap, seq.Raw, prOut)
+}
+
+// extractXTGetTCap extracts the value from the DCS reply to a XTGETTCAP request.
+// An empty reply means that the terminal didn't answer the request.
+func extractXTGetTCap(tcap, repl string, prOut Properties) (string, error) {
 	if len(repl) == 0 {
-		goto end // found only reply to DA1 not to XTGETTCAP
+		// found only reply to DA1 not to XTGETTCAP
+		setXTGetTCapProps(prOut, tcap, ``)
+		return ``, nil
 	}
-	{
-		var found bool
-		repl, found = strings.CutSuffix(repl, "\033\\") // strip ST
-		if !found {
-			return ``, errors.New(errStrUknownFormat)
-		}
-		// strip DCS
-		repl = strings.TrimPrefix(repl, "\033")    // TODO might be missing, query issue?
-		repl, found = strings.CutPrefix(repl, "P") // strip DCS
-		if !found || len(repl) == 0 {
-			return ``, errors.New(errStrUknownFormat)
-		}
-		switch repl[0] {
-		case '0':
-			setProps(prOut, ``)
-			prOut.SetProperty(propkeys.XTGETTCAPInvalidPrefix+tcapHex, `true`)
-			return ``, errors.New(consts.ErrXTGetTCapInvalidRequest)
-		case '1': //valid
-		default:
-			return ``, errors.New(errStrUknownFormat)
-		}
-		repl = strings.TrimPrefix(repl, `1+r`+tcapHex+`=`)
-		replDec, err := hex.DecodeString(repl)
-		if err != nil {
-			return ``, errors.New(err)
-		}
-		repl = string(replDec)
+	tcapHex := strings.ToUpper(hex.EncodeToString([]byte(tcap)))
+	seq, found := findSequence(repl, func(seq Sequence) bool { return seq.Type == SeqDCS && seq.Final == 'r' })
+	if !found {
+		return ``, errors.New(`unknown reply format`)
 	}
+	rt, err := ParseXTGetTCap(seq)
+	if err != nil {
+		return ``, err
+	}
+	if !rt.Valid {
+		setXTGetTCapProps(prOut, tcap, ``)
+		prOut.SetProperty(propkeys.XTGETTCAPInvalidPrefix+tcapHex, `true`)
+		return ``, errors.New(consts.ErrXTGetTCapInvalidRequest)
+	}
+	val := rt.Caps[tcapHex]
+	setXTGetTCapProps(prOut, tcap, val)
+	return val, nil
+}
 
-end:
-	setProps(prOut, repl)
-	return repl, nil
+func setXTGetTCapProps(pr Properties, tcap, repl string) {
+	tcapHex := strings.ToUpper(hex.EncodeToString([]byte(tcap)))
+	pr.SetProperty(propkeys.XTGETTCAPKeyNamePrefix+tcapHex, repl)
+	switch tcap {
+	case `TN`, `Co`, `RGB`:
+		pr.SetProperty(propkeys.XTGETTCAPSpecialPrefix+tcap, repl)
+	}
 }
 
 func xtVersion(qu Querier, tty TTY, prIn, prOut Properties) (string, error) {
 	xtVer, okXTVer := prIn.Property(propkeys.XTVERSION)
 	if !okXTVer {
-		repl, err := CachedQuery(qu, queries.XTVERSION+queries.DA1, tty, parser.NewParser(false, true), prIn, prOut)
+		repl, err := CachedQuery(qu, queries.XTVERSION+queries.DA1, tty, parser.NewDA1SentinelParser(), prIn, prOut)
 		if err != nil {
 			return ``, err
 		}
-		replParts := strings.Split(repl, queries.ST)
-		if len(replParts) != 2 {
-			return ``, errors.New(`no reply to XTVERSION query`)
-		}
-		xtVerPrefix := queries.DCS + `>|`
-		repl, hasXTVerReplPrefix := strings.CutPrefix(replParts[0], xtVerPrefix)
-		if !hasXTVerReplPrefix {
-			return ``, errors.New(`invalid reply to XTVERSION query`)
+		ver, err := extractXTVersion(repl)
+		if err != nil {
+			return ``, err
 		}
-		xtVer = repl
+		xtVer = ver
 	}
 	prOut.SetProperty(propkeys.XTVERSION, xtVer)
 	return xtVer, nil
 }
+
+// extractXTVersion extracts the version from the ST terminated DCS reply to XTVERSION.
+func extractXTVersion(repl string) (string, error) {
+	seq, found := findSequence(repl, func(seq Sequence) bool { return seq.Type == SeqDCS })
+	if !found {
+		return ``, errors.New(`invalid reply to XTVERSION query`)
+	}
+	xtVer, err := ParseXTVersion(seq)
+	if err != nil {
+		return ``, err
+	}
+	return xtVer.Version, nil
+}
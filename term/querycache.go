@@ -0,0 +1,216 @@
+package term
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/logx"
+	"github.com/srlehn/termimg/internal/queries"
+)
+
+// QueryCache persists terminal replies across processes.
+// The identity is derived from the environment variables naming the terminal,
+// its version and window (e.g. TERM_PROGRAM, TERM_PROGRAM_VERSION, XTERM_VERSION, WINDOWID)
+// and from the pty, it changes whenever one of them changes.
+type QueryCache interface {
+	LoadReply(identity, qs string) (repl string, ok bool)
+	StoreReply(identity, qs, repl string) error
+	Invalidate(identity string) error
+}
+
+// SetQueryCache sets a persistent cache for replies to terminal identification queries.
+// See package query/qcache for an implementation.
+func SetQueryCache(qc QueryCache) Option {
+	return OptFunc(func(t *Terminal) error { t.queryCache = qc; return nil })
+}
+
+var _ Querier = (*persistentQuerier)(nil)
+var _ CachedQuerier = (*persistentQuerier)(nil)
+var _ BatchQuerier = (*persistentQuerier)(nil)
+
+// persistentQuerier wraps the Querier of a Terminal if a QueryCache was set.
+type persistentQuerier struct {
+	Querier
+	cache    QueryCache
+	identity string
+	logger   logx.LoggerProvider
+}
+
+func newPersistentQuerier(qu Querier, qc QueryCache, pr Properties, ptyName string, logger logx.LoggerProvider) Querier {
+	if qu == nil || qc == nil {
+		return qu
+	}
+	if pq, isPQ := qu.(*persistentQuerier); isPQ {
+		qu = pq.Querier
+	}
+	return &persistentQuerier{
+		Querier:  qu,
+		cache:    qc,
+		identity: queryCacheIdentity(pr, ptyName),
+		logger:   logger,
+	}
+}
+
+func (q *persistentQuerier) Query(qs string, tty TTY, p Parser) (string, error) {
+	if q == nil || q.Querier == nil {
+		return ``, errors.NilReceiver()
+	}
+	cacheable := isCacheableQuery(qs)
+	if cacheable {
+		if repl, ok := q.cache.LoadReply(q.identity, qs); ok {
+			if len(repl) == 0 {
+				// stored by QueryBatch for an unsupported query
+				return ``, errors.New(consts.ErrQueryUnsupported)
+			}
+			// the parser might collect the reply, e.g. BatchDemuxer
+			replay(repl, p)
+			return repl, nil
+		}
+	}
+	repl, err := q.Querier.Query(qs, tty, p)
+	if err != nil {
+		return ``, err
+	}
+	if cacheable {
+		q.store(qs, repl)
+	}
+	return repl, nil
+}
+
+// QueryBatch answers the batch from the cache if the replies to all queries are cached.
+// Otherwise the batch is sent with the wrapped Querier and the replies to identification
+// queries are stored, an empty reply for unsupported queries.
+func (q *persistentQuerier) QueryBatch(tty TTY, batch ...BatchQuery) ([]BatchReply, error) {
+	if q == nil || q.Querier == nil {
+		return nil, errors.NilReceiver()
+	}
+	if replies, ok := q.loadBatch(batch); ok {
+		return replies, nil
+	}
+	replies, err := QueryBatch(q.Querier, tty, batch...)
+	if len(replies) != len(batch) {
+		return replies, err
+	}
+	for i, bq := range batch {
+		repl := replies[i]
+		if !isCacheableQuery(bq.Query) ||
+			(repl.Err != nil && !errors.Is(repl.Err, consts.ErrQueryUnsupported)) {
+			continue
+		}
+		q.store(bq.Query, repl.Reply)
+	}
+	return replies, err
+}
+
+func (q *persistentQuerier) loadBatch(batch []BatchQuery) ([]BatchReply, bool) {
+	replies := make([]BatchReply, len(batch))
+	for i, bq := range batch {
+		if !isCacheableQuery(bq.Query) {
+			return nil, false
+		}
+		repl, ok := q.cache.LoadReply(q.identity, bq.Query)
+		if !ok {
+			return nil, false
+		}
+		if len(repl) == 0 {
+			replies[i].Err = consts.ErrQueryUnsupported
+			continue
+		}
+		replay(repl, bq.Parser)
+		replies[i].Reply = repl
+	}
+	return replies, true
+}
+
+// store stores the reply, failures only cost a query in the next process.
+func (q *persistentQuerier) store(qs, repl string) {
+	_ = logx.IsErr(q.cache.StoreReply(q.identity, qs, repl), q.logger, slog.LevelInfo)
+}
+
+// replay feeds a cached reply to the parser of the query.
+func replay(repl string, p Parser) {
+	if p == nil {
+		return
+	}
+	for _, r := range repl {
+		if p.Parse(r) {
+			return
+		}
+	}
+}
+
+func (q *persistentQuerier) CachedQuery(qs string, tty TTY, p Parser, pr Properties) (string, error) {
+	if q == nil {
+		return ``, errors.NilReceiver()
+	}
+	return CachedQuery(q, qs, tty, p, pr, pr)
+}
+
+// Unwrap returns the wrapped Querier.
+func (q *persistentQuerier) Unwrap() Querier {
+	if q == nil {
+		return nil
+	}
+	return q.Querier
+}
+
+func (q *persistentQuerier) Close() error {
+	if q == nil || q.Querier == nil {
+		return nil
+	}
+	if cl, ok := q.Querier.(interface{ Close() error }); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
+// queryCacheIdentity hashes the environment variables that identify
+// the terminal, its version and window together with the pty name.
+// The querier is wrapped before the terminal is detected, the detected
+// name and version aren't known yet.
+func queryCacheIdentity(env environ.Enver, ptyName string) string {
+	id := profileIdentity(env)
+	keys := make([]string, 0, len(id))
+	for k := range id {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k + `=` + id[k] + "\n"))
+	}
+	_, _ = h.Write([]byte(`pty=` + ptyName + "\n"))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// replies to these queries don't change during the lifetime of a terminal
+var cacheableQueries = []string{
+	queries.DA1,
+	queries.DA2,
+	queries.DA3,
+	queries.XTVERSION,
+	queries.KittyTest,
+	queries.ITerm2PropVersion,
+}
+
+var reXTGETTCAPQuery = regexp.MustCompile("\033P\\+q[0-9A-Fa-f;]*\033\\\\")
+
+// isCacheableQuery reports whether qs only consists of identification queries.
+// Resolution, cursor and color queries are never cached.
+func isCacheableQuery(qs string) bool {
+	if len(qs) == 0 {
+		return false
+	}
+	qs = reXTGETTCAPQuery.ReplaceAllString(qs, ``)
+	for _, qsCacheable := range cacheableQueries {
+		qs = strings.ReplaceAll(qs, qsCacheable, ``)
+	}
+	return len(qs) == 0
+}
@@ -0,0 +1,112 @@
+package term
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/internal/environ"
+	"github.com/srlehn/termimg/internal/queries"
+)
+
+type memQueryCache map[string]string
+
+func (c memQueryCache) LoadReply(identity, qs string) (string, bool) {
+	repl, ok := c[identity+qs]
+	return repl, ok
+}
+func (c memQueryCache) StoreReply(identity, qs, repl string) error {
+	c[identity+qs] = repl
+	return nil
+}
+func (c memQueryCache) Invalidate(identity string) error { return nil }
+
+// querierReplay answers every query with repl, fed to the parser like a tty would.
+type querierReplay struct {
+	repl    string
+	queries int
+}
+
+func (q *querierReplay) Query(qs string, tty TTY, p Parser) (string, error) {
+	q.queries++
+	replay(q.repl, p)
+	return q.repl, nil
+}
+
+func TestPersistentQuerierBatch(t *testing.T) {
+	da2 := queries.CSI + `>1;2;3c`
+	da1 := queries.CSI + `?62;4c`
+	inner := &querierReplay{repl: da2 + da1}
+	qu := newPersistentQuerier(inner, memQueryCache{}, environ.NewProperties(), `/dev/pts/0`, nil)
+	batch := []BatchQuery{
+		{Query: queries.DA2, ReplyPrefixes: []string{queries.CSI + `>`}},
+		{Query: queries.DA3, ReplyPrefixes: []string{queries.DCS + `!|`}},
+	}
+
+	for range 2 {
+		replies, err := QueryBatch(qu, &ttyDummy{}, batch...)
+		require.NoError(t, err)
+		require.Len(t, replies, 2)
+		assert.Equal(t, da2, replies[0].Reply)
+		assert.NoError(t, replies[0].Err)
+		assert.ErrorIs(t, replies[1].Err, consts.ErrQueryUnsupported)
+	}
+	// the second batch was answered from the cache
+	assert.Equal(t, 1, inner.queries)
+}
+
+func TestPersistentQuerierReplaysToParser(t *testing.T) {
+	da2 := queries.CSI + `>1;2;3c`
+	inner := &querierReplay{repl: da2}
+	qu := newPersistentQuerier(inner, memQueryCache{}, environ.NewProperties(), `/dev/pts/0`, nil)
+
+	for range 2 {
+		var parsed string
+		p := ParserFunc(func(r rune) bool { parsed += string(r); return r == 'c' })
+		repl, err := qu.Query(queries.DA2, &ttyDummy{}, p)
+		require.NoError(t, err)
+		assert.Equal(t, da2, repl)
+		assert.Equal(t, da2, parsed)
+	}
+	assert.Equal(t, 1, inner.queries)
+}
+
+func TestPersistentQuerierUnsupported(t *testing.T) {
+	// DA3 was unsupported in a previous batch
+	cache := memQueryCache{}
+	qu := newPersistentQuerier(&querierReplay{}, cache, environ.NewProperties(), `/dev/pts/0`, nil)
+	pq := qu.(*persistentQuerier)
+	pq.store(queries.DA3, ``)
+
+	repl, err := qu.Query(queries.DA3, &ttyDummy{}, nil)
+	assert.ErrorIs(t, err, consts.ErrQueryUnsupported)
+	assert.Empty(t, repl)
+	assert.Zero(t, pq.Querier.(*querierReplay).queries)
+}
+
+func TestQueryCacheIdentity(t *testing.T) {
+	pr := environ.EnvToProperties([]string{`TERM=xterm-256color`, `XTERM_VERSION=XTerm(390)`})
+	id := queryCacheIdentity(pr, `/dev/pts/0`)
+	assert.Equal(t, id, queryCacheIdentity(pr, `/dev/pts/0`))
+	assert.NotEqual(t, id, queryCacheIdentity(pr, `/dev/pts/1`))
+
+	// terminal upgrade
+	prUpgraded := environ.EnvToProperties([]string{`TERM=xterm-256color`, `XTERM_VERSION=XTerm(397)`})
+	assert.NotEqual(t, id, queryCacheIdentity(prUpgraded, `/dev/pts/0`))
+}
+
+type querierInput struct{ querierReplay }
+
+func (q *querierInput) ReadInput(tty TTY, p []byte) (int, error) { return copy(p, `k`), nil }
+
+func TestInputReaderUnwraps(t *testing.T) {
+	inner := &querierInput{}
+	qu := newPersistentQuerier(inner, memQueryCache{}, environ.NewProperties(), `/dev/pts/0`, nil)
+	ir, ok := inputReader(qu)
+	require.True(t, ok)
+	assert.Same(t, inner, ir)
+	_, ok = inputReader(&querierReplay{})
+	assert.False(t, ok)
+}
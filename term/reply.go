@@ -0,0 +1,159 @@
+package term
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+type (
+	// Sequence is a token of terminal input produced by the streaming tokenizer.
+	Sequence = parser.Sequence
+	// SeqType is the type of a Sequence.
+	SeqType = parser.SeqType
+	// SequenceParser is a Parser separating reply sequences from unsolicited input.
+	SequenceParser = parser.SequenceParser
+)
+
+const (
+	SeqText    = parser.SeqText
+	SeqControl = parser.SeqControl
+	SeqESC     = parser.SeqESC
+	SeqCSI     = parser.SeqCSI
+	SeqDCS     = parser.SeqDCS
+	SeqOSC     = parser.SeqOSC
+	SeqSOS     = parser.SeqSOS
+	SeqPM      = parser.SeqPM
+	SeqAPC     = parser.SeqAPC
+)
+
+// Tokenize splits terminal input into sequences, text and control characters.
+func Tokenize(s string) []Sequence { return parser.Tokenize(s) }
+
+// NewSequenceParser returns a Parser whose reply consists of the first n sequences accepted by match.
+// A nil match accepts any escape sequence.
+func NewSequenceParser(match func(Sequence) bool, n int) *SequenceParser {
+	return parser.NewSequenceParser(match, n)
+}
+
+// QuerySequences sends qs and returns the first n reply sequences accepted by match.
+// Other input received meanwhile, e.g. key presses, is returned as unsolicited.
+func QuerySequences(qu Querier, tty TTY, qs string, match func(Sequence) bool, n int) (replies, unsolicited []Sequence, _ error) {
+	if qu == nil || tty == nil {
+		return nil, nil, errors.NilParam()
+	}
+	p := NewSequenceParser(match, n)
+	_, err := qu.Query(qs, tty, p)
+	return p.Replies(), p.Unsolicited(), err
+}
+
+// findSequence returns the first sequence in repl accepted by match.
+func findSequence(repl string, match func(Sequence) bool) (Sequence, bool) {
+	for _, seq := range parser.Tokenize(repl) {
+		if match(seq) {
+			return seq, true
+		}
+	}
+	return Sequence{}, false
+}
+
+// DA1Reply - Primary Device Attributes (CSI ? Pc ; Ps... c)
+type DA1Reply struct {
+	Class      string
+	Attributes []string
+}
+
+// ParseDA1 ...
+func ParseDA1(seq Sequence) (*DA1Reply, error) {
+	if !parser.IsDA1Reply(seq) {
+		return nil, errors.New(`not a DA1 reply`)
+	}
+	params := seq.ParamList()
+	if len(params) == 0 {
+		return nil, errors.New(`empty DA1 reply`)
+	}
+	return &DA1Reply{Class: params[0], Attributes: params[1:]}, nil
+}
+
+// DA2Reply - Secondary Device Attributes (CSI > Pp ; Pv ; Pc c)
+type DA2Reply struct {
+	Model    string
+	Version  string
+	Keyboard string
+}
+
+// ParseDA2 ...
+func ParseDA2(seq Sequence) (*DA2Reply, error) {
+	if !seq.Is(SeqCSI, '>', ``, 'c') {
+		return nil, errors.New(`not a DA2 reply`)
+	}
+	params := seq.ParamList()
+	if len(params) != 3 {
+		return nil, errors.New(`invalid DA2 reply`)
+	}
+	return &DA2Reply{Model: params[0], Version: params[1], Keyboard: params[2]}, nil
+}
+
+// DA3Reply - Tertiary Device Attributes (DCS ! | D...D ST)
+type DA3Reply struct {
+	IDHex string
+	ID    string
+}
+
+// ParseDA3 ...
+func ParseDA3(seq Sequence) (*DA3Reply, error) {
+	if !seq.Is(SeqDCS, 0, `!`, '|') {
+		return nil, errors.New(`not a DA3 reply`)
+	}
+	id, err := hex.DecodeString(seq.Payload)
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	return &DA3Reply{IDHex: seq.Payload, ID: string(id)}, nil
+}
+
+// XTVersionReply - reply to XTVERSION (DCS > | text ST)
+type XTVersionReply struct {
+	Version string
+}
+
+// ParseXTVersion ...
+func ParseXTVersion(seq Sequence) (*XTVersionReply, error) {
+	if !seq.Is(SeqDCS, '>', ``, '|') {
+		return nil, errors.New(`invalid reply to XTVERSION query`)
+	}
+	return &XTVersionReply{Version: seq.Payload}, nil
+}
+
+// XTGetTCapReply - reply to XTGETTCAP (DCS Ps + r Pt ST)
+type XTGetTCapReply struct {
+	Valid bool
+	// Caps maps the hex encoded capability names to the decoded values.
+	Caps map[string]string
+}
+
+// ParseXTGetTCap ...
+func ParseXTGetTCap(seq Sequence) (*XTGetTCapReply, error) {
+	if seq.Type != SeqDCS || seq.Intermediates != `+` || seq.Final != 'r' {
+		return nil, errors.New(`not a XTGETTCAP reply`)
+	}
+	switch seq.Params {
+	case `0`:
+		return &XTGetTCapReply{}, nil
+	case `1`:
+	default:
+		return nil, errors.New(`unknown reply format`)
+	}
+	r := &XTGetTCapReply{Valid: true, Caps: make(map[string]string)}
+	for _, cap := range strings.Split(seq.Payload, `;`) {
+		name, valHex, _ := strings.Cut(cap, `=`)
+		val, err := hex.DecodeString(valHex)
+		if err != nil {
+			return nil, errors.New(err)
+		}
+		r.Caps[strings.ToUpper(name)] = string(val)
+	}
+	return r, nil
+}
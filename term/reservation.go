@@ -0,0 +1,348 @@
+package term
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/logx"
+)
+
+// FlushAction is what a Reservation does with the graphics after the TUI framework flushed a frame.
+// Drawers choose it by implementing interface{ FlushAction() FlushAction }, the default is FlushRedraw.
+type FlushAction int
+
+const (
+	// FlushRedraw redraws the graphics when the framework rewrote the reserved cells.
+	// Drawers drawing into the cells (sixel, iTerm2) are erased by writes to the cells,
+	// moved or removed graphics are erased when the framework rewrites the placeholders.
+	FlushRedraw FlushAction = iota
+	// FlushClear clears the placements of the terminal when the image moves or is removed.
+	// Drawers placing images over the cells (kitty) aren't erased by writes to the cells.
+	FlushClear
+)
+
+// Placeholder is the rune a framework renders in the reserved cells.
+// It is blank, but differs from a space, so that diffing renderers rewrite the cells when
+// the image is gone and don't clear them with erase sequences.
+const Placeholder = '\u00a0' // no-break space
+
+// PlaceholderCell is the content of a reserved cell.
+type PlaceholderCell struct {
+	Rune rune
+	// Fg and Bg are the colors of the cell, nil for the default colors of the framework.
+	Fg, Bg color.Color
+}
+
+// Reservation reserves cells of the screen of a TUI framework for an image.
+//
+// The framework renders the cells returned by Placeholder in the reserved cells, passes
+// the position of the image in the current frame to Place and calls Flushed after
+// it wrote the frame to the terminal.
+// Flushed draws, redraws or clears the graphics depending on the drawer (see FlushAction).
+type Reservation struct {
+	term *Terminal
+
+	mu          sync.Mutex
+	img         image.Image
+	canvas      *Canvas
+	place       Placement // in the current frame
+	shown       Placement // graphics on screen
+	shownImage  image.Image
+	shownClears uint64
+}
+
+// Placement is the position of an image in a frame.
+type Placement struct {
+	Area    image.Rectangle // visible screen cells
+	Content image.Rectangle // visible cells of the image, Area translated
+	Size    image.Point     // size of the image in cells
+}
+
+// Visible reports whether a part of the image is on screen.
+func (p Placement) Visible() bool { return !p.Area.Empty() }
+
+// Reserve creates a reservation for img. It is placed with Reservation.Place,
+// the cells are reserved by rendering Reservation.Placeholder.
+func (t *Terminal) Reserve(img image.Image) (*Reservation, error) {
+	if err := errors.NilReceiver(t); err != nil {
+		return nil, err
+	}
+	return &Reservation{term: t, img: img}, nil
+}
+
+// Placeholder returns the cell the framework renders in each reserved cell.
+func (r *Reservation) Placeholder() PlaceholderCell {
+	return PlaceholderCell{Rune: Placeholder}
+}
+
+// SetImage replaces the image. It is drawn by the next Flushed.
+func (r *Reservation) SetImage(img image.Image) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.img = img
+}
+
+// Place sets the position of the image in the frame the framework is about to flush.
+// A zero Placement removes the image from the frame.
+func (r *Reservation) Place(p Placement) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !p.Visible() {
+		p = Placement{}
+	}
+	r.place = p
+}
+
+// Placement returns the position of the image in the current frame.
+func (r *Reservation) Placement() Placement {
+	if r == nil {
+		return Placement{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.place
+}
+
+// Shown returns the position of the graphics on screen.
+func (r *Reservation) Shown() Placement {
+	if r == nil {
+		return Placement{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shown
+}
+
+// Invalidate causes the graphics to be redrawn by the next Flushed, e.g. after the screen was erased.
+func (r *Reservation) Invalidate() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shown, r.shownImage = Placement{}, nil
+}
+
+// Pending reports whether the next Flushed draws the graphics.
+func (r *Reservation) Pending() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pending()
+}
+
+// Stale reports whether graphics on screen don't match the current frame.
+func (r *Reservation) Stale() bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shown.Visible() && (r.shown != r.place || r.shownImage != r.img)
+}
+
+// FlushAction returns the action of the drawer of the terminal.
+func (r *Reservation) FlushAction() FlushAction {
+	if r == nil {
+		return FlushRedraw
+	}
+	return flushAction(r.term)
+}
+
+func flushAction(t *Terminal) FlushAction {
+	drawers := t.Drawers()
+	if len(drawers) == 0 {
+		return FlushRedraw
+	}
+	if fa, ok := drawers[0].(interface{ FlushAction() FlushAction }); ok {
+		return fa.FlushAction()
+	}
+	return FlushRedraw
+}
+
+// Flushed is called after the framework wrote the frame to the terminal.
+// rewritten reports whether the framework might have written to the reserved cells,
+// e.g. after erasing the screen. Frameworks with several images use FlushReservations.
+func (r *Reservation) Flushed(rewritten bool) error {
+	return FlushReservations(rewritten, r)
+}
+
+// FlushReservations calls Flushed for the reservations of a frame. The placements are
+// cleared at most once and the graphics are drawn after the clearing.
+func FlushReservations(rewritten bool, rs ...*Reservation) error {
+	var cleared bool
+	for _, r := range rs {
+		if r == nil || r.term == nil {
+			continue
+		}
+		r.mu.Lock()
+		// drawers placing images over the cells delete the image they cover,
+		// a replaced image doesn't require clearing
+		if !cleared && flushAction(r.term) == FlushClear && r.shown.Visible() && r.shown != r.place {
+			ClearPlacements(r.term)
+			cleared = true
+		}
+		r.mu.Unlock()
+	}
+	var errs []error
+	for _, r := range rs {
+		if r == nil || r.term == nil {
+			continue
+		}
+		r.mu.Lock()
+		switch flushAction(r.term) {
+		case FlushClear:
+			if r.shownClears != r.term.PlacementsCleared() {
+				r.shown, r.shownImage = Placement{}, nil
+			}
+		case FlushRedraw:
+			if rewritten {
+				r.shown, r.shownImage = Placement{}, nil
+			}
+		}
+		if r.pending() {
+			errs = append(errs, r.draw())
+		}
+		r.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Reservation) pending() bool {
+	return r.place.Visible() && r.img != nil && (r.shown != r.place || r.shownImage != r.img)
+}
+
+// draw draws the graphics of the visible image. r.mu has to be locked.
+func (r *Reservation) draw() error {
+	tm := r.term
+	img, err := CropPlacement(r.img, r.place)
+	if logx.IsErr(err, tm, slog.LevelError) {
+		return err
+	}
+	canvas, err := tm.MoveCanvas(r.canvas, r.place.Area, r.shown == r.place)
+	if logx.IsErr(err, tm, slog.LevelError) {
+		return err
+	}
+	r.canvas = canvas
+	// a failed draw isn't retried until the image is invalidated
+	r.shown, r.shownImage, r.shownClears = r.place, r.img, tm.PlacementsCleared()
+	// drawers move the cursor, the framework's renderer expects it where it left it
+	_, _ = tm.WriteString("\0337")
+	defer func() { _, _ = tm.WriteString("\0338") }()
+	return logx.Err(r.canvas.Draw(img), tm, slog.LevelError)
+}
+
+// Video plays vid in the cells of the shown graphics, see Canvas.Video.
+func (r *Reservation) Video(ctx context.Context, vid <-chan image.Image, frameDur time.Duration) error {
+	if r == nil {
+		return errors.NilReceiver()
+	}
+	r.mu.Lock()
+	canvas, shown := r.canvas, r.shown
+	r.mu.Unlock()
+	if canvas == nil || !shown.Visible() {
+		return errors.New(`image not drawn`)
+	}
+	return canvas.Video(ctx, vid, frameDur)
+}
+
+// Close clears the graphics of drawers placing them over the cells and releases the canvas.
+// Graphics drawn into the cells are erased when the framework rewrites the placeholders.
+func (r *Reservation) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shown.Visible() && flushAction(r.term) == FlushClear {
+		ClearPlacements(r.term)
+	}
+	r.place, r.shown, r.shownImage = Placement{}, Placement{}, nil
+	if r.canvas == nil {
+		return nil
+	}
+	err := r.canvas.Close()
+	r.canvas = nil
+	return logx.Err(err, r.term, slog.LevelError)
+}
+
+// ClearPlacements removes the images of drawers placing them over the cells (kitty).
+// Reservations drawn before are redrawn by their next Flushed.
+func ClearPlacements(t *Terminal) {
+	if t == nil {
+		return
+	}
+	// drawers move the cursor
+	_, _ = t.WriteString("\0337")
+	defer func() { _, _ = t.WriteString("\0338") }()
+	var cleared bool
+	for _, dr := range t.Drawers() {
+		switch clearer := dr.(type) {
+		case placementClearer:
+			_ = logx.IsErr(clearer.ClearPlacements(t), t, slog.LevelInfo)
+		case interface{ Clear(tm *Terminal) error }:
+			_ = logx.IsErr(clearer.Clear(t), t, slog.LevelInfo)
+		default:
+			continue
+		}
+		cleared = true
+	}
+	if cleared && t.placementsCleared != nil {
+		t.placementsCleared.Add(1)
+	}
+}
+
+// PlacementsCleared counts the calls of ClearPlacements that removed images.
+// Images drawn before a change of the count have to be redrawn.
+func (t *Terminal) PlacementsCleared() uint64 {
+	if t == nil || t.placementsCleared == nil {
+		return 0
+	}
+	return t.placementsCleared.Load()
+}
+
+// CropPlacement returns the part of img shown in the visible cells of the placement.
+func CropPlacement(img image.Image, p Placement) (image.Image, error) {
+	if p.Content.Eq(image.Rectangle{Max: p.Size}) {
+		return img, nil
+	}
+	if ti, ok := img.(*Image); ok {
+		decoded, err := ti.Image()
+		if err != nil {
+			return nil, err
+		}
+		img = decoded
+	}
+	b := img.Bounds()
+	w, h := p.Size.X, p.Size.Y
+	if w <= 0 || h <= 0 {
+		return nil, errors.New(`empty placement`)
+	}
+	c := p.Content
+	r := image.Rect(
+		b.Min.X+c.Min.X*b.Dx()/w, b.Min.Y+c.Min.Y*b.Dy()/h,
+		b.Min.X+c.Max.X*b.Dx()/w, b.Min.Y+c.Max.Y*b.Dy()/h,
+	)
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r), nil
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst, nil
+}
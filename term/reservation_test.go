@@ -0,0 +1,144 @@
+package term
+
+import (
+	"context"
+	"image"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drawerRecorder records the areas drawn into and the clearings of the placements.
+type drawerRecorder struct {
+	action  FlushAction
+	drawn   []image.Rectangle
+	cleared int
+}
+
+func (d *drawerRecorder) Name() string                                       { return `recorder` }
+func (d *drawerRecorder) New() Drawer                                        { return d }
+func (d *drawerRecorder) IsApplicable(DrawerCheckerInput) (bool, Properties) { return true, nil }
+func (d *drawerRecorder) FlushAction() FlushAction                           { return d.action }
+func (d *drawerRecorder) ClearPlacements(*Terminal) error                    { d.cleared++; return nil }
+func (d *drawerRecorder) Draw(_ image.Image, bounds image.Rectangle, _ *Terminal) error {
+	d.drawn = append(d.drawn, bounds)
+	return nil
+}
+func (d *drawerRecorder) Prepare(_ context.Context, img image.Image, bounds image.Rectangle, tm *Terminal) (func() error, error) {
+	return func() error { return d.Draw(img, bounds, tm) }, nil
+}
+
+// newRecorderTerminal returns a terminal with 2 x 2 pixel cells drawing with dr.
+func newRecorderTerminal(dr *drawerRecorder) *Terminal {
+	tm := newDummyTerminal()
+	tm.tty = &ttyPipe{Reader: strings.NewReader(``)}
+	tm.drawers = []Drawer{dr}
+	tm.surveyor = getSurveyor(&SurveyorDefault{}, tm.properties)
+	now := time.Now()
+	tm.resCellInPxlsW, tm.resCellInPxlsH = 2, 2
+	tm.timeResCellInPxls, tm.timeLastSizeCheck = now, now
+	return tm
+}
+
+// newFilledImage returns a 4 x 4 pixel image filled with v, canvases only redraw changed pixels.
+func newFilledImage(v uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func placementAt(x, y int) Placement {
+	area := image.Rect(x, y, x+2, y+2)
+	return Placement{Area: area, Content: image.Rect(0, 0, 2, 2), Size: image.Pt(2, 2)}
+}
+
+func TestFlushReservationsRedraw(t *testing.T) {
+	dr := &drawerRecorder{action: FlushRedraw}
+	tm := newRecorderTerminal(dr)
+	res, err := tm.Reserve(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	require.NoError(t, err)
+
+	res.Place(placementAt(1, 1))
+	assert.True(t, res.Pending())
+	require.NoError(t, res.Flushed(false))
+	assert.Equal(t, []image.Rectangle{image.Rect(1, 1, 3, 3)}, dr.drawn)
+	assert.Equal(t, placementAt(1, 1), res.Shown())
+
+	require.NoError(t, res.Flushed(false))
+	assert.Len(t, dr.drawn, 1, `unchanged frame`)
+
+	require.NoError(t, res.Flushed(true))
+	assert.Len(t, dr.drawn, 2, `redrawn after the cells were rewritten`)
+
+	res.Place(placementAt(3, 1))
+	assert.True(t, res.Stale())
+	require.NoError(t, res.Flushed(false))
+	assert.Equal(t, image.Rect(3, 1, 5, 3), dr.drawn[2], `moved`)
+	assert.Zero(t, dr.cleared, `graphics drawn into the cells aren't cleared`)
+}
+
+func TestFlushReservationsClearOnce(t *testing.T) {
+	dr := &drawerRecorder{action: FlushClear}
+	tm := newRecorderTerminal(dr)
+	var rs []*Reservation
+	for i := range 3 {
+		res, err := tm.Reserve(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+		require.NoError(t, err)
+		res.Place(placementAt(3*i, 0))
+		rs = append(rs, res)
+	}
+	require.NoError(t, FlushReservations(false, rs...))
+	assert.Len(t, dr.drawn, 3)
+	assert.Zero(t, dr.cleared)
+
+	// a replaced image is covered by the new one
+	rs[0].SetImage(newFilledImage(0xff))
+	require.NoError(t, FlushReservations(false, rs...))
+	assert.Len(t, dr.drawn, 4)
+	assert.Zero(t, dr.cleared)
+
+	// two moved images clear the placements once, all images are redrawn after the clearing
+	rs[0].Place(placementAt(0, 3))
+	rs[1].Place(Placement{})
+	require.NoError(t, FlushReservations(false, rs...))
+	assert.Equal(t, 1, dr.cleared)
+	assert.Equal(t, []image.Rectangle{image.Rect(0, 3, 2, 5), image.Rect(6, 0, 8, 2)}, dr.drawn[4:])
+	assert.Equal(t, uint64(1), tm.PlacementsCleared())
+	assert.False(t, rs[1].Shown().Visible())
+
+	require.NoError(t, FlushReservations(true, rs...))
+	assert.Len(t, dr.drawn, 6, `placements over the cells survive rewrites`)
+}
+
+func TestCropPlacement(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 10, 50, 30)) // 4 x 2 cells of 10 x 10 pixels
+	tests := []struct {
+		name    string
+		content image.Rectangle
+		want    image.Rectangle
+	}{
+		{`whole image`, image.Rect(0, 0, 4, 2), image.Rect(10, 10, 50, 30)},
+		{`left half`, image.Rect(0, 0, 2, 2), image.Rect(10, 10, 30, 30)},
+		{`bottom right cell`, image.Rect(3, 1, 4, 2), image.Rect(40, 20, 50, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CropPlacement(img, Placement{Content: tt.content, Size: image.Pt(4, 2)})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Bounds())
+		})
+	}
+
+	_, err := CropPlacement(img, Placement{Content: image.Rect(0, 0, 1, 1)})
+	assert.Error(t, err, `empty placement`)
+
+	// images without SubImage are copied
+	crop, err := CropPlacement(struct{ image.Image }{img}, Placement{Content: image.Rect(1, 0, 2, 1), Size: image.Pt(2, 1)})
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 20), crop.Bounds())
+}
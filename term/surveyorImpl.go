@@ -35,9 +35,6 @@ func sizeInCellsQuery(qu Querier, tty TTY) (widthCells, heightCells uint, e erro
 	// query terminal size in character boxes
 	// answer: <termHeightInRows>;<termWidthInColumns>t
 	qs := "\033[18t"
-	/*if needsWrap {
-		qs = mux.Wrap(qs)
-	}*/
 
 	repl, err := qu.Query(qs, tty, parser.StopOnAlpha)
 	if err != nil {
@@ -72,9 +69,6 @@ func sizeInPixelsQuery(qu Querier, tty TTY) (widthPixels, heightPixels uint, e e
 	// query terminal size in pixels
 	// answer: <termHeightInPixels>;<termWidthInPixels>t
 	qs := "\033[14t"
-	/*if needsWrap {
-		qs = mux.Wrap(qs)
-	}*/
 	repl, err := qu.Query(qs, tty, parser.StopOnAlpha)
 	if err != nil {
 		return 0, 0, err
@@ -108,9 +102,6 @@ func getCursorQuery(qu Querier, tty TTY) (widthCells, heightCells uint, err erro
 	// answer ?: ESC[<heightCells>;<heightCells>R // TODO
 	// answer: !|<alnum>ESC\ESC[<heightCells>;<heightCells>R
 	qs := "\033[6n"
-	/*if needsWrap {
-		qs = mux.Wrap(qs)
-	}*/
 
 	repl, err := qu.Query(qs, tty, parser.StopOnR)
 	if err != nil {
@@ -147,9 +138,6 @@ func setCursorQuery(widthCells, heightCells uint, tty TTY) (err error) {
 	// empty answer
 	// alternatively \033[%d;%df // TODO
 	qs := fmt.Sprintf("\033[%d;%dH", heightCells, widthCells)
-	/*if needsWrap {
-		qs = mux.Wrap(qs)
-	}*/
 	_, err = tty.Write([]byte(qs))
 
 	if err != nil {
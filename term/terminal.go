@@ -1,8 +1,10 @@
 package term
 
 import (
+	"context"
 	"fmt"
 	"image"
+	"io"
 	"log/slog"
 	"maps"
 	"math"
@@ -12,6 +14,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
@@ -82,9 +85,15 @@ type Terminal struct {
 	drawers         []Drawer
 	resizer         Resizer
 	passages        mux.Muxers
+	muxRW           *mux.ReadWriter // tty wrapped for passages
+	panes           *mux.PaneTracker
+	queryCache      QueryCache
+	detectionCtx    context.Context
 	printMu         *sync.Mutex
 	afterSetupFuncs []func(*Terminal)
 
+	placementsCleared *atomic.Uint64 // see PlacementsCleared
+
 	ttyDefault                              TTY
 	querierDefault                          Querier
 	ttyProv, ttyProvDefault                 ttyProvider
@@ -118,6 +127,16 @@ type Terminal struct {
 //
 // "Enforced" Options have precedence over the TermCheckers suggestion.
 func NewTerminal(opts ...Option) (*Terminal, error) {
+	return NewTerminalContext(context.Background(), opts...)
+}
+
+// NewTerminalContext is like NewTerminal but limits the terminal detection.
+// When ctx is done, no further queries are sent and the best match found
+// until then is used.
+func NewTerminalContext(ctx context.Context, opts ...Option) (*Terminal, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	tm := newDummyTerminal()
 	opts = append(opts, setInternalDefaults, setEnvAndMuxers(true))
 	if err := tm.SetOptions(opts...); logx.IsErr(err, tm, slog.LevelError) {
@@ -131,22 +150,33 @@ func NewTerminal(opts ...Option) (*Terminal, error) {
 
 	var checker TermChecker
 	composeManuallyStr, composeManually := tm.Property(propkeys.ManualComposition)
-	if !composeManually || composeManuallyStr != `true` {
+	noQueryStr, noQuery := tm.Property(propkeys.NoQuery)
+	switch {
+	case composeManually && composeManuallyStr == `true`:
+		checker = &termCheckerCore{} // dummy
+	case noQuery && noQueryStr == `true` && RegisteredTermChecker(tm.Name()) != nil:
+		// terminal name was restored from a saved profile
+		checker = RegisteredTermChecker(tm.Name())
+		logx.Info(`skipping terminal detection`, tm, `terminal`, tm.Name())
+	default:
 		// find terminal checker
-		chk, prChecker, err := findTermChecker(tm.properties, ttyTmp, quTmp)
+		if ttyTmp == tm.tty {
+			ttyTmp = tm.queryTTY()
+		}
+		chk, prChecker, err := findTermChecker(ctx, tm.properties, ttyTmp, newCtxQuerier(ctx, quTmp), tm)
 		if logx.IsErr(err, tm, slog.LevelInfo) {
 			return nil, err
 		}
 		tm.properties.MergeProperties(prChecker)
 		checker = chk
-	} else {
-		checker = &termCheckerCore{} // dummy
 	}
 	// terminal specific settings
+	tm.detectionCtx = ctx
 	tm, err = checker.NewTerminal(replaceTerminal(tm))
 	if logx.IsErr(err, tm, slog.LevelInfo) {
 		return nil, err
 	}
+	tm.detectionCtx = nil
 
 	return tm, nil
 }
@@ -155,6 +185,8 @@ func newDummyTerminal() *Terminal {
 		properties: environ.NewProperties(),
 		printMu:    &sync.Mutex{},
 		closer:     internal.NewCloser(),
+
+		placementsCleared: &atomic.Uint64{},
 	}
 	tm.SetProperty(propkeys.EnvIsLoaded, `merge`)
 	return tm
@@ -244,11 +276,12 @@ func getTTYAndQuerier(tm *Terminal, tc *termCheckerCore) (TTY, Querier, error) {
 			return nil, nil, errors.New(`nil querier`)
 		}
 	}
+	quTemp = newPersistentQuerier(quTemp, tm.queryCache, tm.properties, tm.ptyName(), tm)
 
 	return ttyTemp, quTemp, nil
 }
 
-func findTermChecker(env Properties, tty TTY, qu Querier) (tc TermChecker, _ Properties, e error) {
+func findTermChecker(ctx context.Context, env Properties, tty TTY, qu Querier, logger logx.LoggerProvider) (tc TermChecker, _ Properties, e error) {
 	var ttyTemp TTY
 	if tty == nil || qu == nil {
 		return RegisteredTermChecker(consts.TermGenericName), nil, errors.NilParam()
@@ -265,14 +298,7 @@ func findTermChecker(env Properties, tty TTY, qu Querier) (tc TermChecker, _ Pro
 	// run preliminary checks, to see which test should be avoided in the final checks
 	// e.g. querying conhost
 	terminalCheckersAll := AllTerminalCheckers()
-	for _, tchk := range terminalCheckersAll {
-		if tchk == nil {
-			continue
-		}
-		mightBe, prE := tchk.CheckExclude(env)
-		_ = mightBe
-		pr.MergeProperties(prE)
-	}
+	pr.MergeProperties(checkExcludeAll(terminalCheckersAll, env, logger))
 
 	defer func() {
 		r := recover()
@@ -301,6 +327,10 @@ func findTermChecker(env Properties, tty TTY, qu Querier) (tc TermChecker, _ Pro
 			if tchk == nil {
 				continue
 			}
+			if ctx.Err() != nil {
+				// deadline exceeded - decide with the checks completed so far
+				break
+			}
 			tchkName := tchk.Name()
 			passedExcl, okPassedExcl := pr.Property(propkeys.CheckTermEnvExclPrefix + tchkName)
 			var exclEnvSkipped bool
@@ -487,7 +517,7 @@ func (t *Terminal) query(qs string, p Parser) (_ string, err error) {
 	if _, avoidANSI := t.Property(propkeys.AvoidANSI); avoidANSI {
 		return ``, errors.New(consts.ErrPlatformNotSupported)
 	}
-	return t.querier.Query(qs, t.tty, p)
+	return t.querier.Query(qs, t.queryTTY(), p)
 }
 
 // CreateTemp ...
@@ -524,6 +554,12 @@ func (t *Terminal) Close() error {
 	if t == nil || t.closer == nil {
 		return nil
 	}
+	if t.muxRW != nil && t.printMu != nil {
+		// an incomplete sequence held back for the multiplexers
+		t.printMu.Lock()
+		_ = logx.IsErr(t.muxRW.Flush(), t, slog.LevelInfo)
+		t.printMu.Unlock()
+	}
 	return t.closer.Close()
 }
 
@@ -567,13 +603,14 @@ func (t *Terminal) Printf(format string, a ...any) (int, error) {
 	if t == nil {
 		return 0, errors.NilReceiver()
 	}
-	n, err := t.WriteString(t.passages.Wrap(fmt.Sprintf(format, a...)))
+	n, err := t.WriteString(fmt.Sprintf(format, a...))
 	if logx.IsErr(err, t, slog.LevelInfo) {
 		return n, errors.New(err)
 	}
 	return n, nil
 }
 
+// Write passes image sequences and terminal queries through the terminal multiplexers.
 func (t *Terminal) Write(p []byte) (n int, err error) {
 	if t == nil {
 		return 0, errors.NilReceiver()
@@ -588,13 +625,60 @@ func (t *Terminal) Write(p []byte) (n int, err error) {
 	}()
 	t.printMu.Lock()
 	defer t.printMu.Unlock()
-	return t.tty.Write(p)
+	return t.muxReadWriter().Write(p)
+}
+
+// Read reads the input of the terminal, e.g. key presses.
+// If the querier keeps reading the tty (InputReader), the input it received
+// outside of query replies is returned.
+func (t *Terminal) Read(p []byte) (n int, err error) {
+	if t == nil {
+		return 0, errors.NilReceiver()
+	}
+	if t.tty == nil {
+		return 0, errors.New(`nil tty`)
+	}
+	if ir, ok := inputReader(t.querier); ok {
+		return ir.ReadInput(t.queryTTY(), p)
+	}
+	t.printMu.Lock()
+	rw := t.muxReadWriter()
+	t.printMu.Unlock()
+	return rw.Read(p)
 }
+
 func (t *Terminal) WriteString(s string) (n int, err error) {
 	b := unsafe.Slice(unsafe.StringData(s), len(s))
 	return t.Write(b)
 }
 
+// WritePassthrough passes s as a whole through the terminal multiplexers
+// to the outer terminal, e.g. for positioning the cursor outside of the pane.
+func (t *Terminal) WritePassthrough(s string) (n int, err error) {
+	if t == nil {
+		return 0, errors.NilReceiver()
+	}
+	if t.tty == nil {
+		return 0, errors.New(`nil tty`)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(r)
+		}
+	}()
+	t.printMu.Lock()
+	defer t.printMu.Unlock()
+	return t.muxReadWriter().WritePassthrough(unsafe.Slice(unsafe.StringData(s), len(s)))
+}
+
+// muxReadWriter returns the tty wrapped for the multiplexers, printMu has to be locked.
+func (t *Terminal) muxReadWriter() *mux.ReadWriter {
+	if t.muxRW == nil || t.muxRW.Unwrap() != io.ReadWriter(t.tty) {
+		t.muxRW = t.passages.ReadWriter(t.tty)
+	}
+	return t.muxRW
+}
+
 func (t *Terminal) Draw(img image.Image, bounds image.Rectangle) error {
 	return Draw(img, bounds, t, nil)
 }
@@ -662,6 +746,8 @@ func (t *Terminal) watchWINCHStart() error {
 			}
 			tmNow := time.Now()
 			t.timeLastSizeCheck = tmNow
+			// multiplexer panes are rearranged on resize
+			t.panes.Invalidate()
 			if res.TermInCellsW > 0 && res.TermInCellsH > 0 {
 				t.resTermInCellsW = res.TermInCellsW
 				t.resTermInCellsH = res.TermInCellsH
@@ -836,6 +922,10 @@ func (t *Terminal) SizeInCells() (width, height uint, err error) {
 		return t.resTermInCellsW, t.resTermInCellsH, nil
 	}
 	w, h, err := t.surveyor.SizeInCells(t.tty, t.querier, t.window, t.properties)
+	if err == nil && (w != t.resTermInCellsW || h != t.resTermInCellsH) {
+		// panes are rearranged on resize
+		t.panes.Invalidate()
+	}
 	if !t.timeLastSizeCheck.IsZero() && err == nil && w > 0 && h > 0 {
 		t.resTermInCellsW = w
 		t.resTermInCellsH = h
@@ -919,6 +1009,23 @@ func (t *Terminal) NewCanvas(bounds image.Rectangle) (*Canvas, error) {
 	return c, nil
 }
 
+// MoveCanvas returns c moved to the cells of bounds, or a new canvas if c is nil.
+// onScreen reports whether the graphics drawn last with c are still shown at bounds,
+// otherwise the next Draw redraws the whole canvas instead of only the changed cells.
+func (t *Terminal) MoveCanvas(c *Canvas, bounds image.Rectangle, onScreen bool) (*Canvas, error) {
+	if c == nil {
+		return t.NewCanvas(bounds)
+	}
+	if !c.CellArea().Eq(bounds) {
+		if err := c.SetCellArea(bounds); err != nil {
+			return nil, err
+		}
+	} else if !onScreen {
+		c.Invalidate()
+	}
+	return c, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 
 type ttyProvider func(ptyName string) (TTY, error)
@@ -2,6 +2,8 @@ package term
 
 import (
 	"io"
+
+	"github.com/srlehn/termimg/mux"
 )
 
 // TTY ...
@@ -20,3 +22,24 @@ func (t *Terminal) TTY() TTY {
 	}
 	return t.tty
 }
+
+// muxTTY is the tty handed to the querier. Queries are written through the
+// multiplexer wrapping like other output and the passthrough framing is
+// removed from the replies.
+type muxTTY struct {
+	TTY
+	rw *mux.ReadWriter
+}
+
+func (m *muxTTY) Read(p []byte) (int, error)  { return m.rw.Read(p) }
+func (m *muxTTY) Write(p []byte) (int, error) { return m.rw.Write(p) }
+
+// queryTTY returns the tty for the querier.
+func (t *Terminal) queryTTY() TTY {
+	if t == nil || t.tty == nil {
+		return nil
+	}
+	t.printMu.Lock()
+	defer t.printMu.Unlock()
+	return &muxTTY{TTY: t.tty, rw: t.muxReadWriter()}
+}
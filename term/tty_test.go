@@ -0,0 +1,38 @@
+package term
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ttyPipe replays its input and records what is written.
+type ttyPipe struct {
+	io.Reader
+	strings.Builder
+}
+
+func (t *ttyPipe) Close() error                { return nil }
+func (t *ttyPipe) TTYDevName() string          { return `pipe` }
+func (t *ttyPipe) Read(p []byte) (int, error)  { return t.Reader.Read(p) }
+func (t *ttyPipe) Write(p []byte) (int, error) { return t.Builder.Write(p) }
+
+func TestQueryTTY(t *testing.T) {
+	tty := &ttyPipe{Reader: strings.NewReader("\033Ptmux;\033\033P>|XTerm(390)\033\033\\\033\\")}
+	tm := newDummyTerminal()
+	tm.tty = tty
+
+	qtty := tm.queryTTY()
+	require.NotNil(t, qtty)
+	assert.Equal(t, `pipe`, qtty.TTYDevName())
+	_, err := qtty.Write([]byte("\033[>q"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[>q", tty.String())
+
+	repl, err := io.ReadAll(qtty)
+	require.NoError(t, err)
+	assert.Equal(t, "\033P>|XTerm(390)\033\\", string(repl), `passthrough framing removed`)
+}
@@ -0,0 +1,219 @@
+package term
+
+import (
+	"fmt"
+	"image"
+	"time"
+)
+
+// maxVideoLevel is the highest load level of Canvas.Video, each level halves the resolution of the frames.
+const maxVideoLevel = 2
+
+// videoClockPoll is the interval in which Canvas.Video rechecks a clock set by SetVideoClock, it might be paused.
+const videoClockPoll = 50 * time.Millisecond
+
+// VideoStats are the statistics of the running or last video of a Canvas.
+type VideoStats struct {
+	Frames  int           // frames drawn
+	Dropped int           // frames skipped because they were late or failed
+	Encode  time.Duration // average preparation time of a frame by the drawer
+	Write   time.Duration // average time of writing a frame to the terminal
+	Latency time.Duration // average delay of the drawn frames behind their schedule
+	FPS     float64       // frames drawn per second
+	Level   int           // load level, each level halves the resolution of the frames
+}
+
+func (s VideoStats) String() string {
+	return fmt.Sprintf(`%.1f fps, %d frames, %d dropped, encode %v, write %v, latency %v, level %d`,
+		s.FPS, s.Frames, s.Dropped,
+		s.Encode.Round(time.Millisecond), s.Write.Round(time.Millisecond), s.Latency.Round(time.Millisecond),
+		s.Level)
+}
+
+// videoState holds the schedule and the statistics of Canvas.Video.
+type videoState struct {
+	clock    func() time.Duration
+	hook     func(VideoStats)
+	start    time.Time // due time of frame 0 by the wall clock
+	frameDur time.Duration
+	stats    VideoStats
+	encodes  int
+	encode   time.Duration // sums
+	write    time.Duration
+	latency  time.Duration
+
+	// load of the current second
+	windowStart   time.Time
+	windowFrames  int
+	windowDropped int
+	windowWrite   time.Duration
+}
+
+// Stats returns the statistics of the running or last video played by Video.
+func (c *Canvas) Stats() VideoStats {
+	if c == nil {
+		return VideoStats{}
+	}
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	s := c.video.stats
+	if n := c.video.encodes; n > 0 {
+		s.Encode = c.video.encode / time.Duration(n)
+	}
+	if n := s.Frames; n > 0 {
+		s.Write = c.video.write / time.Duration(n)
+		s.Latency = c.video.latency / time.Duration(n)
+		if d := time.Since(c.video.start); d > 0 {
+			s.FPS = float64(n) / d.Seconds()
+		}
+	}
+	s.Level = int(c.videoLevel.Load())
+	return s
+}
+
+// SetVideoClock sets the clock Video paces the frames with, e.g. the position of the audio.
+// Frame n is due when the clock reaches n frame durations, a stopped clock pauses the video.
+// Without a clock the video starts with its first frame and follows the wall clock.
+func (c *Canvas) SetVideoClock(clock func() time.Duration) {
+	if c == nil {
+		return
+	}
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video.clock = clock
+}
+
+// SetVideoFrameHook sets a function Video calls with the statistics after each drawn frame.
+// It runs between the writes of the frames, e.g. for writing a status line next to the video.
+func (c *Canvas) SetVideoFrameHook(hook func(VideoStats)) {
+	if c == nil {
+		return
+	}
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video.hook = hook
+}
+
+func (c *Canvas) videoFrameHook() func(VideoStats) {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	return c.video.hook
+}
+
+func (c *Canvas) startVideo(frameDur time.Duration) {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video = videoState{clock: c.video.clock, hook: c.video.hook, frameDur: frameDur}
+	c.videoLevel.Store(0)
+}
+
+// due returns the time frame id is due and schedules the video with frame id if it didn't start yet.
+func (c *Canvas) due(id int) time.Time {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	now := time.Now()
+	if c.video.start.IsZero() {
+		c.video.start = now.Add(-time.Duration(id) * c.video.frameDur)
+		c.video.windowStart = now
+	}
+	if c.video.clock != nil {
+		return now.Add(time.Duration(id)*c.video.frameDur - c.video.clock())
+	}
+	return c.video.start.Add(time.Duration(id) * c.video.frameDur)
+}
+
+// late reports whether frame id can't be drawn in time anymore.
+// Frames are dropped when they are more than a frame behind, e.g. when the terminal doesn't
+// keep up with the writes.
+func (c *Canvas) late(id int) bool {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	pos := time.Duration(id) * c.video.frameDur
+	if c.video.clock != nil {
+		return c.video.clock()-pos > c.video.frameDur
+	}
+	if c.video.start.IsZero() {
+		return false
+	}
+	return time.Since(c.video.start.Add(pos)) > c.video.frameDur
+}
+
+func (c *Canvas) frameEncoded(d time.Duration) {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video.encodes++
+	c.video.encode += d
+}
+
+func (c *Canvas) frameDropped() {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video.stats.Dropped++
+	c.video.windowDropped++
+	c.adaptLoad()
+}
+
+func (c *Canvas) frameDrawn(write, latency time.Duration) {
+	c.videoMu.Lock()
+	defer c.videoMu.Unlock()
+	c.video.stats.Frames++
+	c.video.write += write
+	c.video.latency += latency
+	c.video.windowFrames++
+	c.video.windowWrite += write
+	c.adaptLoad()
+}
+
+// adaptLoad raises the load level once per second when frames were dropped or the writes
+// fill most of the frame time, it lowers the level when the terminal keeps up with ease.
+// c.videoMu has to be locked.
+func (c *Canvas) adaptLoad() {
+	v := &c.video
+	if time.Since(v.windowStart) < time.Second {
+		return
+	}
+	level := c.videoLevel.Load()
+	total := v.windowFrames + v.windowDropped
+	var writeLoad float64
+	if v.windowFrames > 0 && v.frameDur > 0 {
+		writeLoad = float64(v.windowWrite/time.Duration(v.windowFrames)) / float64(v.frameDur)
+	}
+	switch {
+	case total > 0 && (float64(v.windowDropped)/float64(total) > 0.1 || writeLoad > 0.8):
+		if level < maxVideoLevel {
+			c.videoLevel.Store(level + 1)
+		}
+	case v.windowDropped == 0 && writeLoad < 0.3:
+		if level > 0 {
+			c.videoLevel.Store(level - 1)
+		}
+	}
+	v.windowStart, v.windowFrames, v.windowDropped, v.windowWrite = time.Now(), 0, 0, 0
+}
+
+// reduce lowers the resolution of a video frame to the current load level before the drawer
+// encodes it. Drawers scaling images to the cells (kitty, iTerm2) write less data,
+// drawers writing pixels (sixel) scale the frame back up to the size of the canvas.
+func (c *Canvas) reduce(img image.Image) image.Image {
+	level := c.videoLevel.Load()
+	if level <= 0 || img == nil {
+		return img
+	}
+	return downscale(img, 1<<level)
+}
+
+// downscale returns img shrunk by the factor f, each pixel takes the color of the
+// upper left pixel of its block of f x f pixels.
+func downscale(img image.Image, f int) image.Image {
+	src := toRGBA(img)
+	b := src.Rect
+	dst := image.NewRGBA(image.Rect(0, 0, (b.Dx()+f-1)/f, (b.Dy()+f-1)/f))
+	for y := range dst.Rect.Dy() {
+		srcRow := src.Pix[src.PixOffset(b.Min.X, b.Min.Y+y*f):]
+		row := dst.Pix[dst.PixOffset(0, y):]
+		for x := range dst.Rect.Dx() {
+			copy(row[4*x:4*x+4], srcRow[4*x*f:])
+		}
+	}
+	return dst
+}
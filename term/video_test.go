@@ -0,0 +1,103 @@
+package term
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownscale(t *testing.T) {
+	src := image.NewRGBA(image.Rect(10, 20, 15, 23)) // odd size with an offset
+	for y := range 3 {
+		for x := range 5 {
+			src.Set(10+x, 20+y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+	dst := downscale(src, 2)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), dst.Bounds())
+	for y := range 2 {
+		for x := range 3 {
+			want := color.RGBA{R: uint8(2 * x), G: uint8(2 * y), A: 255}
+			assert.Equal(t, want, dst.At(x, y), `pixel %d,%d`, x, y)
+		}
+	}
+	// the source is kept
+	assert.Equal(t, color.RGBA{R: 1, G: 1, A: 255}, src.At(11, 21))
+}
+
+func TestVideoDue(t *testing.T) {
+	const frameDur = 10 * time.Millisecond
+	c := &Canvas{}
+	c.startVideo(frameDur)
+	now := time.Now()
+	assert.WithinDuration(t, now, c.due(5), frameDur, `the first frame starts the schedule`)
+	assert.Equal(t, frameDur, c.due(6).Sub(c.due(5)), `frames follow the wall clock`)
+
+	c.SetVideoClock(func() time.Duration { return 30 * time.Millisecond })
+	assert.WithinDuration(t, time.Now().Add(20*time.Millisecond), c.due(5), frameDur/2, `frames follow the clock`)
+	assert.WithinDuration(t, time.Now().Add(-20*time.Millisecond), c.due(1), frameDur/2)
+}
+
+func TestVideoLate(t *testing.T) {
+	const frameDur = 10 * time.Millisecond
+	c := &Canvas{}
+	c.startVideo(frameDur)
+	assert.False(t, c.late(100), `not started`)
+
+	c.video.start = time.Now().Add(-100 * time.Millisecond)
+	assert.True(t, c.late(5))
+	assert.False(t, c.late(10))
+	assert.False(t, c.late(20))
+
+	c.SetVideoClock(func() time.Duration { return 100 * time.Millisecond })
+	assert.True(t, c.late(8), `more than a frame behind the clock`)
+	assert.False(t, c.late(9), `a frame behind`)
+	assert.False(t, c.late(12))
+}
+
+func TestAdaptLoad(t *testing.T) {
+	const frameDur = 10 * time.Millisecond
+	tests := []struct {
+		name    string
+		level   int32
+		frames  int
+		dropped int
+		write   time.Duration // per frame
+		elapsed bool
+		want    int32
+	}{
+		{`dropped frames`, 0, 20, 5, time.Millisecond, true, 1},
+		{`slow writes`, 0, 10, 0, 9 * time.Millisecond, true, 1},
+		{`highest level`, maxVideoLevel, 20, 5, time.Millisecond, true, maxVideoLevel},
+		{`keeping up`, 1, 10, 0, 2 * time.Millisecond, true, 0},
+		{`lowest level`, 0, 10, 0, 2 * time.Millisecond, true, 0},
+		{`moderate load`, 1, 10, 0, 5 * time.Millisecond, true, 1},
+		{`within the second`, 0, 20, 5, time.Millisecond, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Canvas{}
+			c.startVideo(frameDur)
+			c.videoLevel.Store(tt.level)
+			v := &c.video
+			v.windowStart = time.Now()
+			if tt.elapsed {
+				v.windowStart = v.windowStart.Add(-time.Second)
+			}
+			v.windowFrames, v.windowDropped = tt.frames, tt.dropped
+			v.windowWrite = time.Duration(tt.frames) * tt.write
+			c.videoMu.Lock()
+			c.adaptLoad()
+			c.videoMu.Unlock()
+			assert.Equal(t, tt.want, c.videoLevel.Load())
+			if tt.elapsed {
+				assert.Zero(t, v.windowFrames+v.windowDropped, `new window`)
+			} else {
+				assert.Equal(t, tt.frames, v.windowFrames)
+			}
+		})
+	}
+}
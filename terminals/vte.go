@@ -142,9 +142,6 @@ func (s *surveyorVTEInterchanged14t) SizeInPixelsQuery(qu term.Querier, tty term
 	// 0.65: 0.65.91 still with bug
 	// 0.66: 0.66.0 fixed
 	qs := "\033[14t"
-	/*if needsWrap {
-		qs = mux.Wrap(qs)
-	}*/
 	repl, err := qu.Query(qs, tty, parser.StopOnAlpha)
 	if err != nil {
 		return 0, 0, err
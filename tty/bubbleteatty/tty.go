@@ -1,86 +1,93 @@
-//go:build dev
-
+// Package bubbleteatty provides an implementation of term.TTY sharing the tty with a Bubble Tea program.
+//
+// The tty is read by a ttymux.TTYMultiplexer: termimg's queries are answered on the TTY,
+// key presses and the replies to the program's own queries go to the program.
+// The views of the program are passed to the registered FrameHooks, e.g. the images of
+// tui/bubbleteaimg, which learn their position on the screen from the laid out view
+// and draw after the renderer wrote the frame.
 package bubbleteatty
 
 import (
 	"io"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
+	tea "charm.land/bubbletea/v2"
+	uv "github.com/charmbracelet/ultraviolet"
+	xterm "github.com/charmbracelet/x/term"
 
 	"github.com/srlehn/termimg/internal"
 	"github.com/srlehn/termimg/internal/environ"
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/term"
-	"github.com/srlehn/termimg/tty/contdtty"
+	"github.com/srlehn/termimg/tty/ttymux"
 )
 
-const ioDeadLine = 100 * time.Millisecond
+// FrameHook is notified about the messages and frames of the program.
+type FrameHook interface {
+	// Update is called with each message before the model receives it.
+	Update(msg tea.Msg) tea.Cmd
+	// View is called with each view of the model before it is passed to the renderer
+	// and may change it. scr holds the content of the view laid out like by the renderer,
+	// it is nil if the position of the view on the screen is unknown (inline mode).
+	View(v *tea.View, scr *uv.ScreenBuffer)
+	// Flushed is called after the renderer wrote to the tty, before it writes again.
+	Flushed()
+}
 
 type TTYBubbleTea struct {
-	Program          *tea.Program
-	ttyContD         *contdtty.TTYContD
-	file             *os.File
-	wrappedWriter    io.Writer
-	fileName         string
-	reader           *teaReader
-	subReader        io.Reader
-	lipGlossRenderer *lipgloss.Renderer
-	Scanner          Scanner
-	enver            environ.Enver
-	initOnce         sync.Once
-	initFunc         func()
+	Program  *tea.Program
+	mux      *ttymux.TTYMultiplexer
+	file     *os.File
+	fileName string
+	query    *ttymux.MultiplexedTTY // termimg
+	input    *ttymux.MultiplexedTTY // Bubble Tea
+	output   *output
+	enver    environ.Enver
+
+	outMu sync.Mutex // writes of the program
+
+	mu            sync.Mutex
+	hooks         []FrameHook
+	width, height int
 }
 
 var _ term.TTY = (*TTYBubbleTea)(nil)
 
 func New(ttyFile string) (*TTYBubbleTea, error) {
-	return newWithProgram(nil, nil)(ttyFile)
-}
-
-func newWithProgram(model tea.Model, prog **tea.Program, opts ...tea.ProgramOption) func(string) (*TTYBubbleTea, error) {
-	return func(ttyFile string) (*TTYBubbleTea, error) {
-		ttyContD, err := contdtty.New(ttyFile)
-		if err != nil {
-			return nil, err
-		}
-		r := newTeaReader(ttyContD)
-		t := &TTYBubbleTea{
-			ttyContD:  ttyContD,
-			file:      os.NewFile(ttyContD.Fd(), ttyFile),
-			fileName:  ttyFile,
-			reader:    r,
-			subReader: r.NewSubReader(),
-		}
-		if prog != nil {
-			t.initFunc = func() {
-				opts = append(opts, t.BubbleTeaOptions()...)
-				t.Program = tea.NewProgram(model, opts...)
-				if t.Program == nil {
-					return
-				}
-				*prog = t.Program
-			}
-		}
-		return t, nil
+	var file *os.File
+	opener := func(name string) (*os.File, error) {
+		f, err := os.OpenFile(name, os.O_RDWR, 0)
+		file = f
+		return f, err
 	}
-}
-
-func (t *TTYBubbleTea) init() {
-	if t == nil || t.initFunc == nil {
-		return
+	mux, err := ttymux.NewWithOpener(ttyFile, opener)
+	if err != nil {
+		return nil, err
 	}
-	t.initOnce.Do(t.initFunc)
+	t := &TTYBubbleTea{
+		mux:      mux,
+		file:     file,
+		fileName: ttyFile,
+		query:    mux.NewQueryReader(`termimg`),
+		input:    mux.NewReader(`bubbletea`),
+	}
+	if len(t.fileName) == 0 {
+		t.fileName = internal.DefaultTTYDevice()
+	}
+	t.output = &output{tty: t}
+	return t, nil
 }
 
+// BubbleTeaProgram creates the program running model on the tty of the terminal.
+// The program is stored in prog after the terminal is set up.
+// The model returned by (*tea.Program).Run implements interface{ Unwrap() tea.Model }.
 func BubbleTeaProgram(model tea.Model, prog **tea.Program, opts ...tea.ProgramOption) term.Option {
 	enforceBubbleTeaTTY := true
 	return term.Options{
-		term.SetTTYProvider(newWithProgram(model, prog, opts...), enforceBubbleTeaTTY),
+		term.SetTTYProvider(New, enforceBubbleTeaTTY),
 		term.TUIMode,
 		term.OptFunc(func(tm *term.Terminal) error {
 			onClose := func() error {
@@ -88,10 +95,7 @@ func BubbleTeaProgram(model tea.Model, prog **tea.Program, opts ...tea.ProgramOp
 					return nil
 				}
 				t, ok := tm.TTY().(*TTYBubbleTea)
-				if !ok || t == nil {
-					return nil
-				}
-				if t.Program == nil {
+				if !ok || t == nil || t.Program == nil {
 					return nil
 				}
 				go t.Program.Quit()
@@ -105,114 +109,218 @@ func BubbleTeaProgram(model tea.Model, prog **tea.Program, opts ...tea.ProgramOp
 		term.AfterSetup(func(tm *term.Terminal) {
 			t, ok := tm.TTY().(*TTYBubbleTea)
 			if !ok || t == nil {
+				return
 			}
 			t.enver = tm.Env()
+			if model == nil {
+				return
+			}
+			opts = append(opts, t.BubbleTeaOptions()...)
+			t.Program = tea.NewProgram(&frameModel{Model: model, tty: t}, opts...)
+			if prog != nil {
+				*prog = t.Program
+			}
 		}),
 	}
 }
 
-func (t *TTYBubbleTea) TermEnvOptions() []termenv.OutputOption {
-	if t == nil || t.enver == nil {
+// BubbleTeaOptions returns the options for running a program on the tty.
+// Programs not created by BubbleTeaProgram don't notify the FrameHooks.
+func (t *TTYBubbleTea) BubbleTeaOptions() []tea.ProgramOption {
+	if t == nil {
 		return nil
 	}
-	termenvOpts := []termenv.OutputOption{
-		termenv.WithUnsafe(), // termimg requires a tty
-		termenv.WithColorCache(true),
-		termenv.WithEnvironment(t.enver),
-		termenv.WithProfile(termenv.EnvColorProfile()),
+	opts := []tea.ProgramOption{
+		tea.WithInput(t.input),
+		tea.WithOutput(t.output),
+	}
+	if t.enver != nil {
+		opts = append(opts, tea.WithEnvironment(t.enver.Environ()))
 	}
-	return termenvOpts
+	return opts
 }
 
-func (t *TTYBubbleTea) LipGlossRenderer() *lipgloss.Renderer {
-	if t == nil || t.enver == nil {
-		return nil
+// AddFrameHook registers h for the messages and frames of the program.
+func (t *TTYBubbleTea) AddFrameHook(h FrameHook) {
+	if t == nil || h == nil {
+		return
 	}
-	if t.lipGlossRenderer != nil {
-		return t.lipGlossRenderer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !slices.Contains(t.hooks, h) {
+		t.hooks = append(t.hooks, h)
 	}
-	termenvOpts := t.TermEnvOptions()
-	t.lipGlossRenderer = lipgloss.NewRenderer(t.bubblyWriter(), termenvOpts...)
-	return t.lipGlossRenderer
 }
 
-func (t *TTYBubbleTea) BubbleTeaOptions() []tea.ProgramOption {
+// RemoveFrameHook unregisters h.
+func (t *TTYBubbleTea) RemoveFrameHook(h FrameHook) {
 	if t == nil {
-		return nil
+		return
 	}
-	return []tea.ProgramOption{
-		tea.WithInput(t.reader.NewSubReader()),
-		tea.WithOutput(t.bubblyWriter()),
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hooks = slices.DeleteFunc(t.hooks, func(hk FrameHook) bool { return hk == h })
+}
+
+// Send sends msg to the program without blocking.
+func (t *TTYBubbleTea) Send(msg tea.Msg) {
+	if t == nil || t.Program == nil {
+		return
 	}
+	go t.Program.Send(msg)
 }
 
-func (t *TTYBubbleTea) Read(p []byte) (n int, err error) {
-	if err := errors.NilReceiver(t, t.ttyContD, t.file); err != nil {
-		return 0, err
+// LockOutput blocks the writes of the program, e.g. for drawing between its frames.
+// FrameHook.Flushed is called with the output locked.
+func (t *TTYBubbleTea) LockOutput() {
+	if t == nil {
+		return
 	}
-	t.init()
-	if err := t.file.SetReadDeadline(time.Now().Add(ioDeadLine)); err == nil {
-		defer t.file.SetReadDeadline(time.Time{})
+	t.outMu.Lock()
+}
+
+// UnlockOutput unblocks the writes of the program.
+func (t *TTYBubbleTea) UnlockOutput() {
+	if t == nil {
+		return
 	}
-	// Always use ttyContD for consistent behavior - teaReader will multiplex to BubbleTea
-	return t.ttyContD.Read(p)
+	t.outMu.Unlock()
 }
 
-func (t *TTYBubbleTea) Write(b []byte) (n int, err error) {
-	if err := errors.NilReceiver(t, t.ttyContD, t.file); err != nil {
-		return 0, err
+func (t *TTYBubbleTea) frameHooks() []FrameHook {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.hooks)
+}
+
+func (t *TTYBubbleTea) update(msg tea.Msg) []tea.Cmd {
+	if sz, ok := msg.(tea.WindowSizeMsg); ok {
+		t.mu.Lock()
+		t.width, t.height = sz.Width, sz.Height
+		t.mu.Unlock()
 	}
-	t.init()
-	if err := t.file.SetWriteDeadline(time.Now().Add(ioDeadLine)); err == nil {
-		defer t.file.SetWriteDeadline(time.Time{})
+	var cmds []tea.Cmd
+	for _, h := range t.frameHooks() {
+		if cmd := h.Update(msg); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
 	}
-	return t.ttyContD.Write(b)
+	return cmds
 }
 
-func (t *TTYBubbleTea) bubblyWriter() io.Writer {
-	// called from t.init() - don't call t.init() here
-	if t == nil {
-		return nil
+func (t *TTYBubbleTea) view(v *tea.View) {
+	hooks := t.frameHooks()
+	if len(hooks) == 0 {
+		return
+	}
+	t.mu.Lock()
+	w, h := t.width, t.height
+	t.mu.Unlock()
+	var scr *uv.ScreenBuffer
+	if v.AltScreen && w > 0 && h > 0 {
+		// the alt screen frame has the size of the terminal and starts in its top left cell
+		buf := uv.NewScreenBuffer(w, h)
+		uv.NewStyledString(v.Content).Draw(buf, buf.Bounds())
+		scr = &buf
 	}
-	if t.wrappedWriter == nil {
-		t.wrappedWriter = &bubblyWriter{TTYBubbleTea: t}
+	for _, hk := range hooks {
+		hk.View(v, scr)
 	}
-	return t.wrappedWriter
 }
 
-type bubblyWriter struct{ *TTYBubbleTea }
+func (t *TTYBubbleTea) flushed() {
+	for _, h := range t.frameHooks() {
+		h.Flushed()
+	}
+}
+
+// frameModel passes the messages and views of the program's model to the FrameHooks.
+type frameModel struct {
+	tea.Model
+	tty *TTYBubbleTea
+}
+
+func (m *frameModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	cmds := m.tty.update(msg)
+	mdl, cmd := m.Model.Update(msg)
+	m.Model = mdl
+	return m, tea.Batch(append(cmds, cmd)...)
+}
+
+func (m *frameModel) View() tea.View {
+	v := m.Model.View()
+	m.tty.view(&v)
+	return v
+}
+
+// Unwrap returns the model of the program.
+func (m *frameModel) Unwrap() tea.Model { return m.Model }
+
+// output is the output of the program. It implements term.File of charmbracelet/x/term
+// for the program to get the size of the tty.
+type output struct{ tty *TTYBubbleTea }
 
-func (t *bubblyWriter) Write(b []byte) (n int, err error) {
-	if err := errors.NilReceiver(t, t.TTYBubbleTea); err != nil {
+var _ xterm.File = (*output)(nil)
+
+func (o *output) Write(b []byte) (n int, err error) {
+	if err := errors.NilReceiver(o, o.tty, o.tty.input); err != nil {
 		return 0, err
 	}
-	if t.Scanner != nil {
-		b = t.Scanner.Scan(b)
-		defer t.Scanner.PostWrite()
+	o.tty.outMu.Lock()
+	defer o.tty.outMu.Unlock()
+	n, err = o.tty.input.Write(b)
+	o.tty.flushed()
+	return n, err
+}
+
+func (o *output) Read(p []byte) (n int, err error) { return 0, io.EOF }
+
+func (o *output) Close() error { return nil }
+
+func (o *output) Fd() uintptr {
+	if o == nil || o.tty == nil || o.tty.file == nil {
+		return ^uintptr(0)
 	}
-	return t.TTYBubbleTea.Write(b)
+	return o.tty.file.Fd()
 }
 
-type Scanner interface {
-	Scan(b []byte) []byte
-	PostWrite()
+func (t *TTYBubbleTea) Read(p []byte) (n int, err error) {
+	if err := errors.NilReceiver(t, t.query); err != nil {
+		return 0, err
+	}
+	return t.query.Read(p)
 }
 
-func (t *TTYBubbleTea) SetScanner(scanner Scanner) {
-	if t == nil {
-		return
+func (t *TTYBubbleTea) Write(b []byte) (n int, err error) {
+	if err := errors.NilReceiver(t, t.query); err != nil {
+		return 0, err
 	}
-	t.Scanner = scanner
+	return t.query.Write(b)
 }
 
 func (t *TTYBubbleTea) TTYDevName() string {
 	if t == nil {
 		return internal.DefaultTTYDevice()
 	}
-	t.init()
 	return t.fileName
 }
 
+// SizePixel ...
+func (t *TTYBubbleTea) SizePixel() (cw int, ch int, pw int, ph int, e error) {
+	if err := errors.NilReceiver(t, t.query); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return t.query.SizePixel()
+}
+
+// ResizeEvents ...
+func (t *TTYBubbleTea) ResizeEvents() (_ <-chan term.Resolution, closeFunc func() error, _ error) {
+	if err := errors.NilReceiver(t, t.query); err != nil {
+		return nil, nil, err
+	}
+	return t.query.ResizeEvents()
+}
+
 // Close ...
 func (t *TTYBubbleTea) Close() error {
 	if t == nil {
@@ -222,15 +330,10 @@ func (t *TTYBubbleTea) Close() error {
 		t.Program.Quit()
 		t.Program = nil
 	}
-	var errs []error
-	if t.ttyContD != nil {
-		errs = append(errs, t.ttyContD.Close())
-		t.ttyContD = nil
-	}
-	if t.file != nil {
-		errs = append(errs, t.file.Close())
-		t.file = nil
+	if t.mux == nil {
+		return nil
 	}
-	t = nil
-	return errors.Join(errs...)
+	err := t.mux.Close()
+	t.mux = nil
+	return err
 }
@@ -0,0 +1,156 @@
+package ttymux
+
+import (
+	"fmt"
+
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+// Mirror creates a pty pair like CreatePTYSlave for running an unmodified TUI library
+// or program (PTYSlaveWrapper.Start) on the slave.
+//
+// The output written to the slave is passed to the tty, except for size queries
+// (XTWINOPS 14, 16, 18, 19) which are answered from the size of the tty.
+// Other queries like the cursor position are answered by the terminal,
+// their replies are routed back to the slave. Size changes of the tty are set on the slave,
+// which signals SIGWINCH to its foreground process group.
+// termimg keeps writing its images and queries directly to the tty.
+func (m *TTYMultiplexer) Mirror() (*PTYSlaveWrapper, error) {
+	return m.createPTY(true)
+}
+
+func (p *PTYSlaveWrapper) mirrorOutput() {
+	f := &outputFilter{answer: p.answerQuery}
+	buf := make([]byte, 4096)
+	var out []byte
+	for {
+		n, err := p.master.Read(buf)
+		if n > 0 {
+			out = f.filter(out[:0], buf[:n])
+			if len(out) > 0 {
+				if _, err := p.queries.Write(out); err != nil {
+					return
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// answerQuery writes the reply to a size query to the slave.
+func (p *PTYSlaveWrapper) answerQuery(seq parser.Sequence) bool {
+	if !parser.IsQuery(seq) || !seq.Is(parser.SeqCSI, 0, ``, 't') {
+		return false
+	}
+	cw, ch, pw, ph, err := p.mux.sizePixel()
+	if err != nil || cw < 1 || ch < 1 {
+		return false
+	}
+	var repl string
+	switch seq.IntParams(0)[0] {
+	case 18:
+		repl = fmt.Sprintf("\033[8;%d;%dt", ch, cw)
+	case 19:
+		repl = fmt.Sprintf("\033[9;%d;%dt", ch, cw)
+	case 14:
+		if pw < 1 || ph < 1 {
+			return false
+		}
+		repl = fmt.Sprintf("\033[4;%d;%dt", ph, pw)
+	case 16:
+		if pw < 1 || ph < 1 {
+			return false
+		}
+		repl = fmt.Sprintf("\033[6;%d;%dt", ph/ch, pw/cw)
+	default:
+		return false
+	}
+	_, err = p.writeMaster([]byte(repl))
+	return err == nil
+}
+
+type filterState uint8
+
+const (
+	filterGround filterState = iota
+	filterEsc
+	filterCSI
+	filterString
+	filterStringEsc
+)
+
+// maxCSILen limits the held back bytes of a CSI sequence.
+const maxCSILen = 64
+
+// outputFilter passes output unchanged except for the CSI sequences taken by answer.
+// Strings (DCS, OSC, APC, ...) are passed through without interpretation,
+// ESCs in them only end them as part of ST, like in the tmux passthrough framing.
+type outputFilter struct {
+	state  filterState
+	held   []byte // ESC or incomplete CSI sequence
+	answer func(parser.Sequence) bool
+}
+
+// filter appends the output for b to dst.
+func (f *outputFilter) filter(dst, b []byte) []byte {
+	for _, c := range b {
+		switch f.state {
+		case filterGround:
+			if c == '\033' {
+				f.held = append(f.held[:0], c)
+				f.state = filterEsc
+				continue
+			}
+			dst = append(dst, c)
+		case filterEsc:
+			switch c {
+			case '[':
+				f.held = append(f.held, c)
+				f.state = filterCSI
+			case 'P', ']', '_', '^', 'X':
+				dst = append(append(dst, f.held...), c)
+				f.held = f.held[:0]
+				f.state = filterString
+			case '\033':
+				dst = append(dst, f.held...)
+			default:
+				dst = append(append(dst, f.held...), c)
+				f.held = f.held[:0]
+				f.state = filterGround
+			}
+		case filterCSI:
+			f.held = append(f.held, c)
+			switch {
+			case c >= 0x40 && c <= 0x7E:
+				seqs := parser.Tokenize(string(f.held))
+				if len(seqs) != 1 || f.answer == nil || !f.answer(seqs[0]) {
+					dst = append(dst, f.held...)
+				}
+				f.held = f.held[:0]
+				f.state = filterGround
+			case len(f.held) >= maxCSILen:
+				dst = append(dst, f.held...)
+				f.held = f.held[:0]
+				f.state = filterGround
+			}
+		case filterString:
+			dst = append(dst, c)
+			switch c {
+			case '\033':
+				f.state = filterStringEsc
+			case '\a':
+				f.state = filterGround
+			}
+		case filterStringEsc:
+			dst = append(dst, c)
+			if c == '\\' {
+				f.state = filterGround
+			} else {
+				f.state = filterString
+			}
+		}
+	}
+	return dst
+}
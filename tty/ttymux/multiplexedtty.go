@@ -0,0 +1,175 @@
+package ttymux
+
+import (
+	"time"
+
+	"github.com/srlehn/termimg/internal"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/parser"
+	"github.com/srlehn/termimg/term"
+)
+
+// MultiplexedTTY is a reader of a TTYMultiplexer.
+// It reads the input distributed to it and writes to the tty.
+type MultiplexedTTY struct {
+	*BufferedReader
+	mux *TTYMultiplexer
+	id  string
+
+	// guarded by mux.mu
+	queries       bool
+	wtok          parser.Tokenizer // queries written
+	wpartial      []byte
+	replyDeadline time.Time
+	queriedAt     time.Time // first query without reply
+	pending       int       // queries without reply
+	pendingDA1    int
+	resize        chan term.Resolution
+	resizeClosed  bool
+}
+
+var _ term.TTY = (*MultiplexedTTY)(nil)
+
+// ID returns the id of the reader.
+func (t *MultiplexedTTY) ID() string {
+	if t == nil {
+		return ``
+	}
+	return t.id
+}
+
+// Write writes to the tty.
+func (t *MultiplexedTTY) Write(p []byte) (n int, err error) {
+	if err := errors.NilReceiver(t, t.mux); err != nil {
+		return 0, err
+	}
+	if t.queries {
+		t.mux.mu.Lock()
+		t.wpartial = feedUTF8(&t.wtok, t.wpartial, p, t.queryWritten, nil)
+		t.mux.mu.Unlock()
+	}
+	return t.mux.write(p)
+}
+
+func (t *MultiplexedTTY) queryWritten(seq parser.Sequence) {
+	if !parser.IsQuery(seq) {
+		return
+	}
+	now := time.Now()
+	if !t.awaitsReply(now) {
+		t.queriedAt, t.pending, t.pendingDA1 = now, 0, 0
+	}
+	t.replyDeadline = now.Add(replyTimeout)
+	t.pending++
+	if seq.Is(parser.SeqCSI, 0, ``, 'c') {
+		t.pendingDA1++
+	}
+}
+
+func (t *MultiplexedTTY) awaitsReply(now time.Time) bool {
+	return t.queries && now.Before(t.replyDeadline)
+}
+
+func (t *MultiplexedTTY) replyReceived(seq parser.Sequence) {
+	t.pending--
+	if parser.IsDA1Reply(seq) && t.pendingDA1 > 0 {
+		t.pendingDA1--
+		if t.pendingDA1 == 0 {
+			// DA1 is answered last by all terminals and used as the sentinel of queries,
+			// queries before it are unsupported
+			t.pending = 0
+		}
+	}
+	if t.pending <= 0 {
+		// the replies of queries written later by other readers follow
+		t.replyDeadline, t.pending = time.Time{}, 0
+	}
+}
+
+func (t *MultiplexedTTY) TTYDevName() string {
+	if t == nil || t.mux == nil {
+		return internal.DefaultTTYDevice()
+	}
+	return t.mux.fileName
+}
+
+// SizePixel ...
+func (t *MultiplexedTTY) SizePixel() (cw int, ch int, pw int, ph int, e error) {
+	if err := errors.NilReceiver(t, t.mux); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return t.mux.sizePixel()
+}
+
+// ResizeEvents ...
+func (t *MultiplexedTTY) ResizeEvents() (_ <-chan term.Resolution, closeFunc func() error, _ error) {
+	if err := errors.NilReceiver(t, t.mux); err != nil {
+		return nil, nil, err
+	}
+	if err := t.mux.watchResize(); err != nil {
+		return nil, nil, err
+	}
+	t.mux.mu.Lock()
+	defer t.mux.mu.Unlock()
+	if t.mux.closed {
+		return nil, nil, errors.New(`multiplexer closed`)
+	}
+	if t.resize == nil {
+		t.resize = make(chan term.Resolution, 1)
+	}
+	closeFunc = func() error {
+		t.mux.mu.Lock()
+		defer t.mux.mu.Unlock()
+		t.closeResizeEvents()
+		return nil
+	}
+	return t.resize, closeFunc, nil
+}
+
+// closeResizeEvents is called with mux.mu held or after the reader was removed.
+func (t *MultiplexedTTY) closeResizeEvents() {
+	if t.resize == nil || t.resizeClosed {
+		return
+	}
+	close(t.resize)
+	t.resizeClosed = true
+}
+
+// sendResize replaces an unreceived event, so that the last one is kept.
+// It is called with mux.mu held.
+func (t *MultiplexedTTY) sendResize(res term.Resolution) {
+	if t.resize == nil || t.resizeClosed {
+		return
+	}
+	select {
+	case <-t.resize:
+	default:
+	}
+	t.resize <- res
+}
+
+// Close removes the reader from the multiplexer. The tty stays open.
+func (t *MultiplexedTTY) Close() error {
+	if t == nil || t.mux == nil {
+		return nil
+	}
+	t.mux.removeReader(t)
+	t.mux.mu.Lock()
+	t.closeResizeEvents()
+	t.mux.mu.Unlock()
+	return t.BufferedReader.Close()
+}
+
+func resolution(cw, ch, pw, ph int) term.Resolution {
+	res := term.Resolution{
+		TermInCellsW: uint(max(cw, 0)),
+		TermInCellsH: uint(max(ch, 0)),
+		TermInPxlsW:  uint(max(pw, 0)),
+		TermInPxlsH:  uint(max(ph, 0)),
+	}
+	if cw > 0 && ch > 0 && pw > 0 && ph > 0 {
+		res.CellInPxlsW = float64(pw) / float64(cw)
+		res.CellInPxlsH = float64(ph) / float64(ch)
+	}
+	return res
+}
@@ -0,0 +1,110 @@
+package ttymux
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/srlehn/termimg/internal/errors"
+)
+
+// PTYSlaveWrapper is the slave of a pty pair for TUI libraries that need a tty file,
+// e.g. for setting the terminal mode.
+// The input of an input reader is written to the master, the output written to the slave
+// is copied to the tty. The size of the slave follows the size of the tty.
+type PTYSlaveWrapper struct {
+	*os.File // slave
+	master   *os.File
+	reader   *MultiplexedTTY
+	queries  *MultiplexedTTY // mirror mode
+	mux      *TTYMultiplexer
+	wmu      sync.Mutex // writes to the master
+
+	closeOnce sync.Once
+	errClose  error
+}
+
+// CreatePTYSlave creates a pty pair fed by a new input reader.
+func (m *TTYMultiplexer) CreatePTYSlave() (*PTYSlaveWrapper, error) {
+	return m.createPTY(false)
+}
+
+func (m *TTYMultiplexer) createPTY(mirror bool) (*PTYSlaveWrapper, error) {
+	if m == nil {
+		return nil, errors.NilReceiver()
+	}
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	p := &PTYSlaveWrapper{File: slave, master: master, mux: m}
+	if cw, ch, pw, ph, err := m.sizePixel(); err == nil {
+		_ = setPTYSize(slave, resolution(cw, ch, pw, ph))
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.Join(errors.New(`multiplexer closed`), master.Close(), slave.Close())
+	}
+	m.ptys = append(m.ptys, p)
+	m.mu.Unlock()
+	p.reader = m.NewReader(`pty`)
+
+	go func() { _, _ = io.Copy(writerFunc(p.writeMaster), p.reader) }()
+	if mirror {
+		p.queries = m.NewQueryReader(`mirror`)
+		go func() { _, _ = io.Copy(writerFunc(p.writeMaster), p.queries) }()
+		go p.mirrorOutput()
+	} else {
+		go func() { _, _ = io.Copy(p.reader, master) }()
+	}
+	if resizes, _, err := p.reader.ResizeEvents(); err == nil {
+		go func() {
+			for res := range resizes {
+				_ = setPTYSize(slave, res)
+			}
+		}()
+	}
+	return p, nil
+}
+
+// Reader returns the input reader feeding the slave.
+func (p *PTYSlaveWrapper) Reader() *MultiplexedTTY {
+	if p == nil {
+		return nil
+	}
+	return p.reader
+}
+
+// Close closes the pty pair and its reader.
+func (p *PTYSlaveWrapper) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.closeOnce.Do(func() {
+		p.mux.mu.Lock()
+		for i, q := range p.mux.ptys {
+			if q == p {
+				p.mux.ptys = append(p.mux.ptys[:i], p.mux.ptys[i+1:]...)
+				break
+			}
+		}
+		p.mux.mu.Unlock()
+		var errQueries error
+		if p.queries != nil {
+			errQueries = p.queries.Close()
+		}
+		p.errClose = errors.Join(p.reader.Close(), errQueries, p.master.Close(), p.File.Close())
+	})
+	return p.errClose
+}
+
+func (p *PTYSlaveWrapper) writeMaster(b []byte) (int, error) {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	return p.master.Write(b)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
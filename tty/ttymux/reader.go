@@ -0,0 +1,93 @@
+package ttymux
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// BufferedReader is an unbounded buffer of the input distributed to a reader.
+// Input is never dropped while the reader is open.
+type BufferedReader struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  []byte
+	err  error // returned once the buffer is drained
+}
+
+var _ io.ReadCloser = (*BufferedReader)(nil)
+
+func newBufferedReader() *BufferedReader {
+	b := &BufferedReader{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Read blocks until input is available or the reader is closed.
+func (b *BufferedReader) Read(p []byte) (n int, err error) {
+	if b == nil {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.buf) == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if len(b.buf) == 0 {
+		return 0, b.err
+	}
+	n = copy(p, b.buf)
+	b.buf = b.buf[n:]
+	if len(b.buf) == 0 {
+		b.buf = nil
+	}
+	return n, nil
+}
+
+// Available returns the number of buffered bytes.
+func (b *BufferedReader) Available() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.buf)
+}
+
+// Close discards the buffered input and unblocks pending reads.
+func (b *BufferedReader) Close() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = nil
+	if b.err == nil || b.err == io.EOF {
+		b.err = os.ErrClosed
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+func (b *BufferedReader) write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return
+	}
+	b.buf = append(b.buf, p...)
+	b.cond.Broadcast()
+}
+
+// fail lets reads return err after the buffered input.
+func (b *BufferedReader) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
@@ -0,0 +1,325 @@
+// Package ttymux provides an implementation of term.TTY for sharing a tty
+// between termimg and TUI libraries.
+//
+// A TTYMultiplexer is the only reader of the tty. Its input is distributed
+// to the readers created from it:
+//   - query readers (NewQueryReader) receive the replies to the queries written through them,
+//   - input readers (NewReader, NewReaderWithID) receive everything else,
+//     e.g. key presses, mouse events and replies to their own queries.
+//
+// Writes of all readers go to the tty.
+package ttymux
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/srlehn/termimg/internal"
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/parser"
+)
+
+// replyTimeout is how long a query reader receives replies after writing a query.
+const replyTimeout = 2 * time.Second
+
+// escDelay is how long an ESC at the end of the input waits for the rest of a sequence
+// before it is passed on as Escape key. Replies might be split by the tty after the ESC.
+const escDelay = 50 * time.Millisecond
+
+// TTYMultiplexer reads a tty in a single goroutine and distributes the input to its readers.
+type TTYMultiplexer struct {
+	file     *os.File
+	fileName string
+	restore  func() error
+
+	wmu sync.Mutex // writes to the tty
+
+	mu       sync.Mutex
+	tok      parser.Tokenizer
+	partial  []byte // incomplete UTF-8 encoded rune
+	readers  []*MultiplexedTTY
+	unrouted []byte // input received while there was no input reader
+	ids      map[string]int
+	ptys     []*PTYSlaveWrapper
+	closed   bool
+	escTimer *time.Timer
+	escGen   uint64
+
+	resizeOnce sync.Once
+	done       chan struct{}
+}
+
+// New opens the tty at ttyPath, the default tty if empty, and starts reading it.
+// The tty is set to raw mode until the multiplexer is closed.
+func New(ttyPath string) (*TTYMultiplexer, error) {
+	return NewWithOpener(ttyPath, nil)
+}
+
+// NewWithOpener is like New but opens the tty with opener.
+// Files that aren't terminals, e.g. pipes, are read as they are.
+func NewWithOpener(ttyPath string, opener func(string) (*os.File, error)) (*TTYMultiplexer, error) {
+	if len(ttyPath) == 0 {
+		ttyPath = internal.DefaultTTYDevice()
+	}
+	if opener == nil {
+		opener = func(name string) (*os.File, error) { return os.OpenFile(name, os.O_RDWR, 0) }
+	}
+	f, err := opener(ttyPath)
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	if f == nil {
+		return nil, errors.New(`nil tty file`)
+	}
+	m := &TTYMultiplexer{
+		file:     f,
+		fileName: ttyPath,
+		ids:      make(map[string]int),
+		done:     make(chan struct{}),
+	}
+	if fd := int(f.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			_ = f.Close()
+			return nil, errors.New(err)
+		}
+		m.restore = func() error { return term.Restore(fd, state) }
+	}
+	go m.readLoop()
+	return m, nil
+}
+
+// NewReader creates an input reader with an id starting with prefix.
+// The first input reader receives the input buffered while there was none.
+func (m *TTYMultiplexer) NewReader(prefix string) *MultiplexedTTY {
+	return m.newReader(prefix, false)
+}
+
+// NewQueryReader creates a query reader with an id starting with prefix, e.g. for termimg's querier.
+// Replies received after a query was written through the reader are routed to it
+// until the reply to a final DA1 query arrives or the reply timeout elapses.
+func (m *TTYMultiplexer) NewQueryReader(prefix string) *MultiplexedTTY {
+	return m.newReader(prefix, true)
+}
+
+// NewReaderWithID returns the reader with the id or creates an input reader with it.
+func (m *TTYMultiplexer) NewReaderWithID(id string) *MultiplexedTTY {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.readers {
+		if r.id == id {
+			return r
+		}
+	}
+	return m.addReader(id, false)
+}
+
+func (m *TTYMultiplexer) newReader(prefix string, queries bool) *MultiplexedTTY {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := fmt.Sprintf(`%s-%d`, prefix, m.ids[prefix])
+	m.ids[prefix]++
+	return m.addReader(id, queries)
+}
+
+func (m *TTYMultiplexer) addReader(id string, queries bool) *MultiplexedTTY {
+	r := &MultiplexedTTY{
+		BufferedReader: newBufferedReader(),
+		mux:            m,
+		id:             id,
+		queries:        queries,
+	}
+	if m.closed {
+		r.BufferedReader.fail(io.EOF)
+		return r
+	}
+	if !queries && len(m.unrouted) > 0 {
+		r.BufferedReader.write(m.unrouted)
+		m.unrouted = nil
+	}
+	m.readers = append(m.readers, r)
+	return r
+}
+
+func (m *TTYMultiplexer) removeReader(r *MultiplexedTTY) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, rd := range m.readers {
+		if rd == r {
+			m.readers = append(m.readers[:i], m.readers[i+1:]...)
+			break
+		}
+	}
+}
+
+// Close stops reading, closes the readers and the created pty slaves,
+// restores the tty mode and closes the tty.
+func (m *TTYMultiplexer) Close() error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.done)
+	if m.escTimer != nil {
+		m.escTimer.Stop()
+	}
+	readers, ptys := m.readers, m.ptys
+	m.readers, m.ptys = nil, nil
+	for _, r := range readers {
+		r.closeResizeEvents()
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, r := range readers {
+		r.BufferedReader.fail(io.EOF)
+	}
+	for _, p := range ptys {
+		errs = append(errs, p.Close())
+	}
+	if m.restore != nil {
+		errs = append(errs, m.restore())
+	}
+	errs = append(errs, m.file.Close())
+	return errors.Join(errs...)
+}
+
+func (m *TTYMultiplexer) write(p []byte) (int, error) {
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	return m.file.Write(p)
+}
+
+func (m *TTYMultiplexer) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := m.file.Read(buf)
+		if n > 0 {
+			m.dispatch(buf[:n])
+		}
+		if err != nil {
+			m.mu.Lock()
+			for _, r := range m.readers {
+				r.BufferedReader.fail(err)
+			}
+			m.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (m *TTYMultiplexer) dispatch(b []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// input outside of sequences is passed on unchanged, even if it isn't valid UTF-8
+	m.escGen++
+	m.partial = feedUTF8(&m.tok, m.partial, b, m.route, m.routeInput)
+	if m.tok.Pending() == "\033" {
+		// an Escape key press isn't followed by further input
+		gen := m.escGen
+		if m.escTimer != nil {
+			m.escTimer.Stop()
+		}
+		m.escTimer = time.AfterFunc(escDelay, func() { m.flushEscape(gen) })
+	}
+}
+
+func (m *TTYMultiplexer) flushEscape(gen uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed || gen != m.escGen || m.tok.Pending() != "\033" {
+		return
+	}
+	m.tok.Reset()
+	m.routeInput([]byte{'\033'})
+}
+
+// route passes replies to the query reader waiting the longest for them,
+// everything else to the input readers. Terminals reply in the order of the queries.
+func (m *TTYMultiplexer) route(seq parser.Sequence) {
+	if parser.IsQueryReply(seq) {
+		now := time.Now()
+		var oldest *MultiplexedTTY
+		for _, r := range m.readers {
+			if r.awaitsReply(now) && (oldest == nil || r.queriedAt.Before(oldest.queriedAt)) {
+				oldest = r
+			}
+		}
+		if oldest != nil {
+			oldest.BufferedReader.write([]byte(seq.Raw))
+			oldest.replyReceived(seq)
+			return
+		}
+	}
+	m.routeInput([]byte(seq.Raw))
+}
+
+func (m *TTYMultiplexer) routeInput(b []byte) {
+	var routed bool
+	for _, r := range m.readers {
+		if !r.queries {
+			r.BufferedReader.write(b)
+			routed = true
+		}
+	}
+	if !routed {
+		m.unrouted = append(m.unrouted, b...)
+	}
+}
+
+// feedUTF8 feeds b prefixed by the incomplete rune partial to tok and returns the new incomplete rune.
+// Invalid bytes outside of sequences are passed to invalid.
+func feedUTF8(tok *parser.Tokenizer, partial, b []byte, emit func(parser.Sequence), invalid func([]byte)) []byte {
+	if len(partial) > 0 {
+		b = append(partial, b...)
+	}
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size <= 1 {
+			if !utf8.FullRune(b) {
+				return bytes.Clone(b)
+			}
+			if len(tok.Pending()) == 0 && invalid != nil {
+				invalid(b[:1])
+				b = b[1:]
+				continue
+			}
+		}
+		b = b[size:]
+		for _, seq := range tok.Feed(r) {
+			emit(seq)
+		}
+	}
+	return nil
+}
+
+func (m *TTYMultiplexer) notifyResize() {
+	cw, ch, pw, ph, err := m.sizePixel()
+	if err != nil {
+		return
+	}
+	res := resolution(cw, ch, pw, ph)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.readers {
+		r.sendResize(res)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !unix
+
+package ttymux
+
+import (
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+
+	"github.com/srlehn/termimg/internal/errors"
+	termimg "github.com/srlehn/termimg/term"
+)
+
+// sizePixel implements the non-Unix fallback version with the size in cells only
+func (m *TTYMultiplexer) sizePixel() (cw int, ch int, pw int, ph int, e error) {
+	cw, ch, err := term.GetSize(int(m.file.Fd()))
+	if err != nil {
+		return 0, 0, 0, 0, errors.New(err)
+	}
+	return cw, ch, 0, 0, nil
+}
+
+func (m *TTYMultiplexer) watchResize() error {
+	return errors.New(`resize events not supported on this platform`)
+}
+
+func openPTY() (master, slave *os.File, _ error) {
+	return nil, nil, errors.New(`pty not supported on this platform`)
+}
+
+func setPTYSize(f *os.File, res termimg.Resolution) error { return errors.NotImplemented() }
+
+func (p *PTYSlaveWrapper) Start(cmd *exec.Cmd) error {
+	return errors.New(`pty not supported on this platform`)
+}
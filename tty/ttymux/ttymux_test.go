@@ -0,0 +1,206 @@
+//go:build unix
+
+package ttymux_test
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/creack/pty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/term"
+
+	"github.com/srlehn/termimg/tty/ttymux"
+)
+
+// escDelayTest is the delay of ttymux for an ESC at the end of the input.
+const escDelayTest = 50 * time.Millisecond
+
+// newTestMultiplexer returns a multiplexer on a pty slave, the master acts as terminal.
+func newTestMultiplexer(t *testing.T) (*ttymux.TTYMultiplexer, *os.File) {
+	t.Helper()
+	master, slave, err := pty.Open()
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { master.Close() })
+	m, err := ttymux.NewWithOpener(slave.Name(), func(string) (*os.File, error) { return slave, nil })
+	require.NoError(t, err)
+	t.Cleanup(func() { m.Close() })
+	return m, master
+}
+
+// readString reads n bytes or fails after a timeout.
+func readString(t *testing.T, r io.Reader, n int) string {
+	t.Helper()
+	type result struct {
+		b   []byte
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		c <- result{b: b, err: err}
+	}()
+	select {
+	case res := <-c:
+		require.NoError(t, res.err)
+		return string(res.b)
+	case <-time.After(2 * time.Second):
+		t.Fatal(`read timed out`)
+	}
+	return ``
+}
+
+func TestRouting(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	qu := m.NewQueryReader(`termimg`)
+	ui := m.NewReader(`tui`)
+	assert.Equal(t, `termimg-0`, qu.ID())
+	assert.Equal(t, `tui-0`, ui.ID())
+	assert.Same(t, ui, m.NewReaderWithID(`tui-0`))
+
+	query := "\033[>q\033[c"
+	_, err := qu.Write([]byte(query))
+	require.NoError(t, err)
+	assert.Equal(t, query, readString(t, master, len(query)))
+
+	// key presses typed while the terminal answers
+	xtversion, da1 := "\033P>|XTerm(390)\033\\", "\033[?62;4c"
+	_, err = master.Write([]byte("a" + xtversion + "\033[A" + da1 + "ä"))
+	require.NoError(t, err)
+	assert.Equal(t, xtversion+da1, readString(t, qu, len(xtversion+da1)))
+	assert.Equal(t, "a\033[Aä", readString(t, ui, len("a\033[Aä")))
+
+	// DA1 ended the query, later replies go to the input readers
+	_, err = master.Write([]byte("\033[?62c"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[?62c", readString(t, ui, len("\033[?62c")))
+	assert.Zero(t, qu.Available())
+
+	// Escape key
+	_, err = master.Write([]byte("\033"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033", readString(t, ui, 1))
+
+	require.NoError(t, ui.Close())
+	_, err = ui.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestReplySplitAfterEscape(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	qu := m.NewQueryReader(`termimg`)
+	ui := m.NewReader(`tui`)
+	_, err := qu.Write([]byte("\033[c"))
+	require.NoError(t, err)
+	_ = readString(t, master, len("\033[c"))
+
+	_, err = master.Write([]byte("\033"))
+	require.NoError(t, err)
+	time.Sleep(escDelayTest / 2)
+	_, err = master.Write([]byte("[?62;4c"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[?62;4c", readString(t, qu, len("\033[?62;4c")))
+	assert.Zero(t, ui.Available())
+}
+
+func TestReplyToOldestQuery(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	qu1 := m.NewQueryReader(`termimg`)
+	qu2 := m.NewQueryReader(`app`)
+	for _, qu := range []*ttymux.MultiplexedTTY{qu1, qu2} {
+		_, err := qu.Write([]byte("\033[>q\033[c"))
+		require.NoError(t, err)
+		_ = readString(t, master, len("\033[>q\033[c"))
+	}
+	repl1 := "\033P>|XTerm(390)\033\\\033[?62;4c"
+	repl2 := "\033P>|XTerm(391)\033\\\033[?62;4c"
+	_, err := master.Write([]byte(repl1 + repl2))
+	require.NoError(t, err)
+	assert.Equal(t, repl1, readString(t, qu1, len(repl1)))
+	assert.Equal(t, repl2, readString(t, qu2, len(repl2)))
+	assert.Zero(t, qu1.Available())
+}
+
+func TestInputBufferedWithoutReader(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	_, err := master.Write([]byte("keys"))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "keys", readString(t, m.NewReader(`tui`), len("keys")))
+}
+
+func TestSize(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	tty := m.NewReader(`tui`)
+	require.NoError(t, pty.Setsize(master, &pty.Winsize{Cols: 80, Rows: 24, X: 800, Y: 480}))
+	cw, ch, pw, ph, err := tty.SizePixel()
+	require.NoError(t, err)
+	assert.Equal(t, []int{80, 24, 800, 480}, []int{cw, ch, pw, ph})
+
+	resizes, closeFunc, err := tty.ResizeEvents()
+	require.NoError(t, err)
+	defer closeFunc()
+	require.NoError(t, pty.Setsize(master, &pty.Winsize{Cols: 100, Rows: 30, X: 1000, Y: 600}))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGWINCH))
+	select {
+	case res := <-resizes:
+		assert.Equal(t, uint(100), res.TermInCellsW)
+		assert.Equal(t, uint(30), res.TermInCellsH)
+		assert.Equal(t, 10., res.CellInPxlsW)
+	case <-time.After(2 * time.Second):
+		t.Fatal(`no resize event`)
+	}
+}
+
+func TestPTYSlave(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	require.NoError(t, pty.Setsize(master, &pty.Winsize{Cols: 80, Rows: 24}))
+	slave, err := m.CreatePTYSlave()
+	require.NoError(t, err)
+	defer slave.Close()
+	rows, cols, err := pty.Getsize(slave.File)
+	require.NoError(t, err)
+	assert.Equal(t, []int{24, 80}, []int{rows, cols})
+
+	// output of the TUI library
+	_, err = slave.Write([]byte("out"))
+	require.NoError(t, err)
+	assert.Equal(t, "out", readString(t, master, len("out")))
+}
+
+func TestMirror(t *testing.T) {
+	m, master := newTestMultiplexer(t)
+	require.NoError(t, pty.Setsize(master, &pty.Winsize{Cols: 80, Rows: 24, X: 800, Y: 480}))
+	mirror, err := m.Mirror()
+	require.NoError(t, err)
+	defer mirror.Close()
+	state, err := term.MakeRaw(int(mirror.Fd()))
+	require.NoError(t, err)
+	defer term.Restore(int(mirror.Fd()), state)
+
+	// size queries are answered by the mirror
+	_, err = mirror.Write([]byte("text\033[18t\033[16t"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[8;24;80t\033[6;20;10t", readString(t, mirror, len("\033[8;24;80t\033[6;20;10t")))
+	assert.Equal(t, "text", readString(t, master, len("text")))
+
+	// the cursor position is answered by the terminal
+	_, err = mirror.Write([]byte("\033[6n\033]0;title\a"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[6n\033]0;title\a", readString(t, master, len("\033[6n\033]0;title\a")))
+	_, err = master.Write([]byte("\033[3;7R"))
+	require.NoError(t, err)
+	assert.Equal(t, "\033[3;7R", readString(t, mirror, len("\033[3;7R")))
+
+	// key presses
+	_, err = master.Write([]byte("q"))
+	require.NoError(t, err)
+	assert.Equal(t, "q", readString(t, mirror, 1))
+}
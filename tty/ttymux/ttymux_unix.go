@@ -0,0 +1,96 @@
+//go:build unix
+
+package ttymux
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty/v2"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/term"
+)
+
+func (m *TTYMultiplexer) sizePixel() (cw int, ch int, pw int, ph int, e error) {
+	sz, err := pty.GetsizeFull(m.file)
+	if err != nil {
+		return 0, 0, 0, 0, errors.New(err)
+	}
+	return int(sz.Cols), int(sz.Rows), int(sz.X), int(sz.Y), nil
+}
+
+// watchResize distributes the tty size to the readers on SIGWINCH.
+func (m *TTYMultiplexer) watchResize() error {
+	m.resizeOnce.Do(func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGWINCH)
+		go func() {
+			defer signal.Stop(sig)
+			for {
+				select {
+				case <-m.done:
+					return
+				case <-sig:
+					m.notifyResize()
+				}
+			}
+		}()
+	})
+	return nil
+}
+
+func openPTY() (master, slave *os.File, _ error) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return nil, nil, errors.New(err)
+	}
+	return master, slave, nil
+}
+
+func setPTYSize(f *os.File, res term.Resolution) error {
+	return pty.Setsize(f, &pty.Winsize{
+		Cols: uint16(res.TermInCellsW),
+		Rows: uint16(res.TermInCellsH),
+		X:    uint16(res.TermInPxlsW),
+		Y:    uint16(res.TermInPxlsH),
+	})
+}
+
+// Start starts cmd with the slave as controlling terminal.
+// Unset standard streams of cmd are connected to the slave.
+func (p *PTYSlaveWrapper) Start(cmd *exec.Cmd) error {
+	if err := errors.NilReceiver(p, p.File); err != nil {
+		return err
+	}
+	if cmd == nil {
+		return errors.NilParam()
+	}
+	if cmd.Stdin == nil {
+		cmd.Stdin = p.File
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = p.File
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = p.File
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	// Ctty is a descriptor of the child
+	if cmd.Stdin == p.File {
+		cmd.SysProcAttr.Ctty = 0
+	} else {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, p.File)
+		cmd.SysProcAttr.Ctty = 2 + len(cmd.ExtraFiles)
+	}
+	if err := cmd.Start(); err != nil {
+		return errors.New(err)
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ package uvtty
 import (
 	"bytes"
 	"context"
-	"io"
 	"log"
 	"os"
 	"sync"
@@ -26,7 +25,6 @@ type TTYUV struct {
 	watchWINCHOnce sync.Once
 	eventCtx       context.Context
 	eventCancel    context.CancelFunc
-	eventCh        chan uv.Event
 	inputBuf       *bytes.Buffer
 	rawDataCh      chan []byte // Channel for raw input data before parsing
 
@@ -45,14 +43,14 @@ func (t *TTYUV) UVTerminal() *uv.Terminal {
 	return t.uvTerminal
 }
 
-// rawCapturingReader wraps io.Reader to capture raw data before UV parsing
+// rawCapturingReader wraps the input file to capture raw data before UV parsing
 type rawCapturingReader struct {
-	reader    io.Reader
+	*os.File
 	rawDataCh chan []byte
 }
 
 func (r *rawCapturingReader) Read(p []byte) (n int, err error) {
-	n, err = r.reader.Read(p)
+	n, err = r.File.Read(p)
 	if n > 0 {
 		// Create a copy of the data to avoid race conditions
 		data := make([]byte, n)
@@ -78,7 +76,6 @@ func New(ttyFile string) (*TTYUV, error) {
 		fileName:    ttyFile,
 		eventCtx:    ctx,
 		eventCancel: cancel,
-		eventCh:     make(chan uv.Event, 100),
 		rawDataCh:   make(chan []byte, 100),
 		inputBuf:    bytes.NewBuffer(nil),
 	}
@@ -86,10 +83,10 @@ func New(ttyFile string) (*TTYUV, error) {
 	if ttyFile == "" {
 		// Create raw capturing reader for stdin
 		rawReader := &rawCapturingReader{
-			reader:    os.Stdin,
+			File:      os.Stdin,
 			rawDataCh: tty.rawDataCh,
 		}
-		uvTerm = uv.NewTerminal(rawReader, os.Stdout, os.Environ())
+		uvTerm = uv.NewTerminal(uv.NewConsole(rawReader, os.Stdout, os.Environ()), nil)
 		if uvTerm == nil {
 			cancel()
 			return nil, errors.New("failed to create UV terminal")
@@ -108,11 +105,11 @@ func New(ttyFile string) (*TTYUV, error) {
 
 		// Create raw capturing reader for tty file
 		rawReader := &rawCapturingReader{
-			reader:    inFile,
+			File:      inFile,
 			rawDataCh: tty.rawDataCh,
 		}
 		// Create UV terminal with raw capturing reader
-		uvTerm = uv.NewTerminal(rawReader, outFile, os.Environ())
+		uvTerm = uv.NewTerminal(uv.NewConsole(rawReader, outFile, os.Environ()), nil)
 		if uvTerm == nil {
 			inFile.Close()
 			cancel()
@@ -136,9 +133,6 @@ func New(ttyFile string) (*TTYUV, error) {
 	// Start processing raw data to input buffer
 	go tty.processRawData()
 
-	// Start monitoring events immediately to not miss anything
-	go func() { _ = tty.uvTerminal.StreamEvents(tty.eventCtx, tty.eventCh) }()
-
 	// Process events in background (for window size, etc.)
 	go tty.processEvents()
 
@@ -146,7 +140,18 @@ func New(ttyFile string) (*TTYUV, error) {
 }
 
 func (t *TTYUV) processEvents() {
-	for event := range t.eventCh {
+	events := t.uvTerminal.Events()
+	for {
+		var event uv.Event
+		select {
+		case <-t.eventCtx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			event = ev
+		}
 		// Only handle resize events - input data is now handled by processRawData
 		switch ev := event.(type) {
 		case uv.WindowSizeEvent:
@@ -157,7 +162,7 @@ func (t *TTYUV) processEvents() {
 			// Send resize event with current cell and pixel sizes
 			t.sendResizeEvent()
 
-		case uv.WindowPixelSizeEvent:
+		case uv.PixelSizeEvent:
 			t.mu.Lock()
 			t.pixelW, t.pixelH = ev.Width, ev.Height
 			t.mu.Unlock()
@@ -206,17 +211,12 @@ func (t *TTYUV) Write(b []byte) (n int, err error) {
 		return 0, err
 	}
 
-	// Write to UV terminal
-	n, err = t.uvTerminal.WriteString(string(b))
+	// Write directly to the console output of the UV terminal
+	n, err = t.uvTerminal.Write(b)
 	if err != nil {
 		return n, errors.New(err)
 	}
 
-	// Flush output
-	if err := t.uvTerminal.Flush(); err != nil {
-		return n, errors.New(err)
-	}
-
 	return n, nil
 }
 
@@ -266,7 +266,7 @@ func (t *TTYUV) Close() error {
 	}()
 	if t.uvTerminal != nil {
 		// TODO ioclt fails currently
-		err := t.uvTerminal.Shutdown(context.Background())
+		err := t.uvTerminal.Stop()
 		if err != nil {
 			log.Println(err)
 		}
@@ -275,10 +275,6 @@ func (t *TTYUV) Close() error {
 	if t.eventCancel != nil {
 		t.eventCancel()
 	}
-	if t.eventCh != nil {
-		close(t.eventCh)
-		t.eventCh = nil
-	}
 	return nil
 }
 
@@ -0,0 +1,321 @@
+package bubbleteaimg
+
+import (
+	"image"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	tea "charm.land/bubbletea/v2"
+	uv "github.com/charmbracelet/ultraviolet"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/internal/logx"
+	"github.com/srlehn/termimg/term"
+	"github.com/srlehn/termimg/tty/bubbleteatty"
+)
+
+// The first cell of each row of an image holds the id of the image, the second one the row
+// (Supplementary Private Use Area-B). The markers are replaced with placeholders before rendering.
+const (
+	markerImageBase = 0x100000
+	markerRowBase   = 0x108000
+	markerMax       = 0x10FFFD
+)
+
+func markerImage(id int) rune { return rune(markerImageBase + id) }
+func markerRow(row int) rune  { return rune(markerRowBase + row) }
+
+// settleDelay is the time after which the last view is assumed on screen
+// if the program didn't write anymore.
+const settleDelay = 50 * time.Millisecond
+
+var (
+	framesMu    sync.Mutex
+	framesByTTY = make(map[*bubbleteatty.TTYBubbleTea]*frames)
+)
+
+// frames locates the images in the views of a program and draws them between its frames.
+//
+// The renderer writes one of the last two views passed to it. Images are drawn after a write
+// if their placement is the same in both views, otherwise once the program didn't write
+// for settleDelay.
+type frames struct {
+	term *term.Terminal
+	tty  *bubbleteatty.TTYBubbleTea
+
+	mu              sync.Mutex
+	images          []*Image
+	nextID          int
+	writes          uint64 // writes of the program
+	clearPending    bool   // a repaint of the screen is requested
+	clearPlacements bool
+	redrawScheduled bool
+	inlineLogged    bool
+	width, height   int // size of the terminal in cells from tea.WindowSizeMsg
+}
+
+var _ bubbleteatty.FrameHook = (*frames)(nil)
+
+// redrawMsg requests drawing the pending images if the program didn't write since.
+type redrawMsg struct {
+	frames *frames
+	writes uint64
+}
+
+func framesOf(tm *term.Terminal, tty *bubbleteatty.TTYBubbleTea) *frames {
+	framesMu.Lock()
+	defer framesMu.Unlock()
+	f, ok := framesByTTY[tty]
+	if !ok {
+		f = &frames{term: tm, tty: tty}
+		framesByTTY[tty] = f
+		tty.AddFrameHook(f)
+	}
+	return f
+}
+
+func (f *frames) add(m *Image) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if markerImage(f.nextID) >= markerRowBase {
+		return errors.New(`too many images`)
+	}
+	m.frames, m.id = f, f.nextID
+	f.nextID++
+	f.images = append(f.images, m)
+	return nil
+}
+
+// remove removes the image, clears its graphics and releases its canvas.
+func (f *frames) remove(m *Image) error {
+	framesMu.Lock()
+	defer framesMu.Unlock()
+	f.tty.LockOutput()
+	defer f.tty.UnlockOutput()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images = slices.DeleteFunc(f.images, func(img *Image) bool { return img == m })
+	shown := m.res.Shown().Visible()
+	// clears the placements of drawers placing the images over the cells (kitty)
+	err := m.res.Close()
+	if shown && m.res.FlushAction() == term.FlushRedraw {
+		f.requestClear()
+	}
+	if len(f.images) == 0 {
+		f.tty.RemoveFrameHook(f)
+		delete(framesByTTY, f.tty)
+	}
+	return err
+}
+
+// Update invalidates the images when the renderer erases the screen.
+func (f *frames) Update(msg tea.Msg) tea.Cmd {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		f.mu.Lock()
+		f.width, f.height = msg.Width, msg.Height
+		f.mu.Unlock()
+		f.invalidate()
+	case redrawMsg:
+		if msg.frames == f {
+			f.redraw(msg.writes)
+		}
+	default:
+		if msg == tea.ClearScreen() {
+			f.mu.Lock()
+			f.clearPending = false
+			f.mu.Unlock()
+			f.invalidate()
+		}
+	}
+	return nil
+}
+
+// View locates the images in the laid out view and replaces their markers with placeholders.
+// Images drawn into the cells (sixel, iTerm2) that moved or were removed from the view are
+// cleared by repainting the screen, the placements of the other drawers are cleared by Flushed.
+func (f *frames) View(v *tea.View, scr *uv.ScreenBuffer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.images) == 0 {
+		return
+	}
+	if scr == nil && !f.inlineLogged {
+		f.inlineLogged = true
+		logx.Info(`images are only drawn in the alt screen mode (tea.View.AltScreen), the position of inline views is unknown`, f.term)
+	}
+	places := f.locate(scr)
+	v.Content = strings.Map(f.stripMarker, v.Content)
+	var stale, pending bool
+	for _, m := range f.images {
+		m.prev = m.res.Placement()
+		m.res.Place(places[m])
+		stale = stale || (m.res.Stale() && m.res.FlushAction() == term.FlushRedraw)
+		pending = pending || m.pending()
+	}
+	if stale {
+		f.requestClear()
+	}
+	if pending {
+		f.scheduleRedraw()
+	}
+}
+
+// Flushed flushes the reservations of the images placed the same in the last two views.
+func (f *frames) Flushed() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	if f.clearPending || len(f.images) == 0 {
+		return
+	}
+	f.clearDrawerPlacements()
+	var pending bool
+	rs := make([]*term.Reservation, 0, len(f.images))
+	for _, m := range f.images {
+		if m.res.Placement() != m.prev {
+			// the written frame might be the previous view
+			pending = pending || m.pending()
+			continue
+		}
+		rs = append(rs, m.res)
+	}
+	_ = term.FlushReservations(false, rs...) // logged by the reservations
+	if pending {
+		f.scheduleRedraw()
+	}
+}
+
+// redraw draws the pending images if the program didn't write since the redraw was scheduled.
+func (f *frames) redraw(writes uint64) {
+	f.tty.LockOutput()
+	defer f.tty.UnlockOutput()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.redrawScheduled = false
+	if f.clearPending {
+		// the images are redrawn after the repaint
+		return
+	}
+	if writes != f.writes {
+		if slices.ContainsFunc(f.images, (*Image).pending) {
+			f.scheduleRedraw()
+		}
+		return
+	}
+	// the last view is on screen
+	f.clearDrawerPlacements()
+	rs := make([]*term.Reservation, 0, len(f.images))
+	for _, m := range f.images {
+		m.prev = m.res.Placement()
+		rs = append(rs, m.res)
+	}
+	_ = term.FlushReservations(false, rs...) // logged by the reservations
+}
+
+// invalidate causes all images to be redrawn after the screen was erased.
+func (f *frames) invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.images {
+		m.res.Invalidate()
+	}
+	f.clearPlacements = true
+	f.scheduleRedraw()
+}
+
+// scheduleRedraw sends a redrawMsg after settleDelay. f.mu has to be locked.
+func (f *frames) scheduleRedraw() {
+	if f.redrawScheduled || f.tty.Program == nil {
+		return
+	}
+	f.redrawScheduled = true
+	msg := redrawMsg{frames: f, writes: f.writes}
+	time.AfterFunc(settleDelay, func() { f.tty.Send(msg) })
+}
+
+// requestClear requests a repaint of the screen, which removes graphics drawn into the cells
+// (sixel, iTerm2). f.mu has to be locked.
+func (f *frames) requestClear() {
+	if f.clearPending || f.tty.Program == nil {
+		return
+	}
+	f.clearPending = true
+	f.tty.Send(tea.ClearScreen())
+}
+
+// clearDrawerPlacements removes the images of drawers placing them over the cells (kitty).
+// f.mu and the output have to be locked.
+func (f *frames) clearDrawerPlacements() {
+	if !f.clearPlacements {
+		return
+	}
+	f.clearPlacements = false
+	term.ClearPlacements(f.term)
+}
+
+// locate returns the placements of the images found in scr.
+func (f *frames) locate(scr *uv.ScreenBuffer) map[*Image]term.Placement {
+	if scr == nil {
+		return nil
+	}
+	byID := make(map[int]*Image, len(f.images))
+	sizes := make(map[*Image]image.Point, len(f.images))
+	for _, m := range f.images {
+		byID[m.id] = m
+		sizes[m] = m.size()
+	}
+	places := make(map[*Image]term.Placement)
+	rows := make(map[*Image]int)
+	scrW, scrH := scr.Width(), scr.Height()
+	for y := range scrH {
+		for x := range scrW - 1 {
+			m, ok := byID[markerAt(scr, x, y)-markerImageBase]
+			if !ok {
+				continue
+			}
+			row := markerAt(scr, x+1, y) - markerRowBase
+			if row < 0 || row > markerMax-markerRowBase {
+				continue
+			}
+			sz := sizes[m]
+			cell := image.Rect(x, y, min(x+sz.X, scrW), y+1)
+			contentCell := image.Rect(0, row, cell.Dx(), row+1)
+			p := places[m]
+			if p.Visible() {
+				p.Area, p.Content = p.Area.Union(cell), p.Content.Union(contentCell)
+			} else {
+				p = term.Placement{Area: cell, Content: contentCell, Size: sz}
+			}
+			places[m] = p
+			rows[m]++
+		}
+	}
+	for m, p := range places {
+		if p.Area.Size() != p.Content.Size() || rows[m] != p.Area.Dy() {
+			// not a plain translation
+			delete(places, m)
+		}
+	}
+	return places
+}
+
+// markerAt returns the first rune of the cell.
+func markerAt(scr *uv.ScreenBuffer, x, y int) int {
+	c := scr.CellAt(x, y)
+	if c == nil {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(c.Content)
+	return int(r)
+}
+
+func (f *frames) stripMarker(r rune) rune {
+	if (r >= markerImageBase && r < markerImage(f.nextID)) || (r >= markerRowBase && r <= markerMax) {
+		return term.Placeholder
+	}
+	return r
+}
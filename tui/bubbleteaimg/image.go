@@ -1,378 +1,260 @@
-//go:build dev
-
+// Package bubbleteaimg provides a Bubble Tea component drawing images with the terminal's drawers.
+//
+// The terminal has to be created with bubbleteatty.BubbleTeaProgram.
+//
+// Known gaps: images are only drawn in alt screen mode (tea.View.AltScreen), in inline mode
+// the position of the view on the screen is unknown and the images stay blank.
+// Bubble Tea doesn't expose the layout of its renderer, the images are located by private use
+// marker runes in the first two cells of each of their rows in the view laid out like by the
+// renderer. Views stripping or reordering these runes lose the graphics of the image.
 package bubbleteaimg
 
 import (
-	"fmt"
 	"image"
-	"log/slog"
-	"strconv"
-	"time"
-	"unsafe"
+	"strings"
 
-	tea "github.com/charmbracelet/bubbletea"
-	"github.com/charmbracelet/lipgloss"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
 
 	"github.com/srlehn/termimg/internal/errors"
-	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/term"
 	"github.com/srlehn/termimg/tty/bubbleteatty"
 )
 
-var _ tea.Model = (*Image)(nil)
-
+// Image is a Bubble Tea component drawing an image into the cells of its view.
+//
+// View returns placeholder cells marked for locating them in the view of the program.
+// The graphics are drawn after the renderer wrote the frame, redrawn after tea.WindowSizeMsg
+// and tea.ClearScreen and cleared when the image moves or isn't part of the view anymore.
+// Partially visible images are cropped.
 type Image struct {
-	style *lipgloss.Style
-	*term.Canvas
-	bounds     image.Rectangle
-	term       *term.Terminal
-	tty        *bubbleteatty.TTYBubbleTea
-	renderer   *lipgloss.Renderer
-	scanner    *scanner
-	sizeImgPxl image.Point
-	id         string
+	frames *frames
+	id     int
+
+	// guarded by frames.mu
+	img            image.Image
+	style          lipgloss.Style
+	width, height  int // preferred size with the frame of the style, see SetSize
+	availW, availH int // size allocated by the parent, 0 for the size of the terminal
+	res            *term.Reservation
+	prev           term.Placement // placement in the previous view
 }
 
-func NewImage(tm *term.Terminal, img image.Image, style *lipgloss.Style) (*Image, error) {
-	m := &Image{
-		style: style,
-	}
-	m.initStyle()
-	m.id = strconv.FormatUint(uint64(uintptr(unsafe.Pointer(m))), 10)
-	if m.term == nil {
-		if err := errors.NilParam(tm, img); err != nil {
-			return nil, err
-		}
-		m.term = tm
-	} else {
-		if tm != nil {
-			return nil, errors.New(`*term.Terminal can only be set once`)
-		}
-		if err := errors.NilParam(img); err != nil {
-			return nil, err
-		}
-	}
-	m.sizeImgPxl = img.Bounds().Size()
-	bounds, err := m.cellBoundsFromStyle()
-	if err != nil {
+// NewImage creates an image component for the program of the terminal.
+// The graphics are only drawn while the view of the program is in the alt screen mode
+// (tea.View.AltScreen), in inline mode the position of the view on the screen is unknown
+// and the images stay blank.
+func NewImage(tm *term.Terminal, img image.Image) (*Image, error) {
+	if err := errors.NilParam(tm, img); err != nil {
 		return nil, err
 	}
-	canvas, err := tm.NewCanvas(bounds)
+	tty, ok := tm.TTY().(*bubbleteatty.TTYBubbleTea)
+	if !ok || tty == nil {
+		return nil, errors.New(`bubbleteaimg.Image requires a bubbleteatty.TTYBubbleTea`)
+	}
+	res, err := tm.Reserve(img)
 	if err != nil {
 		return nil, err
 	}
-	if t := tm.TTY(); t != nil {
-		if tb, ok := t.(*bubbleteatty.TTYBubbleTea); ok {
-			m.tty = tb
-			if tb.Scanner != nil {
-				if sc, ok := tb.Scanner.(*scanner); ok {
-					m.scanner = sc
-				} else {
-					return nil, errors.New(`tty already has a scanner of unknown type registered`)
-				}
-			} else {
-				m.scanner = newScanner()
-				tb.Scanner = m.scanner
-			}
-		}
+	m := &Image{
+		img:   img,
+		style: lipgloss.NewStyle(),
+		res:   res,
 	}
-	if logx.IsErr(canvas.SetImage(term.NewImage(img)), tm, slog.LevelError) {
+	if err := framesOf(tm, tty).add(m); err != nil {
 		return nil, err
 	}
-	if m.Canvas != nil {
-		m.Canvas.Close()
-	}
-	m.Canvas = canvas
 	return m, nil
 }
 
-func (m *Image) Style() *lipgloss.Style {
+// SetImage replaces the image.
+func (m *Image) SetImage(img image.Image) {
 	if m == nil {
-		return nil
-	}
-	return m.style
-}
-
-func (m *Image) initRenderer() {
-	if m == nil || m.tty == nil || m.term == nil || m.renderer != nil {
 		return
 	}
-	// *term.Terminal has to be initiated
-	m.renderer = m.tty.LipGlossRenderer()
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	m.img = img
+	m.res.SetImage(img)
+	m.frames.scheduleRedraw()
 }
 
-func (m *Image) SetStyle(style *lipgloss.Style) {
+// SetSize sets the size of the image including the margins, border and padding of its style.
+// Positive values are cells, negative values a percentage of the available size (e.g. -50 means 50%).
+// A value of 0 chooses the size from the other one keeping the aspect ratio of the image.
+// If both are 0, the image has its own size, shrunk to fit into the available size.
+// A width or height set in the style takes precedence.
+func (m *Image) SetSize(width, height int) {
 	if m == nil {
 		return
 	}
-	m.initRenderer()
-	s := style.Copy().Renderer(m.renderer)
-	m.style = &s
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	m.width, m.height = width, height
 }
 
-func (m *Image) SetSize(sz image.Point) error {
-	if err := errors.NilReceiver(m); err != nil {
-		return err
-	}
-	m.initStyle()
-	wMax := m.style.GetMaxWidth()
-	hMax := m.style.GetMaxHeight()
-	if (wMax > 0 && sz.X > wMax) || (hMax > 0 && sz.Y > hMax) {
-		return errors.New(`image size is larger than allowed`)
+// SetAvailableSize sets the size in cells the parent allocated for the image with its style.
+// A value of 0 uses the size of the terminal.
+func (m *Image) SetAvailableSize(width, height int) {
+	if m == nil {
+		return
 	}
-	m.style.Width(sz.X).Height(sz.Y)
-	return nil
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	m.availW, m.availH = width, height
 }
 
-func (m *Image) SetBounds(bounds image.Rectangle) error {
-	if err := errors.NilReceiver(m); err != nil {
-		return err
-	}
-	m.initStyle()
-	w := bounds.Dx()
-	h := bounds.Dy()
-	wMax := m.style.GetMaxWidth()
-	hMax := m.style.GetMaxHeight()
-	if (wMax > 0 && w > wMax) || (hMax > 0 && h > hMax) {
-		return errors.New(`image size is larger than allowed`)
+// Size returns the size of the image in cells without the frame of its style.
+func (m *Image) Size() (int, int) {
+	if m == nil {
+		return 0, 0
 	}
-	m.style.Width(w).Height(h)
-	m.bounds = bounds
-	return nil
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	sz := m.size()
+	return sz.X, sz.Y
 }
 
-func (m *Image) fitImage(bounds image.Rectangle) (image.Rectangle, error) {
-	if err := errors.NilReceiver(m, m.scanner, m.scanner.rects); err != nil {
-		return image.Rectangle{}, err
+func (m *Image) size() image.Point {
+	availW, availH := m.availW, m.availH
+	if availW <= 0 {
+		availW = m.frames.width
 	}
-	bounds, ok := m.scanner.rects[m.id]
-	if !ok {
-		return image.Rectangle{}, errors.New(`unknown image widget boundary`)
+	if availH <= 0 {
+		availH = m.frames.height
 	}
-	// remove frame
-	wFr, hFr := m.style.GetFrameSize()
-	x := m.style.GetBorderLeftSize() + m.style.GetMarginLeft() + m.style.GetPaddingLeft()
-	y := m.style.GetBorderTopSize() + m.style.GetMarginTop() + m.style.GetPaddingTop()
-	bounds = image.Rect(bounds.Min.X+x, bounds.Min.Y+y, bounds.Max.X+x-wFr, bounds.Max.Y+y-hFr)
-	// fit image
-	szSc, err := m.term.CellScale(m.sizeImgPxl, image.Pt(bounds.Dx(), 0))
-	if err != nil {
-		return image.Rectangle{}, err
+	w, h := sizeOf(m.width, availW), sizeOf(m.height, availH)
+	// the size of a style includes border and padding, but not the margins
+	if sw := m.style.GetWidth(); sw > 0 {
+		w = sw + m.style.GetHorizontalMargins()
 	}
-	if szSc.Y <= bounds.Dy() {
-		d := (bounds.Dy() - szSc.Y) / 2
-		return image.Rect(bounds.Min.X, bounds.Min.Y+d, bounds.Max.X, bounds.Max.Y-d), nil
+	if sh := m.style.GetHeight(); sh > 0 {
+		h = sh + m.style.GetVerticalMargins()
 	}
-	szSc, err = m.term.CellScale(m.sizeImgPxl, image.Pt(0, bounds.Dy()))
-	if err != nil {
-		return image.Rectangle{}, err
+	frameW, frameH := m.style.GetFrameSize()
+	if w > 0 {
+		w = max(w-frameW, 1)
 	}
-	if szSc.X <= bounds.Dx() {
-		d := (bounds.Dx() - szSc.X) / 2
-		return image.Rect(bounds.Min.X+d, bounds.Min.Y, bounds.Max.X-d, bounds.Max.Y), nil
+	if h > 0 {
+		h = max(h-frameH, 1)
 	}
-	return bounds, nil
+	w, h = m.autoSize(w, h, availW-frameW, availH-frameH)
+	// the first two cells of each row hold the markers
+	return image.Pt(max(w, 2), max(h, 1))
 }
 
-func (m *Image) cellBoundsFromStyle() (image.Rectangle, error) {
-	size, err := m.sizeInCellsFromStyle()
-	if err != nil {
-		return image.Rectangle{}, err
-	}
-	offset := image.Point{} // TODO
-	bounds := image.Rect(offset.X, offset.Y, offset.X+size.X, offset.Y+size.Y)
-	if bounds.Empty() {
-		return image.Rectangle{}, errors.New(`unable to determine widget bounds`)
+// sizeOf resolves a size set with SetSize.
+func sizeOf(size, avail int) int {
+	if size < 0 {
+		return max(avail, 0) * -size / 100
 	}
-	return bounds, nil
+	return size
 }
 
-func (m *Image) sizeInCellsFromStyle() (image.Point, error) {
-	if err := errors.NilReceiver(m, m.style); err != nil {
-		return image.Point{}, err
-	}
-	m.initStyle()
-	// TODO subtract widget offset and frame
-	w := m.style.GetWidth()
-	h := m.style.GetHeight()
-	var size image.Point
-	if w > 0 {
-		if h > 0 {
-			size = image.Pt(w, h)
-		} else {
-			if err := errors.NilReceiver(m.term); err != nil {
-				return image.Point{}, err
-			}
-			szSc, err := m.term.CellScale(m.sizeImgPxl, image.Pt(w, 0))
-			if err != nil {
-				return image.Point{}, err
-			}
-			hMax := m.style.GetMaxHeight()
-			_, tch, err := m.term.SizeInCells()
-			if err != nil {
-				return image.Point{}, err
-			}
-			hMaxReal := int(tch)
-			if hMax > 0 && hMax < hMaxReal {
-				hMaxReal = hMax
-			}
-			if hMax > 0 && szSc.Y > hMaxReal {
-				szSc, err = m.term.CellScale(m.sizeImgPxl, image.Pt(0, hMaxReal))
-				if err != nil {
-					return image.Point{}, err
-				}
-			}
-			size = szSc
+// autoSize chooses the unset sizes from the aspect ratio of the image.
+func (m *Image) autoSize(w, h, availW, availH int) (int, int) {
+	if (w > 0 && h > 0) || m.img == nil {
+		return w, h
+	}
+	b := m.img.Bounds()
+	cw, ch, err := m.frames.term.CellSize()
+	if err != nil || cw <= 0 || ch <= 0 || b.Dx() <= 0 || b.Dy() <= 0 {
+		return w, h
+	}
+	imgW, imgH := float64(b.Dx())/cw, float64(b.Dy())/ch
+	switch {
+	case w <= 0 && h <= 0:
+		scale := 1.
+		if availW > 0 {
+			scale = min(scale, float64(availW)/imgW)
 		}
-	} else {
-		if h > 0 {
-			if err := errors.NilReceiver(m.term); err != nil {
-				return image.Point{}, err
-			}
-			szSc, err := m.term.CellScale(m.sizeImgPxl, image.Pt(0, h))
-			if err != nil {
-				return image.Point{}, err
-			}
-			wMax := m.style.GetMaxWidth()
-			tcw, _, err := m.term.SizeInCells()
-			if err != nil {
-				return image.Point{}, err
-			}
-			wMaxReal := int(tcw)
-			if wMax > 0 && wMax < wMaxReal {
-				wMaxReal = wMax
-			}
-			if wMax > 0 && szSc.X > wMaxReal {
-				szSc, err = m.term.CellScale(m.sizeImgPxl, image.Pt(wMaxReal, 0))
-				if err != nil {
-					return image.Point{}, err
-				}
-			}
-			size = szSc
-		} else {
-			wMax := m.style.GetMaxWidth()
-			hMax := m.style.GetMaxHeight()
-			tcw, tch, err := m.term.SizeInCells()
-			if err != nil {
-				return image.Point{}, err
-			}
-			wMaxReal := int(tcw)
-			if wMax > 0 && wMax < wMaxReal {
-				wMaxReal = wMax
-			}
-			hMaxReal := int(tch)
-			if hMax > 0 && hMax < hMaxReal {
-				hMaxReal = hMax
-			}
-			szSc, err := m.term.CellScale(m.sizeImgPxl, image.Pt(wMaxReal, hMaxReal))
-			if err != nil {
-				return image.Point{}, err
-			}
-			size = szSc
+		if availH > 0 {
+			scale = min(scale, float64(availH)/imgH)
 		}
+		return int(imgW*scale + 0.5), int(imgH*scale + 0.5)
+	case w <= 0:
+		return int(float64(h)*imgW/imgH + 0.5), h
+	default:
+		return w, int(float64(w)*imgH/imgW + 0.5)
 	}
+}
 
-	if size.Eq(image.Point{}) {
-		return image.Point{}, errors.New(`unable to determine widget size`)
+// SetStyle sets the style rendered around the cells of the image.
+// Its margins, border and padding are part of the size of the image.
+func (m *Image) SetStyle(style lipgloss.Style) {
+	if m == nil {
+		return
 	}
-	return size, nil
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	m.style = style
 }
 
+// Style returns the style rendered around the cells of the image.
+func (m *Image) Style() lipgloss.Style {
+	if m == nil {
+		return lipgloss.NewStyle()
+	}
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	return m.style
+}
+
+// Init implements the Bubble Tea component convention.
 func (m *Image) Init() tea.Cmd { return nil }
 
-func (m *Image) Update(msg tea.Msg) (tea.Model, tea.Cmd) { return m, nil }
+// Update implements the Bubble Tea component convention.
+// The images see the messages of the program, e.g. tea.WindowSizeMsg, without passing them on.
+func (m *Image) Update(msg tea.Msg) (*Image, tea.Cmd) { return m, nil }
 
-func (m *Image) initStyle() {
+// Invalidate causes the graphics to be redrawn, e.g. after they were overwritten.
+func (m *Image) Invalidate() {
 	if m == nil {
 		return
 	}
-	var mod bool
-	if m.style == nil {
-		style := lipgloss.NewStyle()
-		m.style = &style
-		mod = true
-	}
-	if m.renderer == nil {
-		m.initRenderer()
-		mod = true
-	}
-	if mod {
-		style := m.style.Copy().Renderer(m.renderer)
-		m.style = &style
-	}
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	m.res.Invalidate()
+	m.frames.scheduleRedraw()
 }
 
-var wrapFmt = string(csi) + `%s` + string(csiTerm) + `%s` + string(csi) + `%[1]s` + string(csiTerm)
-
+// View returns the cells of the image with its style.
 func (m *Image) View() string {
 	if m == nil {
-		return `<nil bubbletea.Model>`
-	}
-	m.initStyle()
-	ret := `` // widget text content
-	// check for variable position
-	if m.bounds == (image.Rectangle{}) {
-		ret = fmt.Sprintf(wrapFmt, m.id, m.style.Render(ret))
-	} else {
-		// TODO needs testing
-		ret = lipgloss.Place(
-			m.bounds.Min.X, m.bounds.Min.Y,
-			lipgloss.Right, lipgloss.Bottom,
-			m.style.Render(ret),
-		)
-		if m.scanner != nil {
-			m.scanner.setRectManually(m.id, m.bounds)
+		return ``
+	}
+	m.frames.mu.Lock()
+	defer m.frames.mu.Unlock()
+	sz := m.size()
+	pc := m.res.Placeholder()
+	cells := lipgloss.NewStyle()
+	if pc.Fg != nil {
+		cells = cells.Foreground(pc.Fg)
+	}
+	if pc.Bg != nil {
+		cells = cells.Background(pc.Bg)
+	}
+	var b strings.Builder
+	for row := range sz.Y {
+		if row > 0 {
+			b.WriteByte('\n')
 		}
+		b.WriteRune(markerImage(m.id))
+		b.WriteRune(markerRow(row))
+		b.WriteString(strings.Repeat(string(pc.Rune), sz.X-2))
 	}
-	if m.scanner != nil {
-		m.scanner.setAfterWriteFunc(m.id, m.draw)
-	} else {
-		if m.term != nil {
-			logx.Error(`bubbleteaimg.Image reqires a bubbleteatty.TTYBubbleTea`, m.term, `tty-type`, fmt.Sprintf(`%T`, m.term.TTY()))
-		}
-		// fallback, might become spammy & move cursor
-		go func() {
-			time.Sleep(1000 / 30 * time.Millisecond)
-			m.draw(image.Rectangle{})
-		}()
-	}
-	return ret
+	return m.style.Render(cells.Render(b.String()))
 }
 
-func (m *Image) draw(bounds image.Rectangle) {
-	if m == nil || m.term == nil || m.Canvas == nil {
-		return
+// Close removes the image from the program, clears its graphics and releases the canvas.
+func (m *Image) Close() error {
+	if m == nil || m.frames == nil {
+		return nil
 	}
+	return m.frames.remove(m)
+}
 
-	// If we have valid scanner bounds, use them directly - no cursor queries needed
-	if !bounds.Empty() {
-		// Scanner provided coordinates - skip cursor operations
-	} else {
-		// Fallback to cursor queries only when scanner bounds unavailable
-		x, y, errCursor := m.term.Cursor()
-		if !logx.IsErr(errCursor, m.term, slog.LevelError) {
-			// Set up cursor restoration immediately after successful query
-			defer func() {
-				errCursor = m.term.SetCursor(x, y)
-				logx.IsErr(errCursor, m.term, slog.LevelError)
-			}()
-			// Use style dimensions with cursor position
-			w := m.style.GetWidth()
-			h := m.style.GetHeight()
-			if w == 0 || h == 0 {
-				return
-			}
-			bounds = image.Rect(int(x), int(y), int(x)+w, int(y)+h)
-		} else {
-			return
-		}
-	}
-	bounds, err := m.fitImage(bounds)
-	_ = logx.IsErr(err, m.term, slog.LevelInfo)
-	errPos := m.Canvas.SetCellArea(bounds)
-	if logx.IsErr(errPos, m.term, slog.LevelError) {
-		return
-	}
-	errDraw := m.Canvas.Draw(nil)
-	logx.IsErr(errDraw, m.term, slog.LevelError)
+// pending reports whether flushing the reservation changes the graphics on screen.
+func (m *Image) pending() bool {
+	return m.res.Pending() || m.res.Stale()
 }
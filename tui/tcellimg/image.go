@@ -1,155 +1,304 @@
+// Package tcellimg provides a tcell views widget drawing images with the terminal's drawers.
 package tcellimg
 
 import (
 	"context"
 	"image"
-	"image/draw"
-	"log/slog"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/gdamore/tcell/v2/views"
 
 	"github.com/srlehn/termimg/internal/errors"
-	"github.com/srlehn/termimg/internal/logx"
 	"github.com/srlehn/termimg/term"
 )
 
-// TODO handle events
-
-var _ image.Image = (*Image)(nil)
-var _ draw.Image = (*Image)(nil)
 var _ views.Widget = (*Image)(nil)
 
+// Image is a views.Widget drawing an image into its view with the terminal's drawers.
+//
+// The cells of the view are reserved with the placeholders of a term.Reservation and locked
+// while the graphics are shown, so that tcell doesn't draw over them. The graphics are redrawn
+// when the position of the view on the screen changes, e.g. by layout changes or scrolling,
+// and cleared when the image is removed from its layout (Unwatch) or its view is unset.
+// The position of a *views.ViewPort is relative to its parent view, views nested in layouts
+// that aren't placed at the screen origin need SetParent. Partially visible images are cropped.
+// Widgets painting over the image are detected at the next Draw, the graphics stay cleared
+// until the cells aren't painted over anymore.
 type Image struct {
-	*views.CellView
-	*term.Canvas
-	term *term.Terminal
-	scr  tcell.Screen
-	mdl  linesModel
+	views.WidgetWatchers
+	term  *term.Terminal
+	scr   tcell.Screen
+	res   *term.Reservation
+	img   image.Image
+	view  views.View
+	style tcell.Style
+
+	// preferred size in cells, 0 for the size of the image
+	width, height int
+
+	// position of the parent view on the screen
+	parentOrigin  image.Point
+	parentVisible image.Rectangle
+
+	// cells painted with placeholders in the last Draw
+	reserved    image.Rectangle
+	reservedScr image.Point
+
+	locked image.Rectangle // screen cells locked for the graphics on screen
 }
 
-func NewImage(img image.Image, bounds image.Rectangle, tm *term.Terminal, scr tcell.Screen) (*Image, error) {
-	// TODO accept
+// NewImage creates an image widget drawing on scr, the screen of the views.Application.
+// The position and size of the image are given by the view set by SetView.
+func NewImage(img image.Image, tm *term.Terminal, scr tcell.Screen) (*Image, error) {
 	if img == nil || tm == nil || scr == nil {
 		return nil, errors.NilParam()
 	}
-	canvas, err := tm.NewCanvas(bounds)
+	res, err := tm.Reserve(img)
 	if err != nil {
 		return nil, err
 	}
-	if logx.IsErr(canvas.SetImage(img), tm, slog.LevelError) {
-		return nil, err
+	return &Image{
+		term:  tm,
+		scr:   scr,
+		res:   res,
+		img:   img,
+		style: tcell.StyleDefault,
+	}, nil
+}
+
+// SetImage replaces the image.
+func (m *Image) SetImage(img image.Image) {
+	if m == nil {
+		return
 	}
-	m := &Image{
-		CellView: views.NewCellView(),
-		Canvas:   canvas,
-		term:     tm,
-		scr:      scr,
+	m.img = img
+	m.res.SetImage(img)
+	m.PostEventWidgetContent(m)
+}
+
+// SetSize sets the preferred size in cells reported by Size.
+// A value of 0 uses the size of the image in cells.
+func (m *Image) SetSize(width, height int) {
+	if m == nil {
+		return
 	}
-	view := views.NewViewPort(scr, bounds.Min.X, bounds.Min.Y, bounds.Dx(), bounds.Dy())
-	m.Init()
-	m.SetView(view)
-	mdl := &linesModel{
-		width:  bounds.Dx(),
-		height: bounds.Dy(),
-		x:      bounds.Min.X,
-		y:      bounds.Min.Y,
+	m.width, m.height = width, height
+	m.PostEventWidgetResize(m)
+}
+
+// SetStyle sets the style of the reserved cells, the colors of the placeholders take precedence.
+func (m *Image) SetStyle(style tcell.Style) {
+	if m == nil {
+		return
 	}
-	m.SetModel(mdl)
-	return m, nil
+	m.style = style
 }
 
-func (m *Image) Draw() {
-	// m.CellView.Draw() // area not drawn until tcell.Screen.Sync() is called
+// Size returns the preferred size of the image in cells.
+func (m *Image) Size() (int, int) {
+	if m == nil {
+		return 0, 0
+	}
+	w, h := m.width, m.height
+	if (w <= 0 || h <= 0) && m.img != nil {
+		b := m.img.Bounds()
+		cw, ch, err := m.term.CellSize()
+		if err == nil && cw > 0 && ch > 0 && b.Dx() > 0 && b.Dy() > 0 {
+			switch {
+			case w <= 0 && h <= 0:
+				w, h = int(float64(b.Dx())/cw+0.5), int(float64(b.Dy())/ch+0.5)
+			case w <= 0:
+				w = int(float64(h)*ch*float64(b.Dx())/(cw*float64(b.Dy())) + 0.5)
+			default:
+				h = int(float64(w)*cw*float64(b.Dy())/(ch*float64(b.Dx())) + 0.5)
+			}
+		}
+	}
+	return max(w, 2), max(h, 2)
+}
 
-	mdl := m.CellView.GetModel()
-	x, y, _, _ := mdl.GetCursor()
-	w, h := mdl.GetBounds()
-	bounds := image.Rect(x, y, x+w, y+h)
-	if !bounds.Eq(m.Canvas.CellArea()) {
-		logx.Error(`bounds changed`, m.term, "canvas-bounds", m.Canvas.CellArea(), "tcell-bounds", bounds)
+// SetParent sets the position of the parent of the view on the screen: origin is the screen cell
+// of the cell 0,0 of the parent and visible are the screen cells showing the parent, an empty
+// rectangle for the whole screen. For a parent *views.ViewPort placed at x, y on the screen
+// and scrolled to the content cell vx, vy the origin is x-vx, y-vy.
+func (m *Image) SetParent(origin image.Point, visible image.Rectangle) {
+	if m == nil {
+		return
 	}
-	m.CellView.Lock()
-	defer m.CellView.Unlock()
-	m.scr.LockRegion(x, y, w, h, true)
-	defer m.scr.LockRegion(x, y, w, h, false)
-	err := m.Canvas.Draw(nil)
-	_ = logx.IsErr(err, m.term, slog.LevelError)
+	m.parentOrigin, m.parentVisible = origin, visible
+	m.Invalidate()
 }
 
-func (m *Image) Video(ctx context.Context, vid <-chan image.Image, frameDur time.Duration) error {
-	if m == nil || m.Canvas == nil || ctx == nil {
-		return nil
+// SetView sets the view the image is drawn into. A nil view clears the graphics.
+func (m *Image) SetView(view views.View) {
+	if m == nil {
+		return
+	}
+	if view == nil {
+		m.flush(term.Placement{}, false)
 	}
-	return m.Canvas.Video(ctx, vid, frameDur)
+	m.view = view
+	m.Invalidate()
 }
 
-func (m *Image) Close() error {
+// Resize is called when the size of the view changed.
+func (m *Image) Resize() {
+	m.Invalidate()
+	m.PostEventWidgetResize(m)
+}
+
+// Invalidate causes the graphics to be redrawn by the next Draw,
+// e.g. after tcell.Screen.Sync erased them.
+func (m *Image) Invalidate() {
 	if m == nil {
-		return nil
+		return
 	}
-	if m.Canvas == nil {
-		m = nil
-		return nil
+	m.res.Invalidate()
+}
+
+// HandleEvent handles resize events and the redraw requests of the image.
+func (m *Image) HandleEvent(ev tcell.Event) bool {
+	if m == nil {
+		return false
+	}
+	switch ev := ev.(type) {
+	case *tcell.EventResize:
+		// the screen is synced, graphics in the cells are erased
+		m.Invalidate()
+	case *tcell.EventInterrupt:
+		return ev.Data() == m
 	}
-	err := m.Canvas.Close()
-	m = nil
-	return logx.Err(err, m.term, slog.LevelError)
+	return false
 }
 
-// copied from github.com/gdamore/tcell/v2/views/textarea.go (Apache-2.0 license)
-type linesModel struct {
-	runes  [][]rune
-	width  int
-	height int
-	x      int
-	y      int
-	hide   bool
-	cursor bool
-	style  tcell.Style
+// Unwatch is called by layouts when the image is removed, this clears the graphics.
+func (m *Image) Unwatch(handler tcell.EventHandler) {
+	if m == nil {
+		return
+	}
+	m.WidgetWatchers.Unwatch(handler)
+	m.flush(term.Placement{}, false)
 }
 
-func (m *linesModel) GetCell(x, y int) (rune, tcell.Style, []rune, int) {
-	// if x < 0 || y < 0 || y >= m.height || x >= len(m.runes[y]) {
-	if x < 0 || y < 0 || y >= m.height || x >= m.width {
-		return 0, m.style, nil, 1
+// Draw reserves the cells of the view and draws the graphics if they are invalidated.
+func (m *Image) Draw() {
+	if m == nil || m.view == nil {
+		return
 	}
-	// XXX: extend this to support combining and full width chars
-	return 0, tcell.Style{}, nil, 1
+	scr := image.Pt(m.scr.Size())
+	// the screen content is kept between frames, except for screen size changes
+	resized := scr != m.reservedScr
+	obscured := !resized && m.paintedOver(m.reserved)
+	p := m.reserve()
+	m.reserved, m.reservedScr = p.Area, scr
+	if obscured {
+		p = term.Placement{}
+	}
+	m.flush(p, resized)
 }
 
-func (m *linesModel) GetBounds() (int, int) {
-	return m.width, m.height
+// flush draws, moves or clears the graphics for placement p and locks the cells
+// of the graphics on screen.
+func (m *Image) flush(p term.Placement, rewritten bool) {
+	m.res.Place(p)
+	drawing := m.res.Pending()
+	_ = m.res.Flushed(rewritten) // logged by the reservation
+	shown := m.res.Shown()
+	if shown != p {
+		// tcell rewrites the unlocked cells, which erases graphics drawn into the cells (sixel, iTerm2)
+		m.res.Invalidate()
+		shown = term.Placement{}
+	}
+	m.lock(shown.Area)
+	if drawing && shown.Visible() {
+		// request a frame for detecting widgets painted over the image
+		_ = m.scr.PostEvent(tcell.NewEventInterrupt(m))
+	}
 }
 
-func (m *linesModel) limitCursor() {
-	if m.x > m.width-1 {
-		m.x = m.width - 1
+// lock locks the cells of area instead of the previously locked cells.
+func (m *Image) lock(area image.Rectangle) {
+	if area == m.locked {
+		return
 	}
-	if m.y > m.height-1 {
-		m.y = m.height - 1
+	l := m.locked
+	m.scr.LockRegion(l.Min.X, l.Min.Y, l.Dx(), l.Dy(), false)
+	m.scr.LockRegion(area.Min.X, area.Min.Y, area.Dx(), area.Dy(), true)
+	m.locked = area
+}
+
+// reserve paints the view with placeholders and returns the placement of the image:
+// the visible screen cells and the corresponding cells of the view.
+func (m *Image) reserve() term.Placement {
+	vw, vh := m.view.Size()
+	if vw <= 0 || vh <= 0 {
+		return term.Placement{}
 	}
-	if m.x < 0 {
-		m.x = 0
+	r, style := m.placeholder()
+	m.view.Fill(r, style)
+	// the image in the coordinates of the parent and the cells of the parent showing the view
+	img := image.Rect(0, 0, vw, vh)
+	shown := img
+	if vp, ok := m.view.(*views.ViewPort); ok {
+		px, py, _, _ := vp.GetPhysical()
+		vx, vy, _, _ := vp.GetVisible()
+		img = img.Add(image.Pt(px-vx, py-vy))
+		shown = shown.Add(image.Pt(px, py))
 	}
-	if m.y < 0 {
-		m.y = 0
+	scrW, scrH := m.scr.Size()
+	visible := image.Rect(0, 0, scrW, scrH)
+	if !m.parentVisible.Empty() {
+		visible = visible.Intersect(m.parentVisible)
 	}
+	img = img.Add(m.parentOrigin)
+	area := shown.Add(m.parentOrigin).Intersect(img).Intersect(visible)
+	if area.Empty() {
+		return term.Placement{}
+	}
+	return term.Placement{Area: area, Content: area.Sub(img.Min), Size: image.Pt(vw, vh)}
 }
 
-func (m *linesModel) SetCursor(x, y int) {
-	m.x = x
-	m.y = y
-	m.limitCursor()
+// placeholder returns the rune and style of the reserved cells.
+func (m *Image) placeholder() (rune, tcell.Style) {
+	pc := m.res.Placeholder()
+	style := m.style
+	if pc.Fg != nil {
+		style = style.Foreground(tcell.FromImageColor(pc.Fg))
+	}
+	if pc.Bg != nil {
+		style = style.Background(tcell.FromImageColor(pc.Bg))
+	}
+	return pc.Rune, style
 }
 
-func (m *linesModel) MoveCursor(x, y int) {
-	m.x += x
-	m.y += y
-	m.limitCursor()
+// paintedOver reports whether the reserved cells were painted by other widgets.
+func (m *Image) paintedOver(reserved image.Rectangle) bool {
+	placeholder, placeholderStyle := m.placeholder()
+	for y := reserved.Min.Y; y < reserved.Max.Y; y++ {
+		for x := reserved.Min.X; x < reserved.Max.X; x++ {
+			r, _, style, _ := m.scr.GetContent(x, y)
+			if r != placeholder || style != placeholderStyle {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func (m *linesModel) GetCursor() (int, int, bool, bool) {
-	return m.x, m.y, m.cursor, !m.hide
+// Video plays vid in the area of the image drawn last.
+func (m *Image) Video(ctx context.Context, vid <-chan image.Image, frameDur time.Duration) error {
+	if m == nil || ctx == nil {
+		return nil
+	}
+	return m.res.Video(ctx, vid, frameDur)
+}
+
+// Close clears the graphics and releases the canvas.
+func (m *Image) Close() error {
+	if m == nil {
+		return nil
+	}
+	m.flush(term.Placement{}, false)
+	return m.res.Close()
 }
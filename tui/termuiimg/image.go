@@ -1,64 +1,200 @@
+// Package termuiimg provides a termui widget drawing images with the terminal's drawers.
 package termuiimg
 
 import (
+	"context"
 	"image"
+	"sync"
+	"time"
 
 	"github.com/gizak/termui/v3"
+	tb "github.com/nsf/termbox-go"
 
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/term"
 )
 
+var _ termui.Drawable = (*Image)(nil)
+
+var (
+	imagesMu sync.Mutex
+	images   = make(map[*Image]struct{})
+)
+
+// renderMu serializes termbox's output with the graphics drawn after it and
+// the video frames drawn by Image.Video.
+var renderMu sync.Mutex
+
+// Render renders the items like termui.Render and draws the graphics of the images
+// after termbox flushed the frame. Images rendered with termui.Render only reserve their cells.
+func Render(items ...termui.Drawable) {
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	termui.Render(items...)
+	flush()
+}
+
+// flush flushes the reservations of all images, images that weren't rendered keep their placement.
+func flush() {
+	imagesMu.Lock()
+	rs := make([]*term.Reservation, 0, len(images))
+	for m := range images {
+		rs = append(rs, m.res)
+	}
+	imagesMu.Unlock()
+	_ = term.FlushReservations(false, rs...) // logged by the reservations
+}
+
+// Image is a termui widget drawing an image into the inner area of its block.
+//
+// The area follows the rectangle set by SetRect, e.g. by a termui.Grid. Draw reserves the
+// cells of the area with placeholders, the graphics are drawn by Render after the frame
+// and only when the area or the image changed or after Invalidate and Clear.
+// The image is kept as *term.Image, so that the encoded image is reused by the drawers.
 type Image struct {
 	termui.Block
-	Canvas *term.Canvas
+	term *term.Terminal
+	res  *term.Reservation
 }
 
+// NewImage creates an image widget with the initial rectangle bounds.
+// bounds may be empty if the rectangle is set by a layout.
 func NewImage(tm *term.Terminal, img image.Image, bounds image.Rectangle) (*Image, error) {
 	if err := errors.NilParam(tm); err != nil {
 		return nil, err
 	}
 	_ = tm.SetOptions(term.TUIMode)
-	m := &Image{
-		Block: *termui.NewBlock(),
-	}
-	m.SetRect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
-	canvas, err := tm.NewCanvas(bounds)
+	res, err := tm.Reserve(nil)
 	if err != nil {
 		return nil, err
 	}
-	if img != nil {
-		err := canvas.SetImage(img)
-		if err != nil {
-			canvas.Close()
-			return nil, err
-		}
+	m := &Image{
+		Block: *termui.NewBlock(),
+		term:  tm,
+		res:   res,
 	}
-	m.Canvas = canvas
+	m.SetRect(bounds.Min.X, bounds.Min.Y, bounds.Max.X, bounds.Max.Y)
+	m.SetImage(img)
+	imagesMu.Lock()
+	images[m] = struct{}{}
+	imagesMu.Unlock()
 	return m, nil
 }
 
+// SetImage replaces the image. It is drawn by the next Render.
 func (m *Image) SetImage(img image.Image) {
-	if m == nil || m.Canvas == nil {
+	if m == nil {
+		return
+	}
+	if img == nil {
+		m.res.SetImage(nil)
 		return
 	}
-	_ = m.Canvas.SetImage(img)
+	m.res.SetImage(term.NewImage(img))
 }
 
+// Invalidate causes the graphics to be redrawn by the next Render, e.g. after they were overwritten.
+func (m *Image) Invalidate() {
+	if m == nil {
+		return
+	}
+	m.res.Invalidate()
+}
+
+// Draw draws the border of the block and reserves the inner area for the graphics.
 func (m *Image) Draw(buf *termui.Buffer) {
 	if m == nil {
 		return
 	}
 	m.Block.Draw(buf) // draw border
-	if m.Canvas == nil {
+	p := m.placement(buf.Rectangle)
+	// termui styles are palette colors, the cells keep the colors of the block
+	cell := termui.NewCell(m.res.Placeholder().Rune, termui.StyleClear)
+	buf.Fill(cell, p.Area)
+	m.res.Place(p)
+}
+
+// placement returns the placement of the inner area within the visible rectangle.
+func (m *Image) placement(visible image.Rectangle) term.Placement {
+	area := m.Inner.Intersect(visible)
+	return term.Placement{Area: area, Content: area.Sub(m.Inner.Min), Size: m.Inner.Size()}
+}
+
+// Clear clears the screen like termui.Clear and removes the graphics of all images.
+// The images are redrawn when they are rendered again.
+func Clear() {
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	termui.Clear()
+	// repaint the whole screen, termbox skips the unchanged placeholders below the graphics otherwise
+	_ = tb.Sync()
+	imagesMu.Lock()
+	terms := make(map[*term.Terminal]struct{})
+	for m := range images {
+		terms[m.term] = struct{}{}
+	}
+	imagesMu.Unlock()
+	for tm := range terms {
+		term.ClearPlacements(tm)
+	}
+	imagesMu.Lock()
+	defer imagesMu.Unlock()
+	for m := range images {
+		m.res.Invalidate()
+	}
+}
+
+// Video plays vid in the inner area of the image. The frames follow the area set by layouts,
+// the last frame stays the image of the widget.
+// The frames are drawn between the renderings of Render, termui.Render mustn't be used meanwhile.
+func (m *Image) Video(ctx context.Context, vid <-chan image.Image, frameDur time.Duration) error {
+	if m == nil {
+		return errors.NilReceiver()
+	}
+	if ctx == nil || vid == nil {
+		return errors.NilParam()
+	}
+	for {
+		start := time.Now()
+		select {
+		case <-ctx.Done():
+			return nil
+		case frame, ok := <-vid:
+			if !ok {
+				return nil
+			}
+			m.drawFrame(frame)
+		}
+		if d := time.Since(start); d < frameDur {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(frameDur - d):
+			}
+		}
+	}
+}
+
+func (m *Image) drawFrame(frame image.Image) {
+	if frame == nil {
 		return
 	}
-	_ = m.Canvas.Draw(nil)
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	m.Lock()
+	defer m.Unlock()
+	m.res.SetImage(term.NewImage(frame))
+	m.res.Place(m.placement(m.Inner))
+	_ = m.res.Flushed(false) // logged by the reservation
 }
 
+// Close clears the graphics and releases the canvas.
 func (m *Image) Close() error {
-	if m == nil || m.Canvas == nil {
+	if m == nil {
 		return nil
 	}
-	return m.Canvas.Close()
+	imagesMu.Lock()
+	delete(images, m)
+	imagesMu.Unlock()
+	return m.res.Close()
 }
@@ -1,5 +1,4 @@
-//go:build dev
-
+// Package tviewimg provides a tview primitive drawing images with the terminal's drawers.
 package tviewimg
 
 import (
@@ -7,27 +6,32 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+
+	"github.com/srlehn/termimg/internal/consts"
+	"github.com/srlehn/termimg/term"
 )
 
 // based on: github.com/rivo/tview/image.go (MIT License)
 
-// TODO implement
+var _ tview.FormItem = (*Image)(nil)
 
 // Image implements a widget that displays one image. The original image
-// (specified with [Image.SetImage]) is resized according to the specified size
-// (see [Image.SetSize]), using the specified number of colors (see
-// [Image.SetColors]), while applying dithering if necessary (see
-// [Image.SetDithering]).
+// (specified with [Image.SetImage]) is scaled according to the specified size
+// (see [Image.SetSize]) and drawn with the terminal's best drawer, e.g. kitty or sixel.
 //
-// Images are approximated by graphical characters in the terminal. The
-// resolution is therefore limited by the number and type of characters that can
-// be drawn in the terminal and the colors available in the terminal. The
-// quality of the final image also depends on the terminal's font and spacing
-// settings, none of which are under the control of this package. Results may
-// vary.
+// Graphics are drawn after tview finished drawing a frame, for this the images have to be
+// registered with the application by [Attach]. Images that aren't drawn in a frame,
+// e.g. on hidden pages, or that are painted over by other primitives, e.g. modals,
+// are cleared.
+//
+// Without graphics support or when the image isn't attached, the image is approximated
+// by graphical characters like tview's Image, using the specified number of colors
+// (see [Image.SetColors]), while applying dithering if necessary (see [Image.SetDithering]).
 type Image struct {
 	*tview.Box
 
+	term *term.Terminal
+
 	// The image to be displayed. If nil, the widget will be empty.
 	image image.Image
 
@@ -38,15 +42,8 @@ type Image struct {
 	// available space.
 	width, height int
 
-	// The number of colors to use. If 0, the number of colors is chosen based
-	// on the terminal's capabilities.
-	colors int
-
-	// The dithering algorithm to use, one of the constants starting with
-	// "ImageDithering".
-	dithering int
-
 	// The width of a terminal's cell divided by its height.
+	// If 0, it is taken from the terminal's cell size.
 	aspectRatio float64
 
 	// Horizontal and vertical alignment, one of the "Align" constants.
@@ -62,29 +59,76 @@ type Image struct {
 	// the label text.
 	labelWidth int
 
-	// The actual image size (in cells) when it was drawn the last time.
-	lastWidth, lastHeight int
-
 	// A callback function set by the Form class and called when the user leaves
 	// this form item.
 	finished func(tcell.Key)
+
+	// block character rendering
+	fallback *tview.Image
+
+	// set by Attach
+	attached bool
+
+	// The graphics, drawn after the frame.
+	res *term.Reservation
+
+	// The placement of the image in the current frame and the style of its reserved cells.
+	frame      term.Placement
+	frameStyle tcell.Style
+
+	// The screen cells locked for the graphics on screen.
+	locked image.Rectangle
+}
+
+// NewImage returns a new image widget drawing with the drawers of tm
+// with an empty image (use [Image.SetImage] to specify the image to be displayed).
+// The image will use the widget's entire available space.
+func NewImage(tm *term.Terminal) *Image {
+	i := &Image{
+		Box:             tview.NewBox(),
+		term:            tm,
+		alignHorizontal: tview.AlignCenter,
+		alignVertical:   tview.AlignCenter,
+		labelStyle:      tcell.StyleDefault.Foreground(tview.Styles.SecondaryTextColor),
+		fallback:        tview.NewImage(),
+	}
+	if tm != nil {
+		i.res, _ = tm.Reserve(nil)
+	}
+	i.fallback.SetAspectRatio(i.cellAspectRatio()).SetLabelStyle(i.labelStyle)
+	return i
 }
 
-// NewImage returns a new image widget with an empty image (use [Image.SetImage]
-// to specify the image to be displayed). The image will use the widget's entire
-// available space. The dithering algorithm is set to Floyd-Steinberg dithering.
-// The terminal's cell aspect ratio defaults to 0.5.
-func NewImage() *Image {
-	return &Image{
-		Box:         tview.NewBox(),
-		aspectRatio: 0.5,
+// Attach registers images with the application so that their graphics are drawn
+// and cleared after each frame. The application's after draw function is kept,
+// it has to be set before calling Attach.
+func Attach(app *tview.Application, images ...*Image) {
+	if app == nil || len(images) == 0 {
+		return
+	}
+	for _, img := range images {
+		if img != nil {
+			img.attached = true
+		}
 	}
+	prev := app.GetAfterDrawFunc()
+	var scr image.Point // screen size of the previous frame
+	app.SetAfterDrawFunc(func(screen tcell.Screen) {
+		if prev != nil {
+			prev(screen)
+		}
+		size := image.Pt(screen.Size())
+		// tview rewrites all cells after a resize
+		afterDraw(screen, images, size != scr)
+		scr = size
+	})
 }
 
 // SetImage sets the image to be displayed. If nil, the widget will be empty.
 func (i *Image) SetImage(image image.Image) *Image {
 	i.image = image
-	i.lastWidth, i.lastHeight = 0, 0
+	i.res.SetImage(image)
+	i.fallback.SetImage(image)
 	return i
 }
 
@@ -97,9 +141,81 @@ func (i *Image) SetImage(image image.Image) *Image {
 func (i *Image) SetSize(rows, columns int) *Image {
 	i.width = columns
 	i.height = rows
+	i.fallback.SetSize(rows, columns)
+	return i
+}
+
+// SetColors sets the number of colors of the block character rendering.
+// See [tview.Image.SetColors].
+func (i *Image) SetColors(colors int) *Image {
+	i.fallback.SetColors(colors)
+	return i
+}
+
+// GetColors returns the number of colors of the block character rendering.
+func (i *Image) GetColors() int {
+	return i.fallback.GetColors()
+}
+
+// SetDithering sets the dithering algorithm of the block character rendering,
+// one of tview's "Dithering" constants.
+func (i *Image) SetDithering(dithering int) *Image {
+	i.fallback.SetDithering(dithering)
+	return i
+}
+
+// SetAspectRatio sets the width of a terminal's cell divided by its height.
+// A value of 0 (the default) uses the terminal's cell size or 0.5 if it is unknown.
+func (i *Image) SetAspectRatio(aspectRatio float64) *Image {
+	i.aspectRatio = aspectRatio
+	i.fallback.SetAspectRatio(i.cellAspectRatio()).SetLabelStyle(i.labelStyle)
+	return i
+}
+
+// SetAlign sets the vertical and horizontal alignment of the image within the
+// widget's space. The possible values are [tview.AlignTop], [tview.AlignCenter],
+// and [tview.AlignBottom] for vertical alignment and [tview.AlignLeft],
+// [tview.AlignCenter], and [tview.AlignRight] for horizontal alignment.
+// The default is [tview.AlignCenter] for both.
+func (i *Image) SetAlign(vertical, horizontal int) *Image {
+	i.alignHorizontal = horizontal
+	i.alignVertical = vertical
+	i.fallback.SetAlign(vertical, horizontal)
+	return i
+}
+
+// SetLabel sets the text to be displayed before the image.
+func (i *Image) SetLabel(label string) *Image {
+	i.label = label
+	i.fallback.SetLabel(label)
+	return i
+}
+
+// GetLabel returns the text to be displayed before the image.
+func (i *Image) GetLabel() string {
+	return i.label
+}
+
+// SetLabelWidth sets the screen width of the label. A value of 0 will cause the
+// primitive to use the width of the label string.
+func (i *Image) SetLabelWidth(width int) *Image {
+	i.labelWidth = width
+	i.fallback.SetLabelWidth(width)
+	return i
+}
+
+// SetLabelStyle sets the style of the label.
+func (i *Image) SetLabelStyle(style tcell.Style) *Image {
+	i.labelStyle = style
+	i.fallback.SetLabelStyle(style)
 	return i
 }
 
+// GetLabelStyle returns the style of the label.
+func (i *Image) GetLabelStyle() tcell.Style {
+	return i.labelStyle
+}
+
 // GetFieldWidth returns this primitive's field width. This is the image's width
 // or, if the width is 0 or less, the proportional width of the image based on
 // its height as returned by [Image.GetFieldHeight]. If there is no image, 0 is
@@ -111,7 +227,7 @@ func (i *Image) GetFieldWidth() int {
 		}
 		bounds := i.image.Bounds()
 		height := i.GetFieldHeight()
-		return bounds.Dx() * height / bounds.Dy()
+		return int(float64(bounds.Dx()*height) / (float64(bounds.Dy()) * i.cellAspectRatio()))
 	}
 	return i.width
 }
@@ -125,10 +241,12 @@ func (i *Image) GetFieldHeight() int {
 	return i.height
 }
 
-func (i *Image) GetLabel() string { return `` }
-
 // SetFormAttributes sets a number of item attributes at once.
 func (i *Image) SetFormAttributes(labelWidth int, labelColor, bgColor, fieldTextColor, fieldBgColor tcell.Color) tview.FormItem {
+	i.labelWidth = labelWidth
+	i.labelStyle = i.labelStyle.Foreground(labelColor)
+	i.SetBackgroundColor(bgColor)
+	i.fallback.SetFormAttributes(labelWidth, labelColor, bgColor, fieldTextColor, fieldBgColor)
 	return i
 }
 
@@ -156,9 +274,204 @@ func (i *Image) Focus(delegate func(p tview.Primitive)) {
 }
 
 // Draw draws this primitive onto the screen.
+// With graphics, the image cells are reserved with placeholders, the graphics are drawn after the frame.
 func (i *Image) Draw(screen tcell.Screen) {
+	if !i.graphics() {
+		i.DrawForSubclass(screen, i)
+		i.fallback.SetBackgroundColor(i.GetBackgroundColor())
+		i.fallback.SetRect(i.GetInnerRect())
+		i.fallback.Draw(screen)
+		return
+	}
 	i.DrawForSubclass(screen, i)
 
-	// Regenerate image if necessary.
-	// i.render()
+	// Draw label.
+	viewX, viewY, viewWidth, viewHeight := i.GetInnerRect()
+	labelFg, _, _ := i.labelStyle.Decompose()
+	if i.labelWidth > 0 {
+		labelWidth := min(i.labelWidth, viewWidth)
+		tview.Print(screen, i.label, viewX, viewY, labelWidth, tview.AlignLeft, labelFg)
+		viewX += labelWidth
+		viewWidth -= labelWidth
+	} else {
+		_, drawnWidth := tview.Print(screen, i.label, viewX, viewY, viewWidth, tview.AlignLeft, labelFg)
+		viewX += drawnWidth
+		viewWidth -= drawnWidth
+	}
+
+	// Determine image placement.
+	width, height := i.size(viewWidth, viewHeight)
+	if width <= 0 || height <= 0 {
+		return
+	}
+	x, y := viewX, viewY
+	if i.alignHorizontal == tview.AlignCenter {
+		x += (viewWidth - width) / 2
+	} else if i.alignHorizontal == tview.AlignRight {
+		x += viewWidth - width
+	}
+	if i.alignVertical == tview.AlignCenter {
+		y += (viewHeight - height) / 2
+	} else if i.alignVertical == tview.AlignBottom {
+		y += viewHeight - height
+	}
+	img := image.Rect(x, y, x+width, y+height)
+	area := img.Intersect(image.Rect(viewX, viewY, viewX+viewWidth, viewY+viewHeight))
+	if area.Empty() {
+		return
+	}
+
+	// Reserve the cells, other primitives drawing over them are detected after the frame.
+	mainc, style := i.placeholder()
+	for row := area.Min.Y; row < area.Max.Y; row++ {
+		for col := area.Min.X; col < area.Max.X; col++ {
+			screen.SetContent(col, row, mainc, nil, style)
+		}
+	}
+	i.frame = term.Placement{Area: area, Content: area.Sub(img.Min), Size: img.Size()}
+	i.frameStyle = style
+}
+
+// placeholder returns the rune and style of the reserved cells.
+func (i *Image) placeholder() (rune, tcell.Style) {
+	pc := i.res.Placeholder()
+	style := tcell.StyleDefault.Background(i.GetBackgroundColor())
+	if pc.Fg != nil {
+		style = style.Foreground(tcell.FromImageColor(pc.Fg))
+	}
+	if pc.Bg != nil {
+		style = style.Background(tcell.FromImageColor(pc.Bg))
+	}
+	return pc.Rune, style
+}
+
+// size returns the image size in cells within the available space.
+func (i *Image) size(availWidth, availHeight int) (width, height int) {
+	if i.image == nil || availWidth <= 0 || availHeight <= 0 {
+		return 0, 0
+	}
+	bounds := i.image.Bounds()
+	imageWidth, imageHeight := bounds.Dx(), bounds.Dy()
+	if imageWidth <= 0 || imageHeight <= 0 {
+		return 0, 0
+	}
+	if aspectRatio := i.cellAspectRatio(); aspectRatio != 1.0 {
+		imageWidth = int(float64(imageWidth) / aspectRatio)
+	}
+	width, height = i.width, i.height
+	if width == 0 && height == 0 {
+		// Use all available space.
+		width, height = availWidth, availHeight
+		if adjustedWidth := imageWidth * height / imageHeight; adjustedWidth < width {
+			width = adjustedWidth
+		} else {
+			height = imageHeight * width / imageWidth
+		}
+		return width, height
+	}
+	// Turn percentages into absolute values.
+	if width < 0 {
+		width = availWidth * -width / 100
+	}
+	if height < 0 {
+		height = availHeight * -height / 100
+	}
+	if width == 0 {
+		// Adjust the width.
+		width = imageWidth * height / imageHeight
+	} else if height == 0 {
+		// Adjust the height.
+		height = imageHeight * width / imageWidth
+	}
+	return width, height
+}
+
+func (i *Image) cellAspectRatio() float64 {
+	if i.aspectRatio > 0 {
+		return i.aspectRatio
+	}
+	if i.term != nil {
+		if cw, ch, err := i.term.CellSize(); err == nil && cw > 0 && ch > 0 {
+			return cw / ch
+		}
+	}
+	return 0.5
+}
+
+// graphics reports whether the image is drawn by a graphics drawer.
+func (i *Image) graphics() bool {
+	if !i.attached || i.term == nil {
+		return false
+	}
+	drawers := i.term.Drawers()
+	// the generic drawer writes block characters that tview would overwrite
+	return len(drawers) > 0 && drawers[0] != nil && drawers[0].Name() != consts.DrawerGenericName
+}
+
+// Close clears the graphics and releases the canvas of the image.
+func (i *Image) Close() error {
+	if i == nil {
+		return nil
+	}
+	return i.res.Close()
+}
+
+// afterDraw places the images drawn in the frame and flushes their reservations:
+// graphics of images that aren't visible anymore, moved or were painted over are cleared,
+// the graphics of the images drawn in the frame are drawn. rewritten reports whether
+// tview rewrote all cells of the screen.
+func afterDraw(screen tcell.Screen, images []*Image, rewritten bool) {
+	rs := make([]*term.Reservation, 0, len(images))
+	for _, img := range images {
+		if img == nil || img.res == nil {
+			continue
+		}
+		p := img.frame
+		if !img.graphics() || img.obscured(screen) {
+			p = term.Placement{}
+		}
+		img.res.Place(p)
+		rs = append(rs, img.res)
+	}
+	_ = term.FlushReservations(rewritten, rs...) // logged by the reservations
+	for _, img := range images {
+		if img == nil || img.res == nil {
+			continue
+		}
+		shown := img.res.Shown()
+		if shown != img.res.Placement() {
+			// tcell rewrites the unlocked cells, which erases graphics drawn into the cells (sixel, iTerm2)
+			img.res.Invalidate()
+			shown = term.Placement{}
+		}
+		img.lock(screen, shown.Area)
+		img.frame = term.Placement{}
+	}
+}
+
+// obscured reports whether other primitives drew over the cells reserved in the frame.
+func (i *Image) obscured(screen tcell.Screen) bool {
+	area := i.frame.Area
+	placeholder, _ := i.placeholder()
+	for row := area.Min.Y; row < area.Max.Y; row++ {
+		for col := area.Min.X; col < area.Max.X; col++ {
+			mainc, _, style, _ := screen.GetContent(col, row)
+			if mainc != placeholder || style != i.frameStyle {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lock locks the cells of area instead of the previously locked cells,
+// so that tcell doesn't overwrite the graphics.
+func (i *Image) lock(screen tcell.Screen, area image.Rectangle) {
+	if area == i.locked {
+		return
+	}
+	l := i.locked
+	screen.LockRegion(l.Min.X, l.Min.Y, l.Dx(), l.Dy(), false)
+	screen.LockRegion(area.Min.X, area.Min.Y, area.Dx(), area.Dy(), true)
+	i.locked = area
 }
@@ -0,0 +1,118 @@
+// Package uvimg provides an ultraviolet Drawable drawing images with the terminal's drawers.
+//
+// The terminal has to use a uvtty.TTYUV. Frames are displayed with Display, which draws
+// the graphics of the images after ultraviolet flushed the frame.
+package uvimg
+
+import (
+	"image"
+
+	uv "github.com/charmbracelet/ultraviolet"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/term"
+	"github.com/srlehn/termimg/tty/uvtty"
+)
+
+var _ uv.Drawable = (*Image)(nil)
+
+// Image is a uv.Drawable drawing an image into the area passed to Draw.
+//
+// Draw reserves the cells of the area with placeholders, unchanged cells aren't rewritten
+// by ultraviolet. The graphics are drawn by Display after the frame was flushed and redrawn
+// when the area moves, the screen is resized or a row of the image was rewritten.
+// They are cleared when the image isn't drawn in a frame anymore. Partially visible images are cropped.
+// Graphics painted over by drawables drawn after the image aren't redrawn until the cells
+// hold the placeholders again, ultraviolet's cells show through in-cell graphics (sixel).
+type Image struct {
+	screen *screen
+	res    *term.Reservation
+
+	// guarded by screen.mu
+	area   uv.Rectangle // area passed to Draw in the current frame
+	placed bool         // drawn in the current frame
+}
+
+// NewImage creates an image drawable for the ultraviolet terminal of tm.
+func NewImage(tm *term.Terminal, img image.Image) (*Image, error) {
+	if err := errors.NilParam(tm, img); err != nil {
+		return nil, err
+	}
+	tty, ok := tm.TTY().(*uvtty.TTYUV)
+	if !ok || tty == nil || tty.UVTerminal() == nil {
+		return nil, errors.New(`uvimg.Image requires a uvtty.TTYUV`)
+	}
+	res, err := tm.Reserve(img)
+	if err != nil {
+		return nil, err
+	}
+	m := &Image{res: res}
+	screenOf(tm, tty).add(m)
+	return m, nil
+}
+
+// SetImage replaces the image. It is drawn at the next Display.
+func (m *Image) SetImage(img image.Image) {
+	if m == nil {
+		return
+	}
+	m.res.SetImage(img)
+}
+
+// Invalidate causes the graphics to be redrawn at the next Display, e.g. after they were overwritten.
+func (m *Image) Invalidate() {
+	if m == nil {
+		return
+	}
+	m.res.Invalidate()
+}
+
+// Draw implements uv.Drawable. It reserves the cells of area, which is in the coordinates
+// of the terminal screen.
+func (m *Image) Draw(scr uv.Screen, area uv.Rectangle) {
+	if m == nil || scr == nil {
+		return
+	}
+	m.screen.mu.Lock()
+	defer m.screen.mu.Unlock()
+	m.area, m.placed = area, true
+	placeholder := m.placeholder()
+	visible := area.Intersect(scr.Bounds())
+	for y := visible.Min.Y; y < visible.Max.Y; y++ {
+		for x := visible.Min.X; x < visible.Max.X; x++ {
+			scr.SetCell(x, y, &placeholder)
+		}
+	}
+}
+
+// placeholder returns the cell marking the cells of the image.
+func (m *Image) placeholder() uv.Cell {
+	pc := m.res.Placeholder()
+	return uv.Cell{Content: string(pc.Rune), Width: 1, Style: uv.Style{Fg: pc.Fg, Bg: pc.Bg}}
+}
+
+// placement returns the position of the image in the current frame.
+func (m *Image) placement(bounds uv.Rectangle) term.Placement {
+	if !m.placed {
+		return term.Placement{}
+	}
+	visible := m.area.Intersect(bounds)
+	if visible.Empty() {
+		return term.Placement{}
+	}
+	return term.Placement{
+		Area:    visible,
+		Content: visible.Sub(m.area.Min),
+		Size:    m.area.Size(),
+	}
+}
+
+// Close removes the image from the screen and releases the canvas.
+// Graphics drawn into the cells are cleared at the next Display.
+func (m *Image) Close() error {
+	if m == nil || m.screen == nil {
+		return nil
+	}
+	m.screen.remove(m)
+	return m.res.Close()
+}
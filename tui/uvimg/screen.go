@@ -0,0 +1,154 @@
+package uvimg
+
+import (
+	"slices"
+	"sync"
+
+	uv "github.com/charmbracelet/ultraviolet"
+
+	"github.com/srlehn/termimg/internal/errors"
+	"github.com/srlehn/termimg/term"
+	"github.com/srlehn/termimg/tty/uvtty"
+)
+
+var (
+	screensMu    sync.Mutex
+	screensByTTY = make(map[*uvtty.TTYUV]*screen)
+)
+
+// screen holds the images of an ultraviolet terminal and draws them between its frames.
+type screen struct {
+	term *term.Terminal
+	tty  *uvtty.TTYUV
+
+	mu     sync.Mutex
+	images []*Image
+	rows   map[int][]uv.Cell // rows of the images in the last flushed frame
+	bounds uv.Rectangle
+}
+
+func screenOf(tm *term.Terminal, tty *uvtty.TTYUV) *screen {
+	screensMu.Lock()
+	defer screensMu.Unlock()
+	s, ok := screensByTTY[tty]
+	if !ok {
+		s = &screen{term: tm, tty: tty}
+		screensByTTY[tty] = s
+	}
+	return s
+}
+
+func (s *screen) add(m *Image) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.screen = s
+	s.images = append(s.images, m)
+}
+
+func (s *screen) remove(m *Image) {
+	screensMu.Lock()
+	defer screensMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images = slices.DeleteFunc(s.images, func(img *Image) bool { return img == m })
+	if len(s.images) == 0 {
+		delete(screensByTTY, s.tty)
+	}
+}
+
+// Display displays d on the screen of the ultraviolet terminal like (*uv.TerminalScreen).Display
+// and draws the graphics of the images afterwards.
+func Display(tm *term.Terminal, d uv.Drawable) error {
+	if err := errors.NilParam(tm); err != nil {
+		return err
+	}
+	tty, ok := tm.TTY().(*uvtty.TTYUV)
+	if !ok || tty == nil || tty.UVTerminal() == nil {
+		return errors.New(`uvimg.Display requires a uvtty.TTYUV`)
+	}
+	scr := tty.UVTerminal().Screen()
+	s := screenOf(tm, tty)
+	s.beginFrame()
+	if err := scr.Display(d); err != nil {
+		return errors.New(err)
+	}
+	return s.flushed(scr)
+}
+
+// beginFrame forgets the areas of the images of the last frame.
+func (s *screen) beginFrame() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.images {
+		m.placed = false
+	}
+}
+
+// flushed draws the images of the flushed frame. The graphics are redrawn when
+// ultraviolet might have written over them.
+func (s *screen) flushed(scr *uv.TerminalScreen) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bounds := scr.Bounds()
+	resized := bounds != s.bounds
+	s.bounds = bounds
+
+	rows := make(map[int][]uv.Cell)
+	reservations := make([]*term.Reservation, 0, len(s.images))
+	for _, m := range s.images {
+		p := m.placement(bounds)
+		if p.Visible() && !reserved(scr, p.Area, m.placeholder()) {
+			// painted over after Draw
+			p = term.Placement{}
+		}
+		for y := p.Area.Min.Y; y < p.Area.Max.Y; y++ {
+			if _, ok := rows[y]; !ok {
+				rows[y] = rowCells(scr, y)
+			}
+		}
+		if s.rewritten(p.Area, rows) {
+			m.res.Invalidate()
+		}
+		m.res.Place(p)
+		reservations = append(reservations, m.res)
+	}
+	s.rows = rows
+	return term.FlushReservations(resized, reservations...)
+}
+
+// rewritten reports whether a row of area changed since the last frame.
+// The renderer might have moved or rewritten the cells of the row.
+func (s *screen) rewritten(area uv.Rectangle, rows map[int][]uv.Cell) bool {
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		prev, ok := s.rows[y]
+		if !ok || !slices.Equal(prev, rows[y]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reserved reports whether the cells of area still hold the placeholders.
+func reserved(scr uv.Screen, area uv.Rectangle, placeholder uv.Cell) bool {
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			if c := scr.CellAt(x, y); c == nil || *c != placeholder {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func rowCells(scr uv.Screen, y int) []uv.Cell {
+	b := scr.Bounds()
+	cells := make([]uv.Cell, 0, b.Dx())
+	for x := b.Min.X; x < b.Max.X; x++ {
+		if c := scr.CellAt(x, y); c != nil {
+			cells = append(cells, *c)
+		} else {
+			cells = append(cells, uv.Cell{})
+		}
+	}
+	return cells
+}
@@ -3,7 +3,9 @@
 package ffmpeg
 
 import (
+	"bufio"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/png"
@@ -13,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/srlehn/termimg/internal/consts"
 	"github.com/srlehn/termimg/internal/errors"
@@ -48,14 +51,25 @@ func ExtractFrames(ctx context.Context, vidFilename string, sizePixels image.Poi
 }
 
 func StreamFrames(ctx context.Context, vidFilename string, sizePixels image.Point, fps int) (<-chan image.Image, error) {
+	return StreamFramesAt(ctx, vidFilename, sizePixels, fps, 0, 1)
+}
+
+// StreamFramesAt streams the frames of the video from the position offset on, played at speed.
+// The stream ends when ctx is canceled.
+func StreamFramesAt(ctx context.Context, vidFilename string, sizePixels image.Point, fps int, offset time.Duration, speed float64) (<-chan image.Image, error) {
+	if speed <= 0 {
+		return nil, errors.New(`invalid speed`)
+	}
 	cmd := exec.CommandContext(
 		ctx,
 		`ffmpeg`,
+		`-ss`, seconds(offset),
 		`-i`, vidFilename,
 		`-hide_banner`,
 		`-loglevel`, `quiet`,
+		`-an`,
 		`-s`, strconv.Itoa(sizePixels.X)+`x`+strconv.Itoa(sizePixels.Y),
-		`-vf`, `fps=`+strconv.Itoa(fps),
+		`-vf`, `setpts=PTS/`+strconv.FormatFloat(speed, 'f', -1, 64)+`,fps=`+strconv.Itoa(fps),
 		// `-r`, `1`,
 		`-s`, strconv.Itoa(sizePixels.X)+`x`+strconv.Itoa(sizePixels.Y),
 		`-f`, `image2pipe`,
@@ -73,36 +87,130 @@ func StreamFrames(ctx context.Context, vidFilename string, sizePixels image.Poin
 	}
 
 	vid := make(chan image.Image)
-	done := make(chan struct{}, 1)
 	go func() {
 		defer func() {
 			close(vid)
+			_ = pr.Close()
 			if cmd != nil && cmd.ProcessState != nil && !cmd.ProcessState.Exited() && cmd.Process != nil {
 				_ = cmd.Process.Kill()
 			}
 		}()
 		for {
-			select {
-			case <-done:
+			img, err := png.Decode(pr)
+			if err != nil {
+				// io.EOF or killed
 				return
-			default:
 			}
-			img, err := png.Decode(pr)
-			if err == io.EOF {
-				break
+			select {
+			case vid <- img:
+			case <-ctx.Done():
+				return
 			}
-			vid <- img
 		}
 	}()
 	go func() {
 		_ = cmd.Wait()
-		done <- struct{}{}
 		_ = pw.Close()
 	}()
 
 	return vid, nil
 }
 
+// StreamAudio streams the audio of the video from the position offset on, played at speed,
+// as stereo samples with sampleRate. The stream ends when ctx is canceled.
+func StreamAudio(ctx context.Context, vidFilename string, sampleRate int, offset time.Duration, speed float64) (*PCMStream, error) {
+	if speed <= 0 {
+		return nil, errors.New(`invalid speed`)
+	}
+	if sampleRate <= 0 {
+		return nil, errors.New(`invalid sample rate`)
+	}
+	cmd := exec.CommandContext(
+		ctx,
+		`ffmpeg`,
+		`-ss`, seconds(offset),
+		`-i`, vidFilename,
+		`-hide_banner`,
+		`-loglevel`, `quiet`,
+		`-vn`,
+		`-af`, atempo(speed),
+		`-ac`, `2`,
+		`-ar`, strconv.Itoa(sampleRate),
+		`-f`, `s16le`,
+		`pipe:`,
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.New(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.New(err)
+	}
+	return &PCMStream{cmd: cmd, r: bufio.NewReader(stdout)}, nil
+}
+
+// PCMStream is the audio of a video decoded by ffmpeg.
+// It is a beep.StreamCloser, the samples are in the range [-1, 1].
+type PCMStream struct {
+	cmd *exec.Cmd
+	r   *bufio.Reader
+	buf []byte
+	err error
+}
+
+// Stream fills samples, ok is false at the end of the stream.
+func (s *PCMStream) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.err != nil {
+		return 0, false
+	}
+	if need := 4 * len(samples); len(s.buf) < need {
+		s.buf = make([]byte, need)
+	}
+	k, err := io.ReadFull(s.r, s.buf[:4*len(samples)])
+	n = k / 4
+	for i := range n {
+		b := s.buf[4*i:]
+		samples[i][0] = float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		samples[i][1] = float64(int16(binary.LittleEndian.Uint16(b[2:]))) / (1 << 15)
+	}
+	if err != nil {
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			s.err = errors.New(err)
+		}
+		return n, n > 0
+	}
+	return n, true
+}
+
+// Err returns the read error that ended the stream.
+func (s *PCMStream) Err() error { return s.err }
+
+// Close stops ffmpeg.
+func (s *PCMStream) Close() error {
+	if s.cmd.Process != nil {
+		_ = s.cmd.Process.Kill()
+	}
+	_ = s.cmd.Wait()
+	return nil
+}
+
+// atempo returns the audio filter for speed, the filter is limited to factors between 0.5 and 2.
+func atempo(speed float64) string {
+	var filters []string
+	for ; speed > 2; speed /= 2 {
+		filters = append(filters, `atempo=2`)
+	}
+	for ; speed < 0.5; speed *= 2 {
+		filters = append(filters, `atempo=0.5`)
+	}
+	filters = append(filters, `atempo=`+strconv.FormatFloat(speed, 'f', -1, 64))
+	return strings.Join(filters, `,`)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(max(d, 0).Seconds(), 'f', 3, 64)
+}
+
 func ImageStream(ctx context.Context, rsz term.Resizer, sizePixels image.Point, pattern string) (<-chan image.Image, error) {
 	dir := filepath.Dir(pattern)
 	ds, err := os.ReadDir(dir)
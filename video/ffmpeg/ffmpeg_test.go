@@ -0,0 +1,34 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtempo(t *testing.T) {
+	tests := []struct {
+		speed float64
+		want  string
+	}{
+		{1, `atempo=1`},
+		{1.25, `atempo=1.25`},
+		{0.5, `atempo=0.5`},
+		{2, `atempo=2`},
+		{4, `atempo=2,atempo=2`},
+		{3, `atempo=2,atempo=1.5`},
+		{0.25, `atempo=0.5,atempo=0.5`},
+		{0.3, `atempo=0.5,atempo=0.6`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, atempo(tt.speed), `speed %v`, tt.speed)
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	assert.Equal(t, `0.000`, seconds(0))
+	assert.Equal(t, `0.000`, seconds(-time.Second), `negative offsets start at the beginning`)
+	assert.Equal(t, `1.500`, seconds(1500*time.Millisecond))
+	assert.Equal(t, `61.001`, seconds(time.Minute+time.Second+time.Millisecond))
+}
@@ -1,37 +1,349 @@
-//go:build dev
-
+// Package video plays videos on a term.Canvas.
+//
+// The package doesn't open an audio device, programs pass an audio player to NewMediaPlayer,
+// e.g. speaker.Play of gopxl/beep, and the frames follow the samples streamed to it.
 package video
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/gopxl/beep"
 
 	"github.com/srlehn/termimg/internal/errors"
 	"github.com/srlehn/termimg/term"
+	"github.com/srlehn/termimg/video/ffmpeg"
 )
 
+// speed limits of MediaPlayer.SetSpeed
+const (
+	MinSpeed = 0.25
+	MaxSpeed = 4
+)
+
+// MediaPlayer plays a video file decoded by ffmpeg on a canvas.
+//
+// Seeking and changing the speed restart ffmpeg at the current position.
+// If audio is played, the frames follow the samples streamed to the audio player,
+// otherwise the wall clock.
 type MediaPlayer struct {
-	canvas *term.Canvas
-	audio  beep.Streamer
-	player func(beep.Streamer) error
+	canvas     *term.Canvas
+	filename   string
+	fps        int
+	sampleRate beep.SampleRate
+	player     func(beep.Streamer) error
+
+	mu      sync.Mutex
+	offset  time.Duration // position of the current run
+	speed   float64
+	paused  bool
+	clock   *clock
+	restart bool
+	cancel  context.CancelFunc
 }
 
-func NewMediaPlayer(canvas *term.Canvas, audio beep.Streamer, player func(beep.Streamer) error) (*MediaPlayer, error) {
-	if err := errors.NilParam(canvas, audio, player); err != nil {
+// NewMediaPlayer creates a player for the video file filename drawn with fps frames per second.
+// The audio is passed to player with sampleRate, e.g. speaker.Play after speaker.Init(sampleRate, ...).
+// A nil player plays the video without audio.
+func NewMediaPlayer(canvas *term.Canvas, filename string, fps int, sampleRate beep.SampleRate, player func(beep.Streamer) error) (*MediaPlayer, error) {
+	if err := errors.NilParam(canvas); err != nil {
 		return nil, err
 	}
+	if len(filename) == 0 {
+		return nil, errors.New(`no video file`)
+	}
+	if fps < 1 {
+		return nil, errors.New(`invalid fps value`)
+	}
+	if player != nil && sampleRate <= 0 {
+		return nil, errors.New(`invalid sample rate`)
+	}
 	return &MediaPlayer{
-		canvas: canvas,
-		audio:  audio,
-		player: player,
+		canvas:     canvas,
+		filename:   filename,
+		fps:        fps,
+		sampleRate: sampleRate,
+		player:     player,
+		speed:      1,
 	}, nil
 }
 
+// Play plays the video until it ends or ctx is canceled.
+func (a *MediaPlayer) Play(ctx context.Context) error {
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	if ctx == nil {
+		return errors.NilParam()
+	}
+	frameDur := time.Second / time.Duration(a.fps)
+	defer a.canvas.SetVideoClock(nil)
+	for {
+		a.mu.Lock()
+		runCtx, cancel := context.WithCancel(ctx)
+		a.cancel, a.restart = cancel, false
+		offset, speed := a.offset, a.speed
+		clk := newClock(a.paused)
+		a.clock = clk
+		a.mu.Unlock()
+
+		err := a.run(runCtx, clk, offset, speed, frameDur)
+		cancel()
+
+		a.mu.Lock()
+		restart := a.restart
+		if !restart {
+			// the position is kept for playing again
+			a.offset += time.Duration(float64(clk.now()) * a.speed)
+		}
+		a.mu.Unlock()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !restart {
+			return err
+		}
+	}
+}
+
+// run plays the video from offset on until it ends or ctx is canceled.
+func (a *MediaPlayer) run(ctx context.Context, clk *clock, offset time.Duration, speed float64, frameDur time.Duration) error {
+	sizePixels := a.canvas.Bounds().Size()
+	vid, err := ffmpeg.StreamFramesAt(ctx, a.filename, sizePixels, a.fps, offset, speed)
+	if err != nil {
+		return errors.New(err)
+	}
+	if a.player != nil {
+		audio, err := ffmpeg.StreamAudio(ctx, a.filename, int(a.sampleRate), offset, speed)
+		if err == nil {
+			clk.startAudio(a.sampleRate)
+			go func() {
+				<-ctx.Done()
+				_ = audio.Close()
+			}()
+			if err := a.player(&clockStreamer{ctx: ctx, clock: clk, src: audio}); err != nil {
+				clk.endAudio()
+			}
+		}
+	}
+	a.canvas.SetVideoClock(clk.now)
+	return a.canvas.Video(ctx, vid, frameDur)
+}
+
+// Pause stops the video and the audio at the current frame.
 func (a *MediaPlayer) Pause() error {
-	// TODO send SIGTSTP/SIGSTOP to ffmpeg
-	return errors.NotImplemented()
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paused = true
+	if a.clock != nil {
+		a.clock.pause(true)
+	}
+	return nil
 }
 
+// Continue resumes the paused video.
 func (a *MediaPlayer) Continue() error {
-	// TODO send SIGCONT to ffmpeg
-	return errors.NotImplemented()
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paused = false
+	if a.clock != nil {
+		a.clock.pause(false)
+	}
+	return nil
+}
+
+// Paused reports whether the video is paused.
+func (a *MediaPlayer) Paused() bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.paused
+}
+
+// Position returns the position in the video.
+func (a *MediaPlayer) Position() time.Duration {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.position()
+}
+
+func (a *MediaPlayer) position() time.Duration {
+	if a.clock == nil || a.restart {
+		return a.offset
+	}
+	return a.offset + time.Duration(float64(a.clock.now())*a.speed)
+}
+
+// Seek continues the video at pos.
+func (a *MediaPlayer) Seek(pos time.Duration) error {
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.restartAt(max(pos, 0), a.speed)
+	return nil
+}
+
+// SeekBy moves the position in the video by d, backwards for negative d.
+func (a *MediaPlayer) SeekBy(d time.Duration) error {
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.restartAt(max(a.position()+d, 0), a.speed)
+	return nil
+}
+
+// Speed returns the playback speed.
+func (a *MediaPlayer) Speed() float64 {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.speed
+}
+
+// SetSpeed sets the playback speed, 1 is the normal speed.
+// It is limited to MinSpeed and MaxSpeed.
+func (a *MediaPlayer) SetSpeed(speed float64) error {
+	if a == nil {
+		return errors.NilReceiver()
+	}
+	if speed <= 0 {
+		return errors.New(`invalid speed`)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.restartAt(a.position(), min(max(speed, MinSpeed), MaxSpeed))
+	return nil
+}
+
+// restartAt restarts the running video at pos with speed. a.mu has to be locked.
+func (a *MediaPlayer) restartAt(pos time.Duration, speed float64) {
+	a.offset, a.speed = pos, speed
+	if a.cancel == nil || a.restart {
+		return
+	}
+	a.restart = true
+	a.cancel()
+}
+
+// clock is the playback time of a run of the player: the duration of the audio samples
+// streamed to the audio player, or the wall clock time without pauses.
+type clock struct {
+	mu      sync.Mutex
+	paused  bool
+	elapsed time.Duration // wall clock time before since
+	since   time.Time     // start of the wall clock time after the last pause
+	audio   bool
+	rate    beep.SampleRate
+	samples int
+}
+
+func newClock(paused bool) *clock {
+	c := &clock{paused: paused}
+	if !paused {
+		c.since = time.Now()
+	}
+	return c
+}
+
+func (c *clock) now() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nowLocked()
+}
+
+func (c *clock) nowLocked() time.Duration {
+	if c.audio {
+		return c.rate.D(c.samples)
+	}
+	if c.paused {
+		return c.elapsed
+	}
+	return c.elapsed + time.Since(c.since)
+}
+
+func (c *clock) pause(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if paused == c.paused {
+		return
+	}
+	if paused {
+		c.elapsed = c.nowLocked()
+	} else {
+		c.since = time.Now()
+	}
+	c.paused = paused
+}
+
+func (c *clock) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *clock) startAudio(rate beep.SampleRate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.audio, c.rate, c.samples = true, rate, 0
+}
+
+func (c *clock) played(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples += n
+}
+
+// endAudio continues with the wall clock when the audio ended before the video.
+func (c *clock) endAudio() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.audio {
+		return
+	}
+	c.elapsed = c.rate.D(c.samples)
+	c.since = time.Now()
+	c.audio = false
+}
+
+// clockStreamer advances the clock with the streamed samples and plays silence while paused.
+type clockStreamer struct {
+	ctx   context.Context
+	clock *clock
+	src   beep.Streamer
+}
+
+func (s *clockStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.ctx.Err() != nil {
+		return 0, false
+	}
+	if s.clock.isPaused() {
+		clear(samples)
+		return len(samples), true
+	}
+	n, ok = s.src.Stream(samples)
+	s.clock.played(n)
+	if !ok {
+		s.clock.endAudio()
+	}
+	return n, ok
 }
+
+func (s *clockStreamer) Err() error { return s.src.Err() }
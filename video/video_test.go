@@ -0,0 +1,134 @@
+package video
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	c := newClock(true)
+	assert.Zero(t, c.now(), `paused from the start`)
+
+	c.pause(false)
+	time.Sleep(10 * time.Millisecond)
+	c.pause(true)
+	elapsed := c.now()
+	assert.GreaterOrEqual(t, elapsed, 10*time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, elapsed, c.now(), `stopped while paused`)
+
+	// the audio clock counts the streamed samples
+	c.startAudio(beep.SampleRate(1000))
+	c.played(250)
+	assert.Equal(t, 250*time.Millisecond, c.now())
+	c.played(250)
+	assert.Equal(t, 500*time.Millisecond, c.now())
+
+	// the wall clock continues where the audio ended
+	c.endAudio()
+	assert.Equal(t, 500*time.Millisecond, c.now())
+	c.endAudio()
+	assert.Equal(t, 500*time.Millisecond, c.now())
+}
+
+func TestPosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		offset  time.Duration
+		played  time.Duration
+		speed   float64
+		restart bool
+		want    time.Duration
+	}{
+		{`start`, 0, 0, 1, false, 0},
+		{`normal speed`, 10 * time.Second, 2 * time.Second, 1, false, 12 * time.Second},
+		{`double speed`, 10 * time.Second, 2 * time.Second, 2, false, 14 * time.Second},
+		{`half speed`, 10 * time.Second, 2 * time.Second, 0.5, false, 11 * time.Second},
+		{`restarting`, 10 * time.Second, 2 * time.Second, 1, true, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &MediaPlayer{
+				offset:  tt.offset,
+				speed:   tt.speed,
+				restart: tt.restart,
+				clock:   &clock{paused: true, elapsed: tt.played},
+			}
+			assert.Equal(t, tt.want, a.Position())
+		})
+	}
+	assert.Equal(t, 3*time.Second, (&MediaPlayer{offset: 3 * time.Second}).Position(), `not playing`)
+}
+
+func TestSeekAndSpeed(t *testing.T) {
+	var canceled int
+	a := &MediaPlayer{
+		offset: 10 * time.Second,
+		speed:  1,
+		clock:  &clock{paused: true, elapsed: 2 * time.Second},
+		cancel: func() { canceled++ },
+	}
+	assert.NoError(t, a.SeekBy(5*time.Second))
+	assert.Equal(t, 17*time.Second, a.Position())
+	assert.True(t, a.restart)
+	assert.Equal(t, 1, canceled)
+
+	// the run is canceled once until it restarted
+	assert.NoError(t, a.SeekBy(-20*time.Second))
+	assert.Zero(t, a.Position(), `clamped to the start`)
+	assert.NoError(t, a.Seek(time.Minute))
+	assert.Equal(t, time.Minute, a.Position())
+	assert.Equal(t, 1, canceled)
+
+	tests := []struct {
+		speed float64
+		want  float64
+	}{
+		{2, 2},
+		{10, MaxSpeed},
+		{0.1, MinSpeed},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		assert.NoError(t, a.SetSpeed(tt.speed))
+		assert.Equal(t, tt.want, a.Speed())
+		assert.Equal(t, time.Minute, a.Position(), `speed %v keeps the position`, tt.speed)
+	}
+	assert.Error(t, a.SetSpeed(0))
+}
+
+func TestClockStreamer(t *testing.T) {
+	c := newClock(false)
+	c.startAudio(beep.SampleRate(100))
+	src := beep.Silence(30)
+	s := &clockStreamer{ctx: context.Background(), clock: c, src: src}
+	samples := make([][2]float64, 20)
+
+	n, ok := s.Stream(samples)
+	assert.True(t, ok)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, 200*time.Millisecond, c.now())
+
+	c.pause(true)
+	samples[0] = [2]float64{1, 1}
+	n, ok = s.Stream(samples)
+	assert.True(t, ok)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, [2]float64{}, samples[0], `silence while paused`)
+	assert.Equal(t, 200*time.Millisecond, c.now(), `the clock stops while paused`)
+	c.pause(false)
+
+	n, _ = s.Stream(samples)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, 300*time.Millisecond, c.now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.ctx = ctx
+	_, ok = s.Stream(samples)
+	assert.False(t, ok, `stopped with the run`)
+}